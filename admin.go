@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= ADMIN =========
+//
+// Administración de la instancia (usuarios, mantenimiento). Es un rol global
+// del usuario, independiente de cualquier permiso dentro de los datos de otros.
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// promoteAdmins da rol admin a los emails de ADMIN_EMAILS al arrancar, para
+// poder crear el primer administrador sin tocar la base de datos a mano.
+func promoteAdmins(db *gorm.DB) error {
+	emails := splitList(strings.ToLower(getEnv("ADMIN_EMAILS", "")))
+	if len(emails) == 0 {
+		return nil
+	}
+	res := db.Model(&User{}).Where("email IN ? AND role <> ?", emails, RoleAdmin).Update("role", RoleAdmin)
+	if res.RowsAffected > 0 {
+		log.Printf("ADMIN_EMAILS: %d usuario(s) promovidos a admin", res.RowsAffected)
+	}
+	return res.Error
+}
+
+// adminMiddleware es la cadena de /admin: red/mTLS, sesión y rol.
+func adminMiddleware(db *gorm.DB, ops *opsGuardConfig) []gin.HandlerFunc {
+	return []gin.HandlerFunc{OpsGuard(ops), AuthMiddleware(db), RequireInstanceAdmin(db)}
+}
+
+// RequireInstanceAdmin se encadena tras AuthMiddleware. Lee el rol de la BD en
+// cada petición para que retirar el rol tenga efecto inmediato. Los tokens
+// OAuth de apps de terceros no valen aquí, tengan el scope que tengan: /admin
+// solo admite la sesión del propio admin.
+func RequireInstanceAdmin(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("oauth_scope"); ok {
+			c.AbortWithStatusJSON(403, gin.H{"error": "este endpoint no admite tokens OAuth"})
+			return
+		}
+		var u User
+		if err := db.Select("id", "role").First(&u, c.GetUint("user_id")).Error; err != nil || u.Role != RoleAdmin {
+			c.AbortWithStatusJSON(403, gin.H{"error": "requiere admin de instancia"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func adminListUsersHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 500 {
+			limit = 50
+		}
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		q := db.Model(&User{})
+		if email := strings.TrimSpace(c.Query("email")); email != "" {
+			q = q.Where("email LIKE ?", "%"+escapeLike(strings.ToLower(email))+"%")
+		}
+		var total int64
+		if err := q.Count(&total).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		var users []User
+		if err := q.Order("id").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"total": total, "users": users})
+	}
+}
+
+// otherAdminsExist evita quedarse sin ningún admin al degradar o borrar.
+func otherAdminsExist(db *gorm.DB, exceptID uint) bool {
+	var n int64
+	db.Model(&User{}).Where("role = ? AND id <> ? AND deactivated_at IS NULL", RoleAdmin, exceptID).Count(&n)
+	return n > 0
+}
+
+func adminUpdateUserHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Role *string `json:"role"`
+	}
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if in.Role != nil {
+			if *in.Role != RoleUser && *in.Role != RoleAdmin {
+				c.JSON(400, gin.H{"error": "role debe ser user o admin"})
+				return
+			}
+			if u.Role == RoleAdmin && *in.Role != RoleAdmin && !otherAdminsExist(db, u.ID) {
+				c.JSON(409, gin.H{"error": "no se puede quitar el último admin"})
+				return
+			}
+			u.Role = *in.Role
+		}
+		if err := db.Save(&u).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, u)
+	}
+}
+
+func adminDeleteUserHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		if u.Role == RoleAdmin && !otherAdminsExist(db, u.ID) {
+			c.JSON(409, gin.H{"error": "no se puede borrar el último admin"})
+			return
+		}
+		if legalHoldBlocks(c, db, []uint{u.ID}, "account.delete") {
+			return
+		}
+		err := deleteAccounts(db, []uint{u.ID}, DeactivatedByAdmin, c.GetUint("user_id"))
+		if errors.Is(err, errLegalHold) {
+			c.JSON(423, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"deleted": u.ID})
+	}
+}
+
+// adminWipeDemoHandler lanza a mano el borrado que DEMO_MODE hace cada noche.
+func adminWipeDemoHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wipeDemoAccounts(db)
+		c.JSON(200, gin.H{"status": "ok"})
+	}
+}
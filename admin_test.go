@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// adminTestRouter monta la cadena real de /admin delante de un handler que
+// solo responde 200.
+func adminTestRouter(db *gorm.DB) *gin.Engine {
+	r := gin.New()
+	admin := r.Group("/admin", adminMiddleware(db, &opsGuardConfig{})...)
+	admin.GET("/users", func(c *gin.Context) { c.JSON(200, gin.H{"user_id": c.GetUint("user_id")}) })
+	return r
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	db, _ := newMockDB(t)
+	if w := doRequest(adminTestRouter(db), "GET", "/admin/users", ""); w.Code != 401 {
+		t.Fatalf("sin token: %d, quería 401", w.Code)
+	}
+}
+
+func TestAdminRejectsRegularUser(t *testing.T) {
+	db, mock := newMockDB(t)
+	expectActiveUser(mock)
+	expectRole(mock, 7, RoleUser)
+	if w := doRequest(adminTestRouter(db), "GET", "/admin/users", sessionToken(t, 7)); w.Code != 403 {
+		t.Fatalf("usuario normal: %d, quería 403", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminAcceptsInstanceAdmin(t *testing.T) {
+	db, mock := newMockDB(t)
+	expectActiveUser(mock)
+	expectRole(mock, 1, RoleAdmin)
+	if w := doRequest(adminTestRouter(db), "GET", "/admin/users", sessionToken(t, 1)); w.Code != 200 {
+		t.Fatalf("admin: %d, quería 200 (%s)", w.Code, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminRejectsDeactivatedAdmin(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`SELECT "timezone" FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"timezone"}))
+	if w := doRequest(adminTestRouter(db), "GET", "/admin/users", sessionToken(t, 1)); w.Code != 401 {
+		t.Fatalf("admin desactivado: %d, quería 401", w.Code)
+	}
+}
+
+// Un token OAuth nunca entra en /admin, aunque sea de un admin y tenga todos
+// los scopes.
+func TestAdminRejectsOAuthToken(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectQuery(`FROM "oauth_tokens"`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "app_id", "user_id", "scope"}).AddRow(1, 1, 1, "tasks:read tasks:write"))
+	expectActiveUser(mock)
+	expectRole(mock, 1, RoleAdmin)
+	w := doRequest(adminTestRouter(db), "GET", "/admin/users", oauthAccessPrefix+"abc")
+	if w.Code != 403 {
+		t.Fatalf("token OAuth: %d, quería 403", w.Code)
+	}
+}
+
+// Borrar una cuenta deja account.deleted con el admin que lo hizo.
+func TestAdminDeleteUserRecordsEvent(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role"}).AddRow(5, RoleUser))
+	mock.ExpectQuery(`legal_hold_at IS NOT NULL`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "avatar_key" FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"avatar_key"}))
+	mock.ExpectQuery(`SELECT "blob_key" FROM "imports"`).WillReturnRows(sqlmock.NewRows([]string{"blob_key"}))
+	expectPurge(mock)
+	expectDeletedEvent(mock, 1, DeactivatedByAdmin)
+	mock.ExpectCommit()
+
+	r := gin.New()
+	r.DELETE("/admin/users/:id", asUser(User{ID: 1}), adminDeleteUserHandler(db))
+	if w := doRequest(r, "DELETE", "/admin/users/5", ""); w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
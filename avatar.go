@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= AVATARES =========
+//
+// PUT /api/me/avatar recibe una imagen (PNG, JPEG o GIF) en el cuerpo, la
+// recorta al centro y la reduce a avatarSize x avatarSize en PNG, y la guarda
+// en el blob store. Sin avatar propio se usa Gravatar por el hash del email
+// (AVATAR_GRAVATAR=false lo desactiva y avatar_url queda vacío).
+//
+// avatar_url sale en todo User que se lee de la base de datos (AfterFind). Los
+// subidos apuntan a /avatars/:id, que redirige a una URL firmada del blob: así
+// la URL no caduca y el navegador la puede cachear.
+
+const (
+	avatarSize      = 256
+	avatarMaxPixels = 40_000_000 // evita descomprimir imágenes gigantes
+)
+
+var (
+	avatarMaxBytes = int64(getEnvInt("AVATAR_MAX_MB", 5)) << 20
+	avatarGravatar = getEnv("AVATAR_GRAVATAR", "true") == "true"
+)
+
+func gravatarURL(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return fmt.Sprintf("https://www.gravatar.com/avatar/%s?s=%d&d=identicon", hex.EncodeToString(sum[:]), avatarSize)
+}
+
+// AfterFind rellena AvatarURL. Las consultas con Select parcial (sin email ni
+// avatar_key) lo dejan vacío.
+func (u *User) AfterFind(*gorm.DB) error {
+	switch {
+	case u.AvatarKey != "":
+		// El sufijo cambia con cada subida para saltarse la caché.
+		u.AvatarURL = fmt.Sprintf("%s/avatars/%d?v=%s", publicURL, u.ID, strings.TrimSuffix(path.Base(u.AvatarKey), ".png"))
+	case avatarGravatar && u.Email != "":
+		u.AvatarURL = gravatarURL(u.Email)
+	}
+	return nil
+}
+
+// squareThumbnail recorta src al cuadrado central y lo reduce a size x size
+// promediando los píxeles de cada celda.
+func squareThumbnail(src image.Image, size int) *image.NRGBA {
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0, y0 := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		sy0, sy1 := y0+y*side/size, y0+(y+1)*side/size
+		sy1 = max(sy1, sy0+1)
+		for x := 0; x < size; x++ {
+			sx0, sx1 := x0+x*side/size, x0+(x+1)*side/size
+			sx1 = max(sx1, sx0+1)
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					c := color.NRGBAModel.Convert(src.At(sx, sy)).(color.NRGBA)
+					r, g, bl, a = r+uint64(c.R), g+uint64(c.G), bl+uint64(c.B), a+uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+func uploadAvatarHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(http.MaxBytesReader(c.Writer, c.Request.Body, avatarMaxBytes)); err != nil {
+			var tooBig *http.MaxBytesError
+			if errors.As(err, &tooBig) {
+				c.JSON(413, gin.H{"error": fmt.Sprintf("la imagen supera %d MB", avatarMaxBytes>>20)})
+				return
+			}
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "la imagen debe ser PNG, JPEG o GIF"})
+			return
+		}
+		if cfg.Width*cfg.Height > avatarMaxPixels {
+			c.JSON(400, gin.H{"error": "la imagen es demasiado grande"})
+			return
+		}
+		img, _, err := image.Decode(&buf)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "imagen dañada: " + err.Error()})
+			return
+		}
+		var out bytes.Buffer
+		if err := png.Encode(&out, squareThumbnail(img, avatarSize)); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		key := fmt.Sprintf("avatars/%d/%s.png", u.ID, randomHex(8))
+		if err := blobStore.Put(c.Request.Context(), key, &out, int64(out.Len()), "image/png"); err != nil {
+			c.JSON(500, gin.H{"error": "no pude guardar la imagen"})
+			return
+		}
+		old := u.AvatarKey
+		if err := db.Model(&u).Update("avatar_key", key).Error; err != nil {
+			blobStore.Delete(c.Request.Context(), key)
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if old != "" {
+			if err := blobStore.Delete(c.Request.Context(), old); err != nil && !errors.Is(err, errBlobNotFound) {
+				log.Printf("[AVATAR] no pude borrar %s: %v", old, err)
+			}
+		}
+		purgeCDN(requestDB(db, c.Request.Context()), userCacheKey(u.ID))
+		u.AvatarKey = key
+		u.AfterFind(db)
+		c.JSON(200, u)
+	}
+}
+
+func deleteAvatarHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		if u.AvatarKey != "" {
+			if err := blobStore.Delete(c.Request.Context(), u.AvatarKey); err != nil && !errors.Is(err, errBlobNotFound) {
+				log.Printf("[AVATAR] no pude borrar %s: %v", u.AvatarKey, err)
+			}
+			if err := db.Model(&u).Update("avatar_key", "").Error; err != nil {
+				c.JSON(500, gin.H{"error": "db error"})
+				return
+			}
+			purgeCDN(requestDB(db, c.Request.Context()), userCacheKey(u.ID))
+		}
+		u.AvatarKey, u.AvatarURL = "", ""
+		u.AfterFind(db)
+		c.JSON(200, u)
+	}
+}
+
+// avatarRedirectHandler: GET /avatars/:id, público como el propio avatar.
+// Solo sirve avatares subidos: el de Gravatar va directo en avatar_url, y
+// redirigir aquí dejaría sacar el hash del email de cualquier id.
+func avatarRedirectHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.Select("id", "avatar_key").First(&u, c.Param("id")).Error; err != nil || u.AvatarKey == "" {
+			c.JSON(404, gin.H{"error": "sin avatar"})
+			return
+		}
+		target, err := blobStore.SignURL(c.Request.Context(), u.AvatarKey, time.Hour)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "no pude firmar la URL"})
+			return
+		}
+		c.Header("Cache-Control", "public, max-age=300")
+		c.Redirect(http.StatusFound, target)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ========= AWS SIGV4 =========
+//
+// Firma de peticiones AWS Signature Version 4, compartida por el BlobStore de
+// S3/GCS y el mailer de SES. Evita arrastrar el SDK entero por dos llamadas.
+
+type awsSigner struct {
+	accessKey string
+	secretKey string
+	region    string
+	service   string
+}
+
+// sign añade X-Amz-Date, X-Amz-Content-Sha256 y Authorization a req.
+// payloadHash es el SHA-256 hex del cuerpo o "UNSIGNED-PAYLOAD" (solo S3).
+func (a awsSigner) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signed,
+		payloadHash,
+	}, "\n")
+	req.URL.RawPath = awsEscape(req.URL.Path, false)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.accessKey, a.scope(now), signed, a.signature(now, canonical)))
+}
+
+func (a awsSigner) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + a.region + "/" + a.service + "/aws4_request"
+}
+
+func (a awsSigner) signature(now time.Time, canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + a.scope(now) + "\n" + hex.EncodeToString(sum[:])
+	k := hmacSHA256([]byte("AWS4"+a.secretKey), now.Format("20060102"))
+	k = hmacSHA256(k, a.region)
+	k = hmacSHA256(k, a.service)
+	k = hmacSHA256(k, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(k, toSign))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape codifica según RFC 3986 como exige SigV4: solo quedan sin escapar
+// los caracteres no reservados (y "/" si encodeSlash es false).
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= 'A' && ch <= 'Z', ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+// ========= ENDPOINTS BETA =========
+//
+// Un endpoint experimental se monta con BetaGate("nombre") y solo responde a
+// quien lo pide explícitamente con la cabecera X-TaskFlow-Beta: nombre (varios
+// separados por comas) y además tiene la funcionalidad activada por un admin en
+// /admin/settings/beta, para todos o para una lista de usuarios. Sin la
+// cabecera es un 404 como cualquier ruta que no existe, así que los clientes
+// normales no notan nada.
+//
+// Las funcionalidades se registran en betaFeatures desde el fichero que monta
+// la ruta; los flags se guardan en el ajuste "beta.flags". BetaGate no lo lee
+// en cada petición: cada réplica lo guarda betaFlagsTTL, así que un cambio en
+// /admin/settings/beta tarda hasta eso en verse en las demás.
+
+const (
+	betaHeader       = "X-TaskFlow-Beta"
+	settingBetaFlags = "beta.flags"
+	betaFlagsTTL     = 10 * time.Second
+)
+
+// betaFeatures son las funcionalidades beta que existen, con su descripción.
+var betaFeatures = map[string]string{}
+
+func registerBetaFeature(name, description string) {
+	betaFeatures[name] = description
+}
+
+// betaFlag: Users vacío = cualquiera que mande la cabecera.
+type betaFlag struct {
+	Enabled bool   `json:"enabled"`
+	Users   []uint `json:"users,omitempty"`
+}
+
+var betaRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "taskflow_beta_requests_total",
+	Help: "Peticiones a endpoints beta, por funcionalidad y resultado.",
+}, []string{"feature", "result"})
+
+func loadBetaFlags(db *gorm.DB) map[string]betaFlag {
+	flags := map[string]betaFlag{}
+	if _, err := getSetting(db, settingBetaFlags, &flags); err != nil {
+		return map[string]betaFlag{}
+	}
+	return flags
+}
+
+var betaFlagsCache struct {
+	sync.Mutex
+	flags map[string]betaFlag
+	at    time.Time
+}
+
+// cachedBetaFlags es loadBetaFlags con la caché de BetaGate. Si la BD falla
+// no guarda nada y vuelve a intentarlo en la siguiente petición.
+func cachedBetaFlags(db *gorm.DB) map[string]betaFlag {
+	betaFlagsCache.Lock()
+	defer betaFlagsCache.Unlock()
+	if betaFlagsCache.flags != nil && time.Since(betaFlagsCache.at) < betaFlagsTTL {
+		return betaFlagsCache.flags
+	}
+	flags := map[string]betaFlag{}
+	if _, err := getSetting(db, settingBetaFlags, &flags); err != nil {
+		return map[string]betaFlag{}
+	}
+	betaFlagsCache.flags, betaFlagsCache.at = flags, time.Now()
+	return flags
+}
+
+func storeBetaFlags(flags map[string]betaFlag) {
+	betaFlagsCache.Lock()
+	betaFlagsCache.flags, betaFlagsCache.at = flags, time.Now()
+	betaFlagsCache.Unlock()
+}
+
+// betaRequested indica si la petición pide feature en X-TaskFlow-Beta.
+func betaRequested(c *gin.Context, feature string) bool {
+	for _, f := range strings.Split(c.GetHeader(betaHeader), ",") {
+		if strings.TrimSpace(f) == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// BetaGate va después de AuthMiddleware en cada ruta beta.
+func BetaGate(db *gorm.DB, feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", betaHeader)
+		if !betaRequested(c, feature) {
+			betaRequests.WithLabelValues(feature, "not_requested").Inc()
+			c.String(404, "404 page not found") // lo mismo que responde gin sin ruta
+			c.Abort()
+			return
+		}
+		flag := cachedBetaFlags(db)[feature]
+		if !flag.Enabled || (len(flag.Users) > 0 && !slices.Contains(flag.Users, c.GetUint("user_id"))) {
+			betaRequests.WithLabelValues(feature, "denied").Inc()
+			c.AbortWithStatusJSON(403, gin.H{"error": "la beta " + feature + " no está abierta para tu cuenta"})
+			return
+		}
+		betaRequests.WithLabelValues(feature, "served").Inc()
+		c.Header(betaHeader, feature)
+		c.Next()
+	}
+}
+
+type betaFeatureView struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	betaFlag
+}
+
+func adminBetaHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		flags := loadBetaFlags(db)
+		out := []betaFeatureView{}
+		for name, desc := range betaFeatures {
+			out = append(out, betaFeatureView{Name: name, Description: desc, betaFlag: flags[name]})
+		}
+		slices.SortFunc(out, func(a, b betaFeatureView) int { return strings.Compare(a.Name, b.Name) })
+		c.JSON(200, out)
+	}
+}
+
+// adminPutBetaHandler cambia los flags que vienen en el cuerpo; el resto se
+// conserva.
+func adminPutBetaHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in map[string]betaFlag
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		flags := loadBetaFlags(db)
+		for name, f := range in {
+			if _, ok := betaFeatures[name]; !ok {
+				c.JSON(400, gin.H{"error": "funcionalidad beta desconocida: " + name})
+				return
+			}
+			flags[name] = f
+		}
+		if err := putSetting(db, settingBetaFlags, flags); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		storeBetaFlags(flags)
+		c.JSON(200, flags)
+	}
+}
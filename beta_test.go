@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func betaTestRouter(t *testing.T, uid uint) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	storeBetaFlags(nil)
+	t.Cleanup(func() { storeBetaFlags(nil) })
+	db, mock := newMockDB(t)
+	r := gin.New()
+	r.GET("/api/beta/thing", asUser(User{ID: uid}), BetaGate(db, "thing"), func(c *gin.Context) {
+		c.JSON(200, gin.H{"ok": true})
+	})
+	return r, mock
+}
+
+func betaRequest(r *gin.Engine, header string) int {
+	req := httptest.NewRequest("GET", "/api/beta/thing", nil)
+	if header != "" {
+		req.Header.Set(betaHeader, header)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func expectBetaFlags(mock sqlmock.Sqlmock, value string) {
+	mock.ExpectQuery(`FROM "settings"`).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "value"}).AddRow(settingBetaFlags, value))
+}
+
+// Sin la cabecera es un 404 y ni se mira la BD.
+func TestBetaGateNeedsHeader(t *testing.T) {
+	r, mock := betaTestRouter(t, 7)
+	if code := betaRequest(r, ""); code != 404 {
+		t.Fatalf("status %d, quería 404", code)
+	}
+	if code := betaRequest(r, "other"); code != 404 {
+		t.Fatalf("con otra funcionalidad: status %d, quería 404", code)
+	}
+	expectBetaFlags(mock, `{}`)
+	if err := mock.ExpectationsWereMet(); err == nil {
+		t.Fatal("leyó los flags sin que nadie pidiera la beta")
+	}
+}
+
+func TestBetaGateChecksUsers(t *testing.T) {
+	r, mock := betaTestRouter(t, 7)
+	expectBetaFlags(mock, `{"thing":{"enabled":true,"users":[3]}}`)
+	if code := betaRequest(r, "other, thing"); code != 403 {
+		t.Fatalf("status %d, quería 403 para quien no está en la lista", code)
+	}
+
+	r, mock = betaTestRouter(t, 3)
+	expectBetaFlags(mock, `{"thing":{"enabled":true,"users":[3]}}`)
+	if code := betaRequest(r, "thing"); code != 200 {
+		t.Fatalf("status %d, quería 200", code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Los flags se leen una vez y se reutilizan durante betaFlagsTTL.
+func TestBetaGateCachesFlags(t *testing.T) {
+	r, mock := betaTestRouter(t, 3)
+	expectBetaFlags(mock, `{"thing":{"enabled":true}}`)
+	expectBetaFlags(mock, `{"thing":{"enabled":true}}`)
+	for range 3 {
+		if code := betaRequest(r, "thing"); code != 200 {
+			t.Fatalf("status %d, quería 200", code)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err == nil {
+		t.Fatal("leyó los flags de la BD en más de una petición")
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========= BLOB STORAGE =========
+
+// BlobStore guarda ficheros binarios (adjuntos, exportaciones...) sin que el
+// resto del código sepa dónde acaban. Las claves usan "/" como separador.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// SignURL devuelve una URL de descarga temporal que no requiere JWT.
+	SignURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// List devuelve los blobs cuya clave empieza por prefix.
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+}
+
+type BlobInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+var (
+	blobStore       BlobStore
+	errBlobNotFound = errors.New("blob no encontrado")
+	publicURL       = strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:8080"), "/")
+)
+
+// newBlobStore elige la implementación según BLOB_BACKEND (local, s3 o gcs).
+func newBlobStore() (BlobStore, error) {
+	switch backend := getEnv("BLOB_BACKEND", "local"); backend {
+	case "local":
+		dir := getEnv("BLOB_DIR", "./data/blobs")
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, err
+		}
+		key := []byte(getEnv("BLOB_SIGNING_KEY", string(jwtSecret)))
+		return &localBlobStore{dir: dir, signingKey: key}, nil
+	case "s3":
+		s := &s3BlobStore{
+			endpoint:  strings.TrimRight(getEnv("S3_ENDPOINT", "https://s3.amazonaws.com"), "/"),
+			bucket:    os.Getenv("S3_BUCKET"),
+			pathStyle: getEnv("S3_PATH_STYLE", "true") == "true",
+			signer: awsSigner{
+				accessKey: os.Getenv("S3_ACCESS_KEY"),
+				secretKey: os.Getenv("S3_SECRET_KEY"),
+				region:    getEnv("S3_REGION", "us-east-1"),
+				service:   "s3",
+			},
+		}
+		if s.bucket == "" || s.signer.accessKey == "" || s.signer.secretKey == "" {
+			return nil, errors.New("BLOB_BACKEND=s3 requiere S3_BUCKET, S3_ACCESS_KEY y S3_SECRET_KEY")
+		}
+		return s, nil
+	case "gcs":
+		// GCS expone una API XML compatible con S3 (firmas V4 con claves HMAC),
+		// así que reutilizamos el mismo cliente.
+		s := &s3BlobStore{
+			endpoint:  "https://storage.googleapis.com",
+			bucket:    os.Getenv("GCS_BUCKET"),
+			pathStyle: true,
+			signer: awsSigner{
+				accessKey: os.Getenv("GCS_HMAC_ACCESS_KEY"),
+				secretKey: os.Getenv("GCS_HMAC_SECRET"),
+				region:    "auto",
+				service:   "s3",
+			},
+		}
+		if s.bucket == "" || s.signer.accessKey == "" || s.signer.secretKey == "" {
+			return nil, errors.New("BLOB_BACKEND=gcs requiere GCS_BUCKET, GCS_HMAC_ACCESS_KEY y GCS_HMAC_SECRET")
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("BLOB_BACKEND desconocido: %s", backend)
+	}
+}
+
+// --- disco local ---
+
+type localBlobStore struct {
+	dir        string
+	signingKey []byte
+}
+
+// path convierte la clave en una ruta dentro de dir, rechazando "..".
+func (s *localBlobStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("clave inválida: %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *localBlobStore) Put(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return err
+	}
+	// Escribimos a un temporal y renombramos para no dejar ficheros a medias.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *localBlobStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errBlobNotFound
+	}
+	return f, err
+}
+
+func (s *localBlobStore) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *localBlobStore) List(_ context.Context, prefix string) ([]BlobInfo, error) {
+	var out []BlobInfo
+	err := filepath.WalkDir(s.dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		out = append(out, BlobInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	return out, err
+}
+
+func (s *localBlobStore) sign(key string, exp int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "%s\n%d", key, exp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *localBlobStore) SignURL(_ context.Context, key string, ttl time.Duration) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	exp := time.Now().Add(ttl).Unix()
+	q := url.Values{"expires": {strconv.FormatInt(exp, 10)}, "sig": {s.sign(key, exp)}}
+	return publicURL + "/blobs/" + awsEscape(key, false) + "?" + q.Encode(), nil
+}
+
+// serveHandler sirve los ficheros locales a partir de URLs firmadas con SignURL.
+func (s *localBlobStore) serveHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		exp, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+		if err != nil || time.Now().Unix() > exp ||
+			!hmac.Equal([]byte(c.Query("sig")), []byte(s.sign(key, exp))) {
+			c.JSON(403, gin.H{"error": "enlace inválido o caducado"})
+			return
+		}
+		p, err := s.path(key)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := os.Stat(p); err != nil {
+			c.JSON(404, gin.H{"error": "fichero no encontrado"})
+			return
+		}
+		c.File(p)
+	}
+}
+
+// --- S3 (y compatibles: MinIO, GCS XML API) ---
+
+type s3BlobStore struct {
+	endpoint  string
+	bucket    string
+	pathStyle bool
+	signer    awsSigner
+}
+
+var blobClient = &http.Client{Timeout: 5 * time.Minute}
+
+func (s *s3BlobStore) objectURL(key string) *url.URL {
+	u, _ := url.Parse(s.endpoint)
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	return u
+}
+
+func (s *s3BlobStore) do(ctx context.Context, method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	u := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// El cuerpo no se firma (UNSIGNED-PAYLOAD) para poder subir en streaming.
+	s.signer.sign(req, "UNSIGNED-PAYLOAD", time.Now().UTC())
+	return blobClient.Do(req)
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, r, size, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("put %s: respuesta %d", key, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *s3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errBlobNotFound
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("get %s: respuesta %d", key, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("delete %s: respuesta %d", key, resp.StatusCode)
+	}
+	return nil
+}
+
+// List pagina ListObjectsV2 hasta el final.
+func (s *s3BlobStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	var out []BlobInfo
+	token := ""
+	for {
+		u := s.objectURL("")
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = q.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		s.signer.sign(req, sha256Hex(nil), time.Now().UTC())
+		resp, err := blobClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return nil, fmt.Errorf("list %s: respuesta %d", prefix, resp.StatusCode)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range page.Contents {
+			out = append(out, BlobInfo{Key: c.Key, Size: c.Size, LastModified: c.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return out, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// SignURL genera una URL prefirmada (SigV4 por query string).
+func (s *s3BlobStore) SignURL(_ context.Context, key string, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+	u := s.objectURL(key)
+	q := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.signer.accessKey + "/" + s.signer.scope(now)},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		awsEscape(u.Path, false),
+		canonicalQuery(q),
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	q.Set("X-Amz-Signature", s.signer.signature(now, canonical))
+	u.RawQuery = canonicalQuery(q)
+	u.RawPath = awsEscape(u.Path, false)
+	return u.String(), nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= ALMACENAMIENTO =========
+//
+// Por usuario, el blob store guarda los ficheros de importación
+// (imports.blob_key, con su tamaño en blob_size) y el avatar. Los de
+// importación cuentan para la cuota QUOTA_STORAGE_MB (0 = sin límite) mientras
+// existen y salen en GET /api/me/usage como "storage"; el avatar, de tamaño
+// fijo, no.
+//
+// El trabajo "blobs.cleanup" (cada BLOB_CLEANUP_HOURS, 24; 0 lo desactiva)
+// borra:
+//   - los ficheros de importaciones terminadas o fallidas hace más de
+//     BLOB_RETENTION_HOURS (24), que ya nadie va a leer;
+//   - los huérfanos: blobs bajo imports/ o avatars/ sin fila que los
+//     referencie (cuenta borrada cuyo blob no se pudo borrar al momento,
+//     subida cortada a medias...). Solo los de
+//     más de una hora, para no pisar una subida en curso cuya fila aún no
+//     tiene la clave.
+
+var (
+	quotaStorageMB = getEnvInt("QUOTA_STORAGE_MB", 0)
+	blobRetention  = time.Duration(getEnvInt("BLOB_RETENTION_HOURS", 24)) * time.Hour
+)
+
+const blobOrphanGrace = time.Hour
+
+// blobOwners dice, por prefijo, qué tabla y columna guardan las claves en uso.
+var blobOwners = []struct {
+	prefix, column string
+	model          any
+}{
+	{"imports/", "blob_key", &Import{}},
+	{"avatars/", "avatar_key", &User{}},
+}
+
+// userBlobKeys son los blobs de las cuentas ids: su avatar y los ficheros de
+// sus importaciones.
+func userBlobKeys(db *gorm.DB, ids []uint) ([]string, error) {
+	var avatars, imports []string
+	if err := db.Model(&User{}).Where("id IN ? AND avatar_key <> ''", ids).Pluck("avatar_key", &avatars).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&Import{}).Where("user_id IN ? AND blob_key <> ''", ids).Pluck("blob_key", &imports).Error; err != nil {
+		return nil, err
+	}
+	return append(avatars, imports...), nil
+}
+
+// deleteBlobs borra keys del blob store. Lo que falle se queda para la
+// limpieza de huérfanos: ya no hay fila que lo referencie.
+func deleteBlobs(keys []string) {
+	for _, key := range keys {
+		if err := blobStore.Delete(context.Background(), key); err != nil && !errors.Is(err, errBlobNotFound) {
+			log.Printf("[BLOBS] no pude borrar %s: %v", key, err)
+		}
+	}
+}
+
+func storageUsage(db *gorm.DB, uid uint) (quotaUsage, error) {
+	var used int64
+	err := db.Model(&Import{}).Select("COALESCE(sum(blob_size), 0)").
+		Where("user_id = ? AND blob_key <> ''", uid).Scan(&used).Error
+	return newQuotaUsage(used, int64(quotaStorageMB)<<20, ""), err
+}
+
+// storageHeadroom devuelve cuántos bytes más caben (-1 sin límite).
+func storageHeadroom(db *gorm.DB, uid uint) (int64, error) {
+	if quotaStorageMB <= 0 {
+		return -1, nil
+	}
+	q, err := storageUsage(db, uid)
+	if err != nil {
+		return 0, err
+	}
+	return *q.Remaining, nil
+}
+
+func checkStorageQuota(db *gorm.DB, uid uint) {
+	if quotaStorageMB <= 0 {
+		return
+	}
+	if q, err := storageUsage(db, uid); err == nil {
+		checkQuota(db, uid, "storage", q)
+	}
+}
+
+// releaseImportBlob borra el fichero de una importación y deja de contarlo.
+func releaseImportBlob(ctx context.Context, db *gorm.DB, imp *Import) error {
+	if imp.BlobKey == "" {
+		return nil
+	}
+	if err := blobStore.Delete(ctx, imp.BlobKey); err != nil && !errors.Is(err, errBlobNotFound) {
+		return err
+	}
+	imp.BlobKey, imp.BlobSize = "", 0
+	return db.Model(imp).Updates(map[string]any{"blob_key": "", "blob_size": 0}).Error
+}
+
+type blobCleanupResult struct {
+	Expired      int   `json:"expired"`
+	Orphans      int   `json:"orphans"`
+	FreedBytes   int64 `json:"freed_bytes"`
+	FailedDelete int   `json:"failed_delete"`
+	Held         int   `json:"held"` // de cuentas en retención legal, no se tocan
+}
+
+func runBlobCleanup(ctx context.Context, db *gorm.DB) (blobCleanupResult, error) {
+	var r blobCleanupResult
+	var expired []Import
+	err := db.WithContext(ctx).Where("blob_key <> '' AND status IN ? AND finished_at < ?",
+		[]string{ImportDone, ImportFailed, ImportCanceled}, time.Now().Add(-blobRetention)).Find(&expired).Error
+	if err != nil {
+		return r, err
+	}
+	for i := range expired {
+		if held, err := heldUserIDs(db.WithContext(ctx), []uint{expired[i].UserID}); err != nil {
+			return r, err
+		} else if len(held) > 0 {
+			recordEvent(db, expired[i].UserID, "legal_hold.blocked", nil, gin.H{"action": "blob.cleanup", "by": 0, "import_id": expired[i].ID})
+			r.Held++
+			continue
+		}
+		size := expired[i].BlobSize
+		if err := releaseImportBlob(ctx, db, &expired[i]); err != nil {
+			log.Printf("[BLOBS] no pude borrar %s: %v", expired[i].BlobKey, err)
+			r.FailedDelete++
+			continue
+		}
+		r.Expired++
+		r.FreedBytes += size
+	}
+
+	for _, owner := range blobOwners {
+		blobs, err := blobStore.List(ctx, owner.prefix)
+		if err != nil {
+			return r, err
+		}
+		var keys []string
+		if err := db.WithContext(ctx).Model(owner.model).Where(owner.column+" <> ''").Pluck(owner.column, &keys).Error; err != nil {
+			return r, err
+		}
+		live := make(map[string]bool, len(keys))
+		for _, k := range keys {
+			live[k] = true
+		}
+		for _, b := range blobs {
+			if live[b.Key] || time.Since(b.LastModified) < blobOrphanGrace {
+				continue
+			}
+			if err := blobStore.Delete(ctx, b.Key); err != nil && !errors.Is(err, errBlobNotFound) {
+				log.Printf("[BLOBS] no pude borrar el huérfano %s: %v", b.Key, err)
+				r.FailedDelete++
+				continue
+			}
+			r.Orphans++
+			r.FreedBytes += b.Size
+		}
+	}
+	return r, nil
+}
+
+func blobCleanupJob(ctx context.Context, db *gorm.DB, _ Job) error {
+	r, err := runBlobCleanup(ctx, db)
+	if err != nil {
+		return err
+	}
+	log.Printf("[BLOBS] limpieza: %d caducados, %d huérfanos, %d bytes liberados, %d fallos", r.Expired, r.Orphans, r.FreedBytes, r.FailedDelete)
+	return nil
+}
+
+func enqueueBlobCleanup(db *gorm.DB) (Job, bool, error) {
+	var n int64
+	db.Model(&Job{}).Where("kind = ? AND status IN ?", "blobs.cleanup", []string{JobPending, JobRunning}).Count(&n)
+	if n > 0 {
+		return Job{}, false, nil
+	}
+	j, err := enqueueJob(db, "blobs.cleanup", nil)
+	return j, err == nil, err
+}
+
+func startBlobCleanupScheduler(db *gorm.DB, every time.Duration) {
+	for range time.Tick(every) {
+		if _, _, err := enqueueBlobCleanup(db); err != nil {
+			log.Printf("[BLOBS] no pude encolar la limpieza: %v", err)
+		}
+	}
+}
+
+func adminBlobCleanupHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		j, queued, err := enqueueBlobCleanup(requestDB(db, c.Request.Context()))
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if !queued {
+			c.JSON(409, gin.H{"error": "ya hay una limpieza en marcha"})
+			return
+		}
+		c.JSON(202, gin.H{"job_id": j.ID})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= BOUNCES / COMPLAINTS =========
+//
+// Los proveedores avisan por webhook cuando un correo rebota o el usuario lo
+// marca como spam. La dirección queda suprimida (EmailUndeliverableAt) y ya no
+// se le envía nada hasta que el usuario la reactive desde PATCH /api/me.
+//
+// URL a configurar en el proveedor:
+//   POST /webhooks/email/sendgrid?token=<EMAIL_WEBHOOK_TOKEN>
+//   POST /webhooks/email/ses?token=<EMAIL_WEBHOOK_TOKEN>   (suscripción SNS HTTPS)
+
+const (
+	SuppressBounce    = "bounce"
+	SuppressComplaint = "complaint"
+)
+
+// suppressEmail marca la dirección como no entregable. Si ya lo estaba se
+// conserva el primer motivo.
+func suppressEmail(db *gorm.DB, email, reason string) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return
+	}
+	res := db.Model(&User{}).
+		Where("lower(email) = ? AND email_undeliverable_at IS NULL", email).
+		Updates(map[string]any{"email_undeliverable_at": time.Now(), "email_suppression_reason": reason})
+	if res.Error != nil {
+		log.Printf("[MAIL] no pude suprimir %s: %v", email, res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("[MAIL] %s suprimido (%s)", email, reason)
+	}
+}
+
+// emailSuppressed indica si la dirección no debe recibir más correos.
+func emailSuppressed(db *gorm.DB, email string) bool {
+	var n int64
+	db.Model(&User{}).
+		Where("lower(email) = ? AND email_undeliverable_at IS NOT NULL", strings.ToLower(email)).
+		Count(&n)
+	return n > 0
+}
+
+func emailWebhookAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(401, gin.H{"error": "token inválido"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// sendgridEventsHandler procesa el Event Webhook de SendGrid (array de eventos).
+func sendgridEventsHandler(db *gorm.DB) gin.HandlerFunc {
+	type event struct {
+		Email string `json:"email"`
+		Event string `json:"event"`
+		Type  string `json:"type"`
+	}
+	return func(c *gin.Context) {
+		var events []event
+		if err := c.ShouldBindJSON(&events); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		for _, e := range events {
+			switch {
+			// "blocked" es un rechazo temporal; solo cuenta el rebote duro.
+			case e.Event == "bounce" && e.Type != "blocked":
+				suppressEmail(db, e.Email, SuppressBounce)
+			case e.Event == "spamreport":
+				suppressEmail(db, e.Email, SuppressComplaint)
+			}
+		}
+		c.Status(204)
+	}
+}
+
+// sesEventsHandler procesa notificaciones de SES entregadas por SNS. La
+// suscripción se confirma sola visitando SubscribeURL.
+func sesEventsHandler(db *gorm.DB) gin.HandlerFunc {
+	type snsEnvelope struct {
+		Type         string `json:"Type"`
+		Message      string `json:"Message"`
+		SubscribeURL string `json:"SubscribeURL"`
+	}
+	type recipient struct {
+		EmailAddress string `json:"emailAddress"`
+	}
+	type sesMessage struct {
+		NotificationType string `json:"notificationType"`
+		EventType        string `json:"eventType"`
+		Bounce           struct {
+			BounceType        string      `json:"bounceType"`
+			BouncedRecipients []recipient `json:"bouncedRecipients"`
+		} `json:"bounce"`
+		Complaint struct {
+			ComplainedRecipients []recipient `json:"complainedRecipients"`
+		} `json:"complaint"`
+	}
+	return func(c *gin.Context) {
+		// SNS manda text/plain, así que no usamos ShouldBindJSON.
+		var env snsEnvelope
+		if err := json.NewDecoder(c.Request.Body).Decode(&env); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		switch env.Type {
+		case "SubscriptionConfirmation":
+			if err := confirmSNSSubscription(c.Request.Context(), env.SubscribeURL); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			c.Status(204)
+			return
+		case "Notification":
+		default:
+			c.Status(204)
+			return
+		}
+		var m sesMessage
+		if err := json.Unmarshal([]byte(env.Message), &m); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		kind := m.NotificationType
+		if kind == "" {
+			kind = m.EventType
+		}
+		switch kind {
+		case "Bounce":
+			if m.Bounce.BounceType == "Permanent" {
+				for _, r := range m.Bounce.BouncedRecipients {
+					suppressEmail(db, r.EmailAddress, SuppressBounce)
+				}
+			}
+		case "Complaint":
+			for _, r := range m.Complaint.ComplainedRecipients {
+				suppressEmail(db, r.EmailAddress, SuppressComplaint)
+			}
+		}
+		c.Status(204)
+	}
+}
+
+// confirmSNSSubscription solo sigue URLs de SNS para no convertir el webhook
+// en un proxy hacia cualquier host.
+func confirmSNSSubscription(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || !strings.HasPrefix(u.Host, "sns.") || !strings.HasSuffix(u.Host, ".amazonaws.com") {
+		return errInvalidSubscribeURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, raw, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errInvalidSubscribeURL
+	}
+	return nil
+}
+
+var errInvalidSubscribeURL = errors.New("SubscribeURL inválida")
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= MARCA DE LA INSTANCIA =========
+//
+// Nombre, logo, color y email de soporte de una instancia autoalojada. Se
+// guardan en el ajuste "branding", los edita un admin y los lee cualquiera en
+// GET /branding (la web los necesita antes del login). Las plantillas de
+// correo los reciben como .Brand.
+
+const settingBranding = "branding"
+
+type Branding struct {
+	Name         string `json:"name"`
+	LogoURL      string `json:"logo_url,omitempty"`
+	AccentColor  string `json:"accent_color"`
+	SupportEmail string `json:"support_email,omitempty"`
+}
+
+var hexColorRe = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+func defaultBranding() Branding {
+	return Branding{Name: "TaskFlow", AccentColor: "#2563eb"}
+}
+
+// validate rellena los vacíos con los valores por defecto y rechaza lo que
+// no se puede meter sin riesgo en un correo o en la web.
+func (b *Branding) validate() error {
+	def := defaultBranding()
+	b.Name = strings.TrimSpace(b.Name)
+	if b.Name == "" {
+		b.Name = def.Name
+	}
+	if len(b.Name) > 80 {
+		return errors.New("name: máximo 80 caracteres")
+	}
+	if b.AccentColor == "" {
+		b.AccentColor = def.AccentColor
+	}
+	if !hexColorRe.MatchString(b.AccentColor) {
+		return errors.New("accent_color debe ser #rgb o #rrggbb")
+	}
+	if b.LogoURL != "" {
+		u, err := url.Parse(b.LogoURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.New("logo_url debe ser una URL http(s)")
+		}
+	}
+	if b.SupportEmail != "" {
+		if _, err := mail.ParseAddress(b.SupportEmail); err != nil {
+			return errors.New("support_email no es un email válido")
+		}
+	}
+	return nil
+}
+
+// loadBranding devuelve la marca guardada o la de por defecto. Un error de
+// base de datos no debe impedir mandar un correo, así que también cae en la
+// de por defecto.
+func loadBranding(db *gorm.DB) Branding {
+	b := defaultBranding()
+	if _, err := getSetting(db, settingBranding, &b); err != nil {
+		return defaultBranding()
+	}
+	return b
+}
+
+func brandingHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, loadBranding(db))
+	}
+}
+
+func adminPutBrandingHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var b Branding
+		if err := c.ShouldBindJSON(&b); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := b.validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := putSetting(db, settingBranding, b); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, b)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= CDN =========
+//
+// Solo se cachean en el borde las rutas públicas, que responden lo mismo a
+// cualquiera: llevan sus claves de caché (Surrogate-Key para Fastly,
+// Cache-Tag para Cloudflare) y cada cambio purga esas claves en el CDN, así
+// que no se quedan obsoletas. Hoy es solo GET /profiles/:slug, con la clave
+// user-<id> de su dueño.
+//
+// Todo /api depende del token, y un CDN que cachee por URL serviría las
+// tareas de uno a otro: NoStore lo marca "private, no-store".
+//
+// La purga va por la cola de trabajos ("cdn.purge"): si el CDN falla se
+// reintenta en vez de perderse.
+
+type cdnPurger interface {
+	Purge(ctx context.Context, keys []string) error
+}
+
+var cdn cdnPurger // nil = sin CDN
+
+func newCDNPurger() (cdnPurger, error) {
+	switch kind := os.Getenv("CDN_PROVIDER"); kind {
+	case "":
+		return nil, nil
+	case "fastly":
+		p := &fastlyPurger{serviceID: os.Getenv("FASTLY_SERVICE_ID"), token: os.Getenv("FASTLY_API_TOKEN")}
+		if p.serviceID == "" || p.token == "" {
+			return nil, errors.New("CDN_PROVIDER=fastly requiere FASTLY_SERVICE_ID y FASTLY_API_TOKEN")
+		}
+		return p, nil
+	case "cloudflare":
+		p := &cloudflarePurger{zoneID: os.Getenv("CLOUDFLARE_ZONE_ID"), token: os.Getenv("CLOUDFLARE_API_TOKEN")}
+		if p.zoneID == "" || p.token == "" {
+			return nil, errors.New("CDN_PROVIDER=cloudflare requiere CLOUDFLARE_ZONE_ID y CLOUDFLARE_API_TOKEN")
+		}
+		return p, nil
+	case "webhook":
+		p := &webhookPurger{url: os.Getenv("CDN_PURGE_URL"), token: os.Getenv("CDN_PURGE_TOKEN")}
+		if p.url == "" {
+			return nil, errors.New("CDN_PROVIDER=webhook requiere CDN_PURGE_URL")
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("CDN_PROVIDER desconocido: %s", kind)
+	}
+}
+
+func userCacheKey(uid uint) string { return fmt.Sprintf("user-%d", uid) }
+
+func setCacheKeys(c *gin.Context, keys ...string) {
+	c.Header("Surrogate-Key", strings.Join(keys, " "))
+	c.Header("Cache-Tag", strings.Join(keys, ","))
+}
+
+// NoStore impide que nadie entre medias (CDN, proxy) guarde respuestas del
+// grupo donde va; con "private" el navegador tampoco las reutiliza.
+func NoStore() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "private, no-store")
+		c.Next()
+	}
+}
+
+// purgeCDN encola la purga de keys. Sin CDN configurado no hace nada.
+func purgeCDN(db *gorm.DB, keys ...string) {
+	if cdn == nil || len(keys) == 0 {
+		return
+	}
+	if _, err := enqueueJob(db, "cdn.purge", keys); err != nil {
+		log.Printf("[CDN] no pude encolar la purga de %v: %v", keys, err)
+	}
+}
+
+func cdnPurgeJob(ctx context.Context, db *gorm.DB, j Job) error {
+	var keys []string
+	if err := json.Unmarshal([]byte(j.Payload), &keys); err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	if cdn == nil {
+		return nil
+	}
+	return cdn.Purge(ctx, keys)
+}
+
+// cdnPlugin purga el perfil público del dueño en cada cambio de tareas: sus
+// rachas y totales salen de ellas.
+type cdnPlugin struct {
+	db *gorm.DB
+}
+
+func (*cdnPlugin) Name() string { return "cdn-purge" }
+
+func (p *cdnPlugin) OnTaskEvent(ctx context.Context, ev TaskEvent) {
+	if ev.Kind == TaskReminder {
+		return
+	}
+	purgeCDN(requestDB(p.db, ctx), userCacheKey(ev.UserID))
+}
+
+// --- proveedores ---
+
+type fastlyPurger struct {
+	serviceID, token string
+}
+
+func (p *fastlyPurger) Purge(ctx context.Context, keys []string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.fastly.com/service/"+p.serviceID+"/purge", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Fastly-Key", p.token)
+	req.Header.Set("Surrogate-Key", strings.Join(keys, " "))
+	return checkPurgeResponse(notifyClient.Do(req))
+}
+
+type cloudflarePurger struct {
+	zoneID, token string
+}
+
+func (p *cloudflarePurger) Purge(ctx context.Context, keys []string) error {
+	raw, err := json.Marshal(map[string][]string{"tags": keys})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.cloudflare.com/client/v4/zones/"+p.zoneID+"/purge_cache", bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	return checkPurgeResponse(notifyClient.Do(req))
+}
+
+// webhookPurger manda {"keys": [...]} a un endpoint propio (Varnish, nginx,
+// un worker del CDN...).
+type webhookPurger struct {
+	url, token string
+}
+
+func (p *webhookPurger) Purge(ctx context.Context, keys []string) error {
+	raw, err := json.Marshal(map[string][]string{"keys": keys})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	return checkPurgeResponse(notifyClient.Do(req))
+}
+
+func checkPurgeResponse(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("CDN respondió %d", resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("%w: CDN respondió %d", errPermanent, resp.StatusCode)
+	}
+	return nil
+}
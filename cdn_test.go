@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// /api depende del token: ni una ficha de tarea ni un 401 pueden quedarse en
+// el CDN, ni llevar claves que inviten a cachearlos.
+func TestAPIResponsesAreNotStored(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`FROM "tasks"`).WillReturnRows(taskRows())
+	r := gin.New()
+	registerAPIRoutes(r.Group("/api", NoStore(), asUser(User{ID: 7, Timezone: "UTC"})), db)
+	guarded := gin.New()
+	registerAPIRoutes(guarded.Group("/api", NoStore(), AuthMiddleware(db)), db)
+
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"tarea":     doRequest(r, "GET", "/api/tasks/1", ""),
+		"sin token": doRequest(guarded, "GET", "/api/tasks/1", ""),
+	} {
+		h := w.Header()
+		if got := h["Cache-Control"]; len(got) != 1 || got[0] != "private, no-store" {
+			t.Errorf("%s: Cache-Control = %v, quería private, no-store", name, got)
+		}
+		if h["Surrogate-Key"] != nil || h["Cache-Tag"] != nil {
+			t.Errorf("%s: lleva claves de CDN: %v %v", name, h["Surrogate-Key"], h["Cache-Tag"])
+		}
+	}
+}
+
+func TestPublicProfileCarriesOwnerKey(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`FROM "users"`).WillReturnRows(sqlmock.NewRows(
+		[]string{"id", "public_slug", "timezone", "created_at"}).AddRow(7, "ana", "UTC", time.Now()))
+	mock.ExpectQuery(`SELECT DISTINCT`).WillReturnRows(sqlmock.NewRows([]string{"day"}))
+	mock.ExpectQuery(`completed_total`).WillReturnRows(sqlmock.NewRows(
+		[]string{"completed7d", "completed30d", "completed_total"}).AddRow(0, 0, 0))
+	mock.ExpectQuery(`date_trunc`).WillReturnRows(sqlmock.NewRows([]string{"week", "completed"}))
+	r := gin.New()
+	r.GET("/profiles/:slug", publicProfileHandler(db))
+
+	w := doRequest(r, "GET", "/profiles/ana", "")
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Surrogate-Key"); got != "user-7" {
+		t.Errorf("Surrogate-Key = %q, quería user-7", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
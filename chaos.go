@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= CHAOS =========
+//
+// Inyección de fallos para probar reintentos de clientes y nuestros propios
+// timeouts. Solo se activa con APP_ENV=dev o staging; en producción el
+// arranque falla si hay reglas configuradas.
+//
+//	CHAOS_RULES="GET /api/tasks*=latency:300ms@0.5,error:0.1; /auth/login=error:0.2"
+//
+// Cada regla es "[MÉTODO ]ruta=efectos"; la ruta es la de gin (/api/tasks/:id)
+// y admite "*" al final. Efectos: latency:<duración>[@prob] y error:<prob>
+// (responde 500). Se aplica la primera regla que encaje.
+//
+// CHAOS_DB_DROP_RATE (0-1) hace que esa fracción de consultas falle como si
+// se hubiera caído la conexión (driver.ErrBadConn), en cualquier ruta.
+
+type chaosRule struct {
+	method      string
+	path        string
+	prefix      bool
+	latency     time.Duration
+	latencyRate float64
+	errorRate   float64
+}
+
+func (r chaosRule) matches(method, path string) bool {
+	if r.method != "" && r.method != method {
+		return false
+	}
+	if r.prefix {
+		return strings.HasPrefix(path, r.path)
+	}
+	return path == r.path
+}
+
+func parseChaosRules(spec string) ([]chaosRule, error) {
+	var rules []chaosRule
+	for _, raw := range strings.Split(spec, ";") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		target, effects, ok := strings.Cut(raw, "=")
+		if !ok {
+			return nil, fmt.Errorf("regla de chaos sin '=': %q", raw)
+		}
+		var r chaosRule
+		fields := strings.Fields(target)
+		switch len(fields) {
+		case 1:
+			r.path = fields[0]
+		case 2:
+			r.method, r.path = strings.ToUpper(fields[0]), fields[1]
+		default:
+			return nil, fmt.Errorf("ruta de chaos inválida: %q", target)
+		}
+		if strings.HasSuffix(r.path, "*") {
+			r.path, r.prefix = strings.TrimSuffix(r.path, "*"), true
+		}
+		for _, eff := range strings.Split(effects, ",") {
+			kind, arg, _ := strings.Cut(strings.TrimSpace(eff), ":")
+			switch kind {
+			case "latency":
+				d, rate, _ := strings.Cut(arg, "@")
+				dur, err := time.ParseDuration(d)
+				if err != nil {
+					return nil, fmt.Errorf("latency inválida en %q: %w", raw, err)
+				}
+				r.latency, r.latencyRate = dur, 1
+				if rate != "" {
+					if r.latencyRate, err = parseRate(rate); err != nil {
+						return nil, err
+					}
+				}
+			case "error":
+				var err error
+				if r.errorRate, err = parseRate(arg); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, fmt.Errorf("efecto de chaos desconocido: %q", kind)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func parseRate(s string) (float64, error) {
+	p, err := strconv.ParseFloat(s, 64)
+	if err != nil || p < 0 || p > 1 {
+		return 0, fmt.Errorf("probabilidad inválida %q (0-1)", s)
+	}
+	return p, nil
+}
+
+// setupChaos devuelve nil si no hay nada que inyectar.
+func setupChaos(db *gorm.DB) (gin.HandlerFunc, error) {
+	spec := strings.TrimSpace(getEnv("CHAOS_RULES", ""))
+	dropRate, err := parseRate(getEnv("CHAOS_DB_DROP_RATE", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("CHAOS_DB_DROP_RATE: %w", err)
+	}
+	if spec == "" && dropRate == 0 {
+		return nil, nil
+	}
+	if appEnv != "dev" && appEnv != "staging" {
+		return nil, fmt.Errorf("CHAOS_RULES/CHAOS_DB_DROP_RATE solo se permiten con APP_ENV=dev o staging")
+	}
+	rules, err := parseChaosRules(spec)
+	if err != nil {
+		return nil, err
+	}
+	if dropRate > 0 {
+		inject := func(tx *gorm.DB) {
+			if rand.Float64() < dropRate {
+				tx.AddError(fmt.Errorf("chaos: %w", driver.ErrBadConn))
+			}
+		}
+		cb := db.Callback()
+		for _, err := range []error{
+			cb.Create().Before("gorm:create").Register("chaos:create", inject),
+			cb.Query().Before("gorm:query").Register("chaos:query", inject),
+			cb.Update().Before("gorm:update").Register("chaos:update", inject),
+			cb.Delete().Before("gorm:delete").Register("chaos:delete", inject),
+			cb.Raw().Before("gorm:raw").Register("chaos:raw", inject),
+		} {
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	log.Printf("[CHAOS] activo: %d regla(s), caída de BD %.0f%%", len(rules), dropRate*100)
+	return func(c *gin.Context) {
+		for _, r := range rules {
+			if !r.matches(c.Request.Method, c.FullPath()) {
+				continue
+			}
+			if r.latency > 0 && rand.Float64() < r.latencyRate {
+				c.Header("X-Chaos", "latency")
+				time.Sleep(r.latency)
+			}
+			if rand.Float64() < r.errorRate {
+				c.Header("X-Chaos", "error")
+				c.AbortWithStatusJSON(500, gin.H{"error": "chaos: error inyectado"})
+				return
+			}
+			break
+		}
+		c.Next()
+	}, nil
+}
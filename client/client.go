@@ -0,0 +1,230 @@
+// Package client es el cliente Go del API de TaskFlow.
+//
+//	c := client.New("https://taskflow.example.com", client.WithCredentials("ana@example.com", "secreto"))
+//	tasks, err := c.ListTasks(ctx, client.ListOptions{Sort: "due_at", Order: "asc"})
+//
+// Las peticiones idempotentes (GET, PUT, DELETE) se reintentan con espera
+// exponencial ante errores de red, 429 y 5xx, respetando Retry-After. Con
+// WithCredentials el cliente hace login solo y, si el token caduca (401),
+// vuelve a hacerlo una vez y repite la petición.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Client struct {
+	baseURL    string
+	http       *http.Client
+	maxRetries int
+	baseDelay  time.Duration
+
+	mu       sync.Mutex
+	token    string
+	email    string
+	password string
+}
+
+type Option func(*Client)
+
+// WithToken usa un JWT ya obtenido.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithCredentials permite al cliente hacer login (y repetirlo al caducar el token).
+func WithCredentials(email, password string) Option {
+	return func(c *Client) { c.email, c.password = email, password }
+}
+
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.http = h }
+}
+
+// WithRetries cambia el número de reintentos (3) y la primera espera (200ms).
+func WithRetries(max int, baseDelay time.Duration) Option {
+	return func(c *Client) { c.maxRetries, c.baseDelay = max, baseDelay }
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		http:       &http.Client{Timeout: 30 * time.Second},
+		maxRetries: 3,
+		baseDelay:  200 * time.Millisecond,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Token devuelve el JWT actual (vacío si aún no hay).
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// APIError es una respuesta 4xx/5xx del servidor.
+type APIError struct {
+	Status     int
+	Message    string
+	RetryAfter time.Duration
+	// RequestID es el X-Request-ID de la respuesta, para reportar el fallo.
+	RequestID string
+}
+
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("taskflow: %d %s (request %s)", e.Status, e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("taskflow: %d %s", e.Status, e.Message)
+}
+
+// IsNotFound indica si err es un 404 del API.
+func IsNotFound(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && e.Status == http.StatusNotFound
+}
+
+func retryable(method string, err error) bool {
+	if method != http.MethodGet && method != http.MethodPut && method != http.MethodDelete {
+		return false
+	}
+	var e *APIError
+	if errors.As(err, &e) {
+		return e.Status == http.StatusTooManyRequests || e.Status >= 500
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// do envía in como JSON y decodifica la respuesta en out: JSON si out es un
+// puntero, tal cual si es un io.Writer, descartada si es nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	return c.doAuth(ctx, method, path, query, in, out, true)
+}
+
+func (c *Client) doAuth(ctx context.Context, method, path string, query url.Values, in, out any, auth bool) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	return c.roundTrip(ctx, method, path, query, body, "application/json", out, auth)
+}
+
+// doRaw envía body sin codificar (ficheros de importación).
+func (c *Client) doRaw(ctx context.Context, method, path string, query url.Values, body []byte, out any) error {
+	return c.roundTrip(ctx, method, path, query, body, "application/octet-stream", out, true)
+}
+
+func (c *Client) roundTrip(ctx context.Context, method, path string, query url.Values, body []byte, contentType string, out any, auth bool) error {
+	if auth && c.Token() == "" && c.email != "" {
+		if err := c.login(ctx); err != nil {
+			return err
+		}
+	}
+	relogged := false
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, query, body, contentType, auth)
+		if err == nil {
+			defer resp.Body.Close()
+			if out == nil {
+				_, err = io.Copy(io.Discard, resp.Body)
+				return err
+			}
+			if w, ok := out.(io.Writer); ok {
+				_, err = io.Copy(w, resp.Body)
+				return err
+			}
+			return json.NewDecoder(resp.Body).Decode(out)
+		}
+		var apiErr *APIError
+		if auth && !relogged && c.email != "" && errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+			relogged = true
+			if err := c.login(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if attempt >= c.maxRetries || !retryable(method, err) {
+			return err
+		}
+		wait := c.baseDelay << attempt
+		wait += time.Duration(rand.Int64N(int64(wait)/2 + 1))
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body []byte, contentType string, auth bool) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if tok := c.Token(); auth && tok != "" {
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	apiErr := &APIError{Status: resp.StatusCode, RequestID: resp.Header.Get("X-Request-ID")}
+	var e struct {
+		Error string `json:"error"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(raw, &e) == nil && e.Error != "" {
+		apiErr.Message = e.Error
+	} else {
+		apiErr.Message = strings.TrimSpace(string(raw))
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(s) * time.Second
+	}
+	return nil, apiErr
+}
+
+func (c *Client) login(ctx context.Context) error {
+	c.mu.Lock()
+	email, password := c.email, c.password
+	c.mu.Unlock()
+	_, err := c.Login(ctx, email, password)
+	return err
+}
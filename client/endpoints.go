@@ -0,0 +1,402 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// --- auth ---
+
+// Register crea la cuenta. No hace login.
+func (c *Client) Register(ctx context.Context, email, password string) (*User, error) {
+	var u User
+	in := map[string]string{"email": email, "password": password}
+	return &u, c.doAuth(ctx, http.MethodPost, "/auth/register", nil, in, &u, false)
+}
+
+// Login obtiene un JWT y lo guarda para las siguientes peticiones.
+func (c *Client) Login(ctx context.Context, email, password string) (string, error) {
+	var out struct {
+		Token string `json:"token"`
+	}
+	in := map[string]string{"email": email, "password": password}
+	if err := c.doAuth(ctx, http.MethodPost, "/auth/login", nil, in, &out, false); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.token = out.Token
+	c.mu.Unlock()
+	return out.Token, nil
+}
+
+// --- tareas ---
+
+type ListOptions struct {
+	Sort   string // id, created_at, updated_at, due_at
+	Order  string // asc, desc
+	Preset string // id de un ViewPreset o "default"; Sort y Order mandan sobre él
+	// Sin fijar, valen las preferencias del usuario (User.ListPrefs).
+	ShowCompleted *bool
+	PerPage       int
+	Page          int
+}
+
+func (c *Client) ListTasks(ctx context.Context, opt ListOptions) ([]Task, error) {
+	q := url.Values{}
+	if opt.Sort != "" {
+		q.Set("sort", opt.Sort)
+	}
+	if opt.Order != "" {
+		q.Set("order", opt.Order)
+	}
+	if opt.Preset != "" {
+		q.Set("preset", opt.Preset)
+	}
+	if opt.ShowCompleted != nil {
+		q.Set("show_completed", strconv.FormatBool(*opt.ShowCompleted))
+	}
+	if opt.PerPage > 0 {
+		q.Set("per_page", strconv.Itoa(opt.PerPage))
+	}
+	if opt.Page > 0 {
+		q.Set("page", strconv.Itoa(opt.Page))
+	}
+	var out []Task
+	return out, c.do(ctx, http.MethodGet, "/api/tasks", q, nil, &out)
+}
+
+func (c *Client) GetTask(ctx context.Context, id uint) (*Task, error) {
+	var t Task
+	return &t, c.do(ctx, http.MethodGet, fmt.Sprintf("/api/tasks/%d", id), nil, nil, &t)
+}
+
+func (c *Client) CreateTask(ctx context.Context, in NewTask) (*Task, error) {
+	var t Task
+	return &t, c.do(ctx, http.MethodPost, "/api/tasks", nil, in, &t)
+}
+
+func (c *Client) UpdateTask(ctx context.Context, id uint, in TaskUpdate) (*Task, error) {
+	body := map[string]any{}
+	if in.Title != nil {
+		body["title"] = *in.Title
+	}
+	if in.Done != nil {
+		body["done"] = *in.Done
+	}
+	if in.Priority != nil {
+		body["priority"] = *in.Priority
+	}
+	if in.DueAt != nil {
+		body["due_at"] = in.DueAt.Format(time.RFC3339)
+	} else if in.ClearDueAt {
+		body["due_at"] = ""
+	}
+	if in.Reminder != nil {
+		body["reminder"] = in.Reminder
+	}
+	var t Task
+	return &t, c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/tasks/%d", id), nil, body, &t)
+}
+
+func (c *Client) DeleteTask(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/tasks/%d", id), nil, nil, nil)
+}
+
+func (c *Client) SearchTasks(ctx context.Context, query string, limit int) ([]Task, error) {
+	q := url.Values{"q": {query}}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var out []Task
+	return out, c.do(ctx, http.MethodGet, "/api/tasks/search", q, nil, &out)
+}
+
+func (c *Client) RecentTasks(ctx context.Context, limit int) ([]Task, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var out []Task
+	return out, c.do(ctx, http.MethodGet, "/api/tasks/recent", q, nil, &out)
+}
+
+// ExportTasks escribe en w la exportación (format "json" o "markdown").
+// filters admite done y priority, como en el API.
+func (c *Client) ExportTasks(ctx context.Context, w io.Writer, format string, filters url.Values) error {
+	q := url.Values{"format": {format}}
+	for k, v := range filters {
+		q[k] = v
+	}
+	return c.do(ctx, http.MethodGet, "/api/tasks/export", q, nil, w)
+}
+
+// ImportTasks sube el fichero (format "json" o "todoist") y devuelve la
+// importación en curso; su avance se consulta con GetImport.
+func (c *Client) ImportTasks(ctx context.Context, format string, file io.Reader) (*Import, error) {
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	var imp Import
+	return &imp, c.doRaw(ctx, http.MethodPost, "/api/tasks/import", url.Values{"format": {format}}, raw, &imp)
+}
+
+func (c *Client) GetImport(ctx context.Context, id uint) (*Import, error) {
+	var imp Import
+	return &imp, c.do(ctx, http.MethodGet, fmt.Sprintf("/api/imports/%d", id), nil, nil, &imp)
+}
+
+// CancelImport pide parar la importación; lo ya importado se queda.
+func (c *Client) CancelImport(ctx context.Context, id uint) (*Import, error) {
+	var imp Import
+	return &imp, c.do(ctx, http.MethodPost, fmt.Sprintf("/api/imports/%d/cancel", id), nil, nil, &imp)
+}
+
+// --- cuenta ---
+
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	var u User
+	return &u, c.do(ctx, http.MethodGet, "/api/me", nil, nil, &u)
+}
+
+// UpdateMe acepta los campos de PATCH /api/me (search_language, email_deliverable...).
+func (c *Client) UpdateMe(ctx context.Context, fields map[string]any) (*User, error) {
+	var u User
+	return &u, c.do(ctx, http.MethodPatch, "/api/me", nil, fields, &u)
+}
+
+// UploadAvatar sube una imagen PNG, JPEG o GIF como avatar.
+func (c *Client) UploadAvatar(ctx context.Context, image io.Reader) (*User, error) {
+	body, err := io.ReadAll(image)
+	if err != nil {
+		return nil, err
+	}
+	var u User
+	return &u, c.doRaw(ctx, http.MethodPut, "/api/me/avatar", nil, body, &u)
+}
+
+func (c *Client) DeleteAvatar(ctx context.Context) (*User, error) {
+	var u User
+	return &u, c.do(ctx, http.MethodDelete, "/api/me/avatar", nil, nil, &u)
+}
+
+func (c *Client) Score(ctx context.Context) (*Score, error) {
+	var s Score
+	return &s, c.do(ctx, http.MethodGet, "/api/me/score", nil, nil, &s)
+}
+
+func (c *Client) Achievements(ctx context.Context) ([]Achievement, error) {
+	var out []Achievement
+	return out, c.do(ctx, http.MethodGet, "/api/me/achievements", nil, nil, &out)
+}
+
+// PublicProfile no necesita token.
+func (c *Client) PublicProfile(ctx context.Context, slug string) (*PublicProfile, error) {
+	var p PublicProfile
+	return &p, c.do(ctx, http.MethodGet, "/profiles/"+url.PathEscape(slug), nil, nil, &p)
+}
+
+func (c *Client) ChangePassword(ctx context.Context, current, next string) error {
+	in := map[string]string{"current_password": current, "new_password": next}
+	if err := c.do(ctx, http.MethodPost, "/api/me/password", nil, in, nil); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.email != "" {
+		c.password = next
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Client) StartPhoneVerification(ctx context.Context, phone string) error {
+	return c.do(ctx, http.MethodPost, "/api/me/phone", nil, map[string]string{"phone": phone}, nil)
+}
+
+func (c *Client) VerifyPhone(ctx context.Context, code string) error {
+	return c.do(ctx, http.MethodPost, "/api/me/phone/verify", nil, map[string]string{"code": code}, nil)
+}
+
+func (c *Client) Stats(ctx context.Context, days int) (*Stats, error) {
+	q := url.Values{}
+	if days > 0 {
+		q.Set("days", strconv.Itoa(days))
+	}
+	var s Stats
+	return &s, c.do(ctx, http.MethodGet, "/api/stats", q, nil, &s)
+}
+
+// ExportEvents escribe en w el registro de eventos en NDJSON desde el id since.
+func (c *Client) ExportEvents(ctx context.Context, w io.Writer, since uint64) error {
+	q := url.Values{"since": {strconv.FormatUint(since, 10)}}
+	return c.do(ctx, http.MethodGet, "/api/export/events.ndjson", q, nil, w)
+}
+
+// --- canales de notificación ---
+
+func (c *Client) ListChannels(ctx context.Context) ([]Channel, error) {
+	var out []Channel
+	return out, c.do(ctx, http.MethodGet, "/api/notifications/channels", nil, nil, &out)
+}
+
+func (c *Client) CreateChannel(ctx context.Context, in NewChannel) (*Channel, error) {
+	var ch Channel
+	return &ch, c.do(ctx, http.MethodPost, "/api/notifications/channels", nil, in, &ch)
+}
+
+func (c *Client) SetChannelEnabled(ctx context.Context, id uint, enabled bool) (*Channel, error) {
+	var ch Channel
+	path := fmt.Sprintf("/api/notifications/channels/%d", id)
+	return &ch, c.do(ctx, http.MethodPatch, path, nil, map[string]bool{"enabled": enabled}, &ch)
+}
+
+func (c *Client) DeleteChannel(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/notifications/channels/%d", id), nil, nil, nil)
+}
+
+// TestChannel envía un aviso de prueba; el error trae el mensaje del proveedor.
+func (c *Client) TestChannel(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/notifications/channels/%d/test", id), nil, nil, nil)
+}
+
+func (c *Client) ListIntegrations(ctx context.Context) ([]Integration, error) {
+	var out []Integration
+	return out, c.do(ctx, http.MethodGet, "/api/me/integrations", nil, nil, &out)
+}
+
+// ReconnectIntegration reactiva el canal y manda un mensaje de prueba.
+func (c *Client) ReconnectIntegration(ctx context.Context, id uint) (*Integration, error) {
+	var out Integration
+	return &out, c.do(ctx, http.MethodPost, fmt.Sprintf("/api/me/integrations/%d/reconnect", id), nil, nil, &out)
+}
+
+// Usage devuelve el uso de las cuotas de la cuenta.
+func (c *Client) Usage(ctx context.Context) (*Usage, error) {
+	var out Usage
+	return &out, c.do(ctx, http.MethodGet, "/api/me/usage", nil, nil, &out)
+}
+
+// --- paleta y búsquedas guardadas ---
+
+func (c *Client) Suggest(ctx context.Context, query string, limit int) ([]Suggestion, error) {
+	q := url.Values{"q": {query}}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var out []Suggestion
+	return out, c.do(ctx, http.MethodGet, "/api/suggest", q, nil, &out)
+}
+
+func (c *Client) ListSavedSearches(ctx context.Context) ([]SavedSearch, error) {
+	var out []SavedSearch
+	return out, c.do(ctx, http.MethodGet, "/api/searches", nil, nil, &out)
+}
+
+func (c *Client) SaveSearch(ctx context.Context, query string) (*SavedSearch, error) {
+	var s SavedSearch
+	return &s, c.do(ctx, http.MethodPost, "/api/searches", nil, map[string]string{"query": query}, &s)
+}
+
+func (c *Client) DeleteSavedSearch(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/searches/%d", id), nil, nil, nil)
+}
+
+func (c *Client) PreviewReminder(ctx context.Context, taskID uint) (*ReminderPreview, error) {
+	var p ReminderPreview
+	return &p, c.do(ctx, http.MethodGet, fmt.Sprintf("/api/tasks/%d/reminders/preview", taskID), nil, nil, &p)
+}
+
+func (c *Client) ListViewPresets(ctx context.Context) ([]ViewPreset, error) {
+	var out []ViewPreset
+	return out, c.do(ctx, http.MethodGet, "/api/view-presets", nil, nil, &out)
+}
+
+func (c *Client) GetViewPreset(ctx context.Context, id uint) (*ViewPreset, error) {
+	var p ViewPreset
+	return &p, c.do(ctx, http.MethodGet, fmt.Sprintf("/api/view-presets/%d", id), nil, nil, &p)
+}
+
+func (c *Client) CreateViewPreset(ctx context.Context, p ViewPreset) (*ViewPreset, error) {
+	var out ViewPreset
+	return &out, c.do(ctx, http.MethodPost, "/api/view-presets", nil, p, &out)
+}
+
+// UpdateViewPreset manda solo los campos de fields (name, columns, sort,
+// order, group_by, is_default).
+func (c *Client) UpdateViewPreset(ctx context.Context, id uint, fields map[string]any) (*ViewPreset, error) {
+	var out ViewPreset
+	return &out, c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/view-presets/%d", id), nil, fields, &out)
+}
+
+func (c *Client) DeleteViewPreset(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/view-presets/%d", id), nil, nil, nil)
+}
+
+// --- hábitos ---
+
+func (c *Client) ListHabits(ctx context.Context, archived bool) ([]Habit, error) {
+	var out []Habit
+	q := url.Values{}
+	if archived {
+		q.Set("archived", "true")
+	}
+	return out, c.do(ctx, http.MethodGet, "/api/habits", q, nil, &out)
+}
+
+// CreateHabit crea un hábito; targetPerWeek 7 es diario.
+func (c *Client) CreateHabit(ctx context.Context, name string, targetPerWeek int) (*Habit, error) {
+	var h Habit
+	in := map[string]any{"name": name, "target_per_week": targetPerWeek}
+	return &h, c.do(ctx, http.MethodPost, "/api/habits", nil, in, &h)
+}
+
+// UpdateHabit manda solo los campos de fields (name, target_per_week, archived).
+func (c *Client) UpdateHabit(ctx context.Context, id uint, fields map[string]any) (*Habit, error) {
+	var h Habit
+	return &h, c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/habits/%d", id), nil, fields, &h)
+}
+
+func (c *Client) DeleteHabit(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/habits/%d", id), nil, nil, nil)
+}
+
+// CheckinHabit marca (o salta, con skipped) un día; day "" es hoy.
+func (c *Client) CheckinHabit(ctx context.Context, id uint, day string, skipped bool) (*Habit, error) {
+	var h Habit
+	in := map[string]any{"skipped": skipped}
+	if day != "" {
+		in["day"] = day
+	}
+	return &h, c.do(ctx, http.MethodPost, fmt.Sprintf("/api/habits/%d/checkins", id), nil, in, &h)
+}
+
+func (c *Client) UncheckHabit(ctx context.Context, id uint, day string) (*Habit, error) {
+	var h Habit
+	return &h, c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/habits/%d/checkins/%s", id, day), nil, nil, &h)
+}
+
+func (c *Client) Today(ctx context.Context) (*Today, error) {
+	var t Today
+	return &t, c.do(ctx, http.MethodGet, "/api/today", nil, nil, &t)
+}
+
+func (c *Client) Focus(ctx context.Context) (*Focus, error) {
+	var f Focus
+	return &f, c.do(ctx, http.MethodGet, "/api/focus", nil, nil, &f)
+}
+
+// AddFocus añade la tarea a Mi día o acepta su propuesta.
+func (c *Client) AddFocus(ctx context.Context, taskID uint) (*Focus, error) {
+	var f Focus
+	return &f, c.do(ctx, http.MethodPost, "/api/focus", nil, map[string]uint{"task_id": taskID}, &f)
+}
+
+func (c *Client) RemoveFocus(ctx context.Context, taskID uint) (*Focus, error) {
+	var f Focus
+	return &f, c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/focus/%d", taskID), nil, nil, &f)
+}
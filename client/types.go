@@ -0,0 +1,271 @@
+package client
+
+import "time"
+
+type Task struct {
+	ID          uint          `json:"id"`
+	UserID      uint          `json:"user_id"`
+	Title       string        `json:"title"`
+	Done        bool          `json:"done"`
+	Priority    string        `json:"priority"`
+	DueAt       *time.Time    `json:"due_at,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+	Reminder    *ReminderMeta `json:"reminder,omitempty"`
+}
+
+// ReminderMeta viaja con el aviso de la tarea para que la app elija cómo
+// mostrarlo. Label sustituye al título "Recordatorio".
+type ReminderMeta struct {
+	Label    string `json:"label,omitempty"`
+	Category string `json:"category,omitempty"`
+	Sound    string `json:"sound,omitempty"`
+}
+
+// NewTask es el cuerpo de CreateTask. Priority vacío = "normal".
+type NewTask struct {
+	Title    string        `json:"title"`
+	Priority string        `json:"priority,omitempty"`
+	DueAt    *time.Time    `json:"due_at,omitempty"`
+	Reminder *ReminderMeta `json:"reminder,omitempty"`
+}
+
+// TaskUpdate solo envía los campos no nil. ClearDueAt quita la fecha y un
+// Reminder vacío (&ReminderMeta{}), los metadatos del aviso.
+type TaskUpdate struct {
+	Title      *string
+	Done       *bool
+	Priority   *string
+	DueAt      *time.Time
+	ClearDueAt bool
+	Reminder   *ReminderMeta
+}
+
+type User struct {
+	ID             uint       `json:"id"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	IsDemo         bool       `json:"is_demo,omitempty"`
+	Phone          string     `json:"phone,omitempty"`
+	PhoneVerified  bool       `json:"phone_verified"`
+	SearchLanguage string     `json:"search_language"`
+	Timezone       string     `json:"timezone"`
+	ListPrefs      ListPrefs  `json:"list_prefs"`
+	AvatarURL      string     `json:"avatar_url,omitempty"`
+	PublicSlug     string     `json:"public_slug,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeactivatedAt  *time.Time `json:"deactivated_at,omitempty"`
+	LegalHoldAt    *time.Time `json:"legal_hold_at,omitempty"`
+
+	EmailUndeliverableAt   *time.Time `json:"email_undeliverable_at,omitempty"`
+	EmailSuppressionReason string     `json:"email_suppression_reason,omitempty"`
+}
+
+// ListPrefs es cómo sale ListTasks cuando no se pasan opciones.
+type ListPrefs struct {
+	Sort          string `json:"sort,omitempty"`
+	Order         string `json:"order,omitempty"`
+	ShowCompleted *bool  `json:"show_completed,omitempty"`
+	TasksPerPage  int    `json:"tasks_per_page,omitempty"`
+}
+
+// Score es la puntuación de GET /api/me/score (con GAMIFICATION_ENABLED).
+type Score struct {
+	Level       int `json:"level"`
+	NextLevelAt int `json:"next_level_at"`
+	Stats       struct {
+		Points       int `json:"points"`
+		Completed    int `json:"completed"`
+		OnTime       int `json:"on_time"`
+		HighPriority int `json:"high_priority"`
+		Streak       int `json:"streak"`
+	} `json:"stats"`
+}
+
+type Achievement struct {
+	Code        string     `json:"code"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"`
+}
+
+// PublicProfile es lo que cualquiera ve en /profiles/:slug.
+type PublicProfile struct {
+	Slug           string `json:"slug"`
+	AvatarURL      string `json:"avatar_url,omitempty"`
+	MemberSince    string `json:"member_since"`
+	CurrentStreak  int    `json:"current_streak"`
+	LongestStreak  int    `json:"longest_streak"`
+	Completed7d    int    `json:"completed_7d"`
+	Completed30d   int    `json:"completed_30d"`
+	CompletedTotal int    `json:"completed_total"`
+	PerWeek        []struct {
+		Week      string `json:"week"`
+		Completed int    `json:"completed"`
+	} `json:"per_week"`
+}
+
+type Channel struct {
+	ID         uint      `json:"id"`
+	Kind       string    `json:"kind"`
+	WebhookURL string    `json:"webhook_url,omitempty"`
+	ServerURL  string    `json:"server_url,omitempty"`
+	RoomID     string    `json:"room_id,omitempty"`
+	Topic      string    `json:"topic,omitempty"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Integration es el estado de un canal en GET /api/me/integrations.
+type Integration struct {
+	ID            uint       `json:"id"`
+	Kind          string     `json:"kind"`
+	Enabled       bool       `json:"enabled"`
+	Status        string     `json:"status"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	RecentErrors  int        `json:"recent_errors"`
+}
+
+// QuotaUsage es el uso de una cuota; Limit 0 es sin límite.
+type QuotaUsage struct {
+	Used      int64  `json:"used"`
+	Limit     int64  `json:"limit"`
+	Remaining *int64 `json:"remaining,omitempty"`
+	Percent   int    `json:"percent"`
+	Period    string `json:"period,omitempty"`
+}
+
+type Usage struct {
+	Tasks QuotaUsage `json:"tasks"`
+	SMS   QuotaUsage `json:"sms"`
+	// Storage va en bytes.
+	Storage QuotaUsage `json:"storage"`
+}
+
+// NewChannel es el cuerpo de CreateChannel; qué campos hacen falta depende de Kind.
+type NewChannel struct {
+	Kind        string `json:"kind"`
+	WebhookURL  string `json:"webhook_url,omitempty"`
+	ServerURL   string `json:"server_url,omitempty"`
+	RoomID      string `json:"room_id,omitempty"`
+	Topic       string `json:"topic,omitempty"`
+	AccessToken string `json:"access_token,omitempty"`
+}
+
+type SavedSearch struct {
+	ID        uint      `json:"id"`
+	Query     string    `json:"query"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReminderPreview dice cuándo y por dónde saldría el recordatorio de una tarea.
+type ReminderPreview struct {
+	TaskID       uint          `json:"task_id"`
+	WillFire     bool          `json:"will_fire"`
+	Reason       string        `json:"reason,omitempty"`
+	FiresAt      *time.Time    `json:"fires_at,omitempty"`
+	FiresAtLocal string        `json:"fires_at_local,omitempty"`
+	Timezone     string        `json:"timezone"`
+	Scheduler    string        `json:"scheduler"`
+	Queued       *bool         `json:"queued,omitempty"`
+	Title        string        `json:"title"`
+	Reminder     *ReminderMeta `json:"reminder,omitempty"`
+	Channels     []struct {
+		ID      uint   `json:"id"`
+		Kind    string `json:"kind"`
+		Deliver bool   `json:"deliver"`
+		Reason  string `json:"reason,omitempty"`
+	} `json:"channels"`
+	Digest struct {
+		MaxPerHour        int  `json:"max_per_hour"`
+		RemindersSameHour int  `json:"reminders_same_hour"`
+		MayBeDeferred     bool `json:"may_be_deferred"`
+	} `json:"digest"`
+}
+
+// ViewPreset es cómo se pinta una lista: columnas, orden y agrupación.
+type ViewPreset struct {
+	ID        uint      `json:"id,omitempty"`
+	Name      string    `json:"name"`
+	Columns   []string  `json:"columns,omitempty"`
+	Sort      string    `json:"sort,omitempty"`
+	Order     string    `json:"order,omitempty"`
+	GroupBy   string    `json:"group_by,omitempty"`
+	IsDefault bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+type Suggestion struct {
+	Type  string `json:"type"`
+	ID    uint   `json:"id,omitempty"`
+	Label string `json:"label"`
+	Hint  string `json:"hint,omitempty"`
+}
+
+type Import struct {
+	ID         uint       `json:"id"`
+	Source     string     `json:"source"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Imported   int        `json:"imported"`
+	Skipped    int        `json:"skipped"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type Stats struct {
+	Summary struct {
+		Total        int        `json:"total"`
+		Done         int        `json:"done"`
+		Completed7d  int        `json:"completed_7d"`
+		Completed30d int        `json:"completed_30d"`
+		Overdue      int        `json:"overdue"`
+		OldestDueAt  *time.Time `json:"oldest_due_at,omitempty"`
+		RefreshedAt  *time.Time `json:"refreshed_at,omitempty"`
+	} `json:"summary"`
+	PerDay []struct {
+		Day       string `json:"day"`
+		Created   int    `json:"created"`
+		Completed int    `json:"completed"`
+	} `json:"per_day"`
+	Habits []Habit `json:"habits"`
+}
+
+type Habit struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	TargetPerWeek int        `json:"target_per_week"`
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+	StreakWeeks   int        `json:"streak_weeks"`
+	ThisWeek      int        `json:"this_week"`
+	Today         string     `json:"today"` // "done", "skipped" o ""
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// FocusEntry es una tarea de Mi día. Suggested son las propuestas de la
+// mañana que aún no se han aceptado.
+type FocusEntry struct {
+	Task
+	Suggested bool   `json:"suggested"`
+	Reason    string `json:"reason,omitempty"` // "carryover" o "due"
+}
+
+type Focus struct {
+	Date  string       `json:"date"`
+	Tasks []FocusEntry `json:"tasks"`
+}
+
+// Today es lo de GET /api/today.
+type Today struct {
+	Date     string       `json:"date"`
+	Timezone string       `json:"timezone"`
+	Focus    []FocusEntry `json:"focus"`
+	Tasks    []Task       `json:"tasks"`
+	Habits   []Habit      `json:"habits"`
+}
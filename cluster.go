@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========= CLUSTER MODE =========
+//
+// Todo el estado que no es caché vive detrás de una interfaz con dos
+// implementaciones: memoria (una sola réplica) y Postgres (STATE_BACKEND).
+//   - recordatorios:        ReminderScheduler (timers / cola de trabajos)
+//   - backoff de login:     loginLimiter
+//   - límite de cuentas demo: rateLimiter
+//   - cupo de avisos por usuario: rateLimiter
+//
+// Lo que queda en memoria es seguro con varias réplicas: la caché de
+// HaveIBeenPwned (solo caché), el buffer de vistas recientes (se vuelca a
+// Postgres cada 5s) y los scripts (se cargan igual en cada réplica).
+//
+// Con CLUSTER_MODE=true STATE_BACKEND pasa a ser postgres por defecto y el
+// arranque falla si algo sigue configurado solo en memoria o en disco local.
+
+const (
+	StateMemory   = "memory"
+	StatePostgres = "postgres"
+)
+
+var (
+	clusterMode  = getEnv("CLUSTER_MODE", "false") == "true"
+	stateBackend = defaultStateBackend()
+)
+
+func defaultStateBackend() string {
+	if clusterMode {
+		return getEnv("STATE_BACKEND", StatePostgres)
+	}
+	return getEnv("STATE_BACKEND", StateMemory)
+}
+
+// checkClusterSafe se llama al arrancar, con los backends ya elegidos.
+func checkClusterSafe() error {
+	if stateBackend != StateMemory && stateBackend != StatePostgres {
+		return fmt.Errorf("STATE_BACKEND desconocido: %s", stateBackend)
+	}
+	if !clusterMode {
+		return nil
+	}
+	var problems []string
+	if stateBackend == StateMemory {
+		problems = append(problems, "STATE_BACKEND=memory (recordatorios, backoff de login y límite demo no se comparten)")
+	}
+	if _, ok := blobStore.(*localBlobStore); ok && getEnv("BLOB_DIR_SHARED", "false") != "true" {
+		problems = append(problems, "BLOB_BACKEND=local (usa s3/gcs, o BLOB_DIR_SHARED=true si BLOB_DIR es un volumen compartido)")
+	}
+	if len(problems) > 0 {
+		return errors.New("CLUSTER_MODE=true no admite: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// --- backoff de login en Postgres ---
+
+type LoginFailure struct {
+	Email     string    `gorm:"primaryKey"`
+	Count     int       `gorm:"not null"`
+	Until     time.Time `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"index"`
+}
+
+type pgLoginBackoff struct {
+	db   *gorm.DB
+	free int
+	base time.Duration
+	max  time.Duration
+}
+
+func (b *pgLoginBackoff) blockedFor(email string) time.Duration {
+	var f LoginFailure
+	if err := b.db.Where("email = ?", email).Take(&f).Error; err != nil {
+		return 0
+	}
+	return max(time.Until(f.Until), 0)
+}
+
+func (b *pgLoginBackoff) fail(email string) {
+	// Un 1% de las veces se limpian los emails sin fallos en el último día.
+	if rand.IntN(100) == 0 {
+		b.db.Where("updated_at < ?", time.Now().Add(-24*time.Hour)).Delete(&LoginFailure{})
+	}
+	f := LoginFailure{Email: email, Count: 1, UpdatedAt: time.Now()}
+	err := b.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email"}},
+		DoUpdates: clause.Assignments(map[string]any{"count": gorm.Expr("login_failures.count + 1"), "updated_at": f.UpdatedAt}),
+	}, clause.Returning{Columns: []clause.Column{{Name: "count"}}}).Create(&f).Error
+	if err != nil {
+		return
+	}
+	if wait := backoffWait(f.Count, b.free, b.base, b.max); wait > 0 {
+		b.db.Model(&LoginFailure{}).Where("email = ?", email).Update("until", time.Now().Add(wait))
+	}
+}
+
+func (b *pgLoginBackoff) succeed(email string) {
+	b.db.Where("email = ?", email).Delete(&LoginFailure{})
+}
+
+// --- límite por ventana fija en Postgres ---
+
+type RateWindow struct {
+	Key         string    `gorm:"primaryKey"`
+	WindowStart time.Time `gorm:"primaryKey"`
+	Count       int       `gorm:"not null"`
+}
+
+type pgRateLimiter struct {
+	db     *gorm.DB
+	prefix string
+	max    int
+	window time.Duration
+}
+
+func (l *pgRateLimiter) allow(key string) bool {
+	start := time.Now().Truncate(l.window)
+	w := RateWindow{Key: l.prefix + key, WindowStart: start, Count: 1}
+	err := l.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}, {Name: "window_start"}},
+		DoUpdates: clause.Assignments(map[string]any{"count": gorm.Expr("rate_windows.count + 1")}),
+	}, clause.Returning{Columns: []clause.Column{{Name: "count"}}}).Create(&w).Error
+	if err != nil {
+		// Si la BD falla tampoco se podrá crear la cuenta; mejor no bloquear.
+		return true
+	}
+	if rand.IntN(100) == 0 {
+		l.db.Where("window_start < ?", start.Add(-l.window)).Delete(&RateWindow{})
+	}
+	return w.Count <= l.max
+}
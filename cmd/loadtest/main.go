@@ -0,0 +1,250 @@
+// loadtest lanza carga contra una instancia de TaskFlow y comprueba un
+// presupuesto de latencia. Uso:
+//
+//	go run ./cmd/loadtest -url http://localhost:8080 -users 20 -tasks 500 -duration 30s -rate 200 -p95 150ms
+//
+// Primero crea -users cuentas con -tasks tareas cada una (los tamaños de datos
+// importan: el listado con 5 tareas no dice nada). Después reparte -rate
+// peticiones por segundo entre listar, buscar, ver, crear y actualizar tareas
+// durante -duration. Sale con código 1 si el p95 de algún endpoint supera
+// -p95 o si la tasa de errores supera -max-errors.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type account struct {
+	token   string
+	taskIDs []uint
+}
+
+type sample struct {
+	endpoint string
+	latency  time.Duration
+	failed   bool
+}
+
+var (
+	baseURL   = flag.String("url", "http://localhost:8080", "URL base del API")
+	users     = flag.Int("users", 10, "cuentas a sembrar")
+	tasks     = flag.Int("tasks", 200, "tareas por cuenta")
+	duration  = flag.Duration("duration", 30*time.Second, "duración de la fase de carga")
+	rate      = flag.Int("rate", 100, "peticiones por segundo")
+	workers   = flag.Int("workers", 50, "peticiones concurrentes máximas")
+	p95Budget = flag.Duration("p95", 200*time.Millisecond, "p95 máximo por endpoint")
+	maxErrors = flag.Float64("max-errors", 0.01, "tasa de errores máxima (0-1)")
+
+	client = &http.Client{Timeout: 10 * time.Second}
+)
+
+func main() {
+	flag.Parse()
+	log.SetFlags(0)
+	if *users < 1 || *tasks < 1 || *rate < 1 || *workers < 1 {
+		log.Fatal("-users, -tasks, -rate y -workers deben ser >= 1")
+	}
+
+	log.Printf("sembrando %d cuentas x %d tareas...", *users, *tasks)
+	accounts := seed()
+
+	log.Printf("carga: %d req/s durante %s", *rate, *duration)
+	samples := run(accounts)
+
+	if !report(samples) {
+		os.Exit(1)
+	}
+}
+
+func seed() []*account {
+	run := time.Now().UnixNano()
+	accounts := make([]*account, *users)
+	var wg sync.WaitGroup
+	for i := range accounts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			email := fmt.Sprintf("loadtest-%d-%d@example.com", run, i)
+			creds := map[string]string{"email": email, "password": "loadtest-" + fmt.Sprint(run)}
+			if _, err := call("POST", "/auth/register", "", creds, nil); err != nil {
+				log.Fatalf("registro: %v", err)
+			}
+			var tok struct {
+				Token string `json:"token"`
+			}
+			if _, err := call("POST", "/auth/login", "", creds, &tok); err != nil {
+				log.Fatalf("login: %v", err)
+			}
+			a := &account{token: tok.Token}
+			for j := 0; j < *tasks; j++ {
+				var t struct {
+					ID uint `json:"id"`
+				}
+				body := map[string]any{"title": randomTitle(), "priority": []string{"low", "normal", "high"}[j%3]}
+				if j%4 == 0 {
+					body["due_at"] = time.Now().Add(time.Duration(rand.IntN(30*24)) * time.Hour).Format(time.RFC3339)
+				}
+				if _, err := call("POST", "/api/tasks", a.token, body, &t); err != nil {
+					log.Fatalf("sembrando tareas: %v", err)
+				}
+				a.taskIDs = append(a.taskIDs, t.ID)
+			}
+			accounts[i] = a
+		}(i)
+	}
+	wg.Wait()
+	return accounts
+}
+
+// run dispara peticiones a ritmo constante; si el servidor no da abasto las
+// peticiones esperan un worker libre en vez de acumularse sin límite.
+func run(accounts []*account) []sample {
+	var (
+		mu      sync.Mutex
+		samples []sample
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, *workers)
+	)
+	tick := time.NewTicker(time.Second / time.Duration(*rate))
+	defer tick.Stop()
+	deadline := time.After(*duration)
+	for {
+		select {
+		case <-deadline:
+			wg.Wait()
+			return samples
+		case <-tick.C:
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				s := hit(accounts[rand.IntN(len(accounts))])
+				mu.Lock()
+				samples = append(samples, s)
+				mu.Unlock()
+			}()
+		}
+	}
+}
+
+// hit elige un endpoint con un reparto parecido al uso real: sobre todo lecturas.
+func hit(a *account) sample {
+	id := a.taskIDs[rand.IntN(len(a.taskIDs))]
+	var endpoint, method, path string
+	var body any
+	switch n := rand.IntN(100); {
+	case n < 40:
+		endpoint, method, path = "GET /api/tasks", "GET", "/api/tasks?sort=updated_at"
+	case n < 60:
+		endpoint, method, path = "GET /api/tasks/:id", "GET", fmt.Sprintf("/api/tasks/%d", id)
+	case n < 75:
+		endpoint, method, path = "GET /api/tasks/search", "GET", "/api/tasks/search?q="+words[rand.IntN(len(words))][:3]
+	case n < 85:
+		endpoint, method, path = "POST /api/tasks", "POST", "/api/tasks"
+		body = map[string]any{"title": randomTitle()}
+	default:
+		endpoint, method, path = "PATCH /api/tasks/:id", "PATCH", fmt.Sprintf("/api/tasks/%d", id)
+		body = map[string]any{"done": rand.IntN(2) == 0}
+	}
+	start := time.Now()
+	_, err := call(method, path, a.token, body, nil)
+	return sample{endpoint: endpoint, latency: time.Since(start), failed: err != nil}
+}
+
+func report(samples []sample) bool {
+	by := map[string][]time.Duration{}
+	failed := map[string]int{}
+	totalFailed := 0
+	for _, s := range samples {
+		by[s.endpoint] = append(by[s.endpoint], s.latency)
+		if s.failed {
+			failed[s.endpoint]++
+			totalFailed++
+		}
+	}
+	names := make([]string, 0, len(by))
+	for n := range by {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	ok := true
+	fmt.Printf("\n%-24s %7s %7s %9s %9s %9s\n", "endpoint", "n", "errores", "p50", "p95", "p99")
+	for _, n := range names {
+		l := by[n]
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		p95 := pct(l, 95)
+		mark := ""
+		if p95 > *p95Budget {
+			mark, ok = "  <- supera el presupuesto", false
+		}
+		fmt.Printf("%-24s %7d %7d %9s %9s %9s%s\n", n, len(l), failed[n],
+			pct(l, 50).Round(time.Millisecond/10), p95.Round(time.Millisecond/10), pct(l, 99).Round(time.Millisecond/10), mark)
+	}
+	errRate := float64(totalFailed) / float64(max(len(samples), 1))
+	fmt.Printf("\n%d peticiones, %.2f%% errores (máx %.2f%%), p95 máx %s\n", len(samples), errRate*100, *maxErrors*100, *p95Budget)
+	if errRate > *maxErrors {
+		ok = false
+	}
+	if !ok {
+		fmt.Println("FALLO: presupuesto de rendimiento superado")
+	}
+	return ok
+}
+
+func pct(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+func call(method, path, token string, body, out any) (int, error) {
+	var r io.Reader
+	if body != nil {
+		raw, _ := json.Marshal(body)
+		r = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(*baseURL, "/")+path, r)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s %s: %d %s", method, path, resp.StatusCode, msg)
+	}
+	if out != nil {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+var words = []string{"factura", "reunión", "café", "informe", "llamar", "revisar", "comprar", "enviar", "preparar", "diseño"}
+
+func randomTitle() string {
+	return words[rand.IntN(len(words))] + " " + words[rand.IntN(len(words))] + " " + fmt.Sprint(rand.IntN(1000))
+}
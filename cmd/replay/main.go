@@ -0,0 +1,275 @@
+// replay reproduce una grabación de REQUEST_RECORD_FILE contra otra instancia
+// (staging) y compara las respuestas con las grabadas. Uso:
+//
+//	go run ./cmd/replay -file requests.ndjson -url http://staging:8080
+//
+// Cada usuario grabado se convierte en una cuenta nueva en el destino. Los ids
+// cambian de una base de datos a otra, así que replay va aprendiendo la
+// correspondencia (el "id" de cada respuesta grabada frente al de la real) y
+// reescribe las rutas (/api/tasks/17 -> /api/tasks/203) y los ids en las
+// respuestas antes de compararlas.
+//
+// Se comparan el código de estado y el JSON, sin los campos de -ignore
+// (marcas de tiempo, emails...). Las búsquedas solo comparan el estado: los
+// títulos están anonimizados y no encuentran lo mismo. Sale con código 1 si
+// alguna respuesta difiere.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type recordedRequest struct {
+	User     string          `json:"user"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Query    string          `json:"query"`
+	Body     json.RawMessage `json:"body"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+var (
+	file      = flag.String("file", "requests.ndjson", "grabación (NDJSON)")
+	baseURL   = flag.String("url", "http://localhost:8080", "instancia destino")
+	ignore    = flag.String("ignore", "user_id,created_at,updated_at,completed_at,viewed_at,email,deactivated_at,refreshed_at,snapshot_at", "campos que no se comparan")
+	maxDiffs  = flag.Int("show", 20, "diferencias a imprimir")
+	statusFor = flag.String("status-only", "/api/tasks/search,/api/suggest", "rutas en las que solo se compara el estado")
+
+	client = &http.Client{Timeout: 30 * time.Second}
+)
+
+func main() {
+	flag.Parse()
+	log.SetFlags(0)
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	ignored := map[string]bool{}
+	for _, k := range strings.Split(*ignore, ",") {
+		ignored[strings.TrimSpace(k)] = true
+	}
+	statusOnly := strings.Split(*statusFor, ",")
+
+	tokens := map[string]string{} // usuario grabado -> JWT en el destino
+	ids := map[string]string{}    // id grabado -> id en el destino
+	run := time.Now().UnixNano()
+	total, diffs := 0, 0
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1<<20), 4<<20)
+	for sc.Scan() {
+		var rec recordedRequest
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			log.Fatalf("línea %d: %v", total+1, err)
+		}
+		total++
+		tok, ok := tokens[rec.User]
+		if !ok {
+			tok, err = newAccount(fmt.Sprintf("replay-%d-%d@example.com", run, len(tokens)))
+			if err != nil {
+				log.Fatalf("creando cuenta para %s: %v", rec.User, err)
+			}
+			tokens[rec.User] = tok
+		}
+
+		path := rewritePath(rec.Path, ids)
+		if rec.Query != "" {
+			path += "?" + rec.Query
+		}
+		status, body, err := call(rec.Method, path, tok, rec.Body)
+		if err != nil {
+			log.Fatalf("%s %s: %v", rec.Method, path, err)
+		}
+		learnIDs(rec.Response, body, ids)
+
+		problem := ""
+		switch {
+		case status != rec.Status:
+			problem = fmt.Sprintf("estado %d, grabado %d", status, rec.Status)
+		case hasPrefixAny(rec.Path, statusOnly) || len(rec.Response) == 0:
+		default:
+			want, got := normalize(rec.Response, ignored, nil), normalize(body, ignored, ids)
+			if !reflect.DeepEqual(want, got) {
+				w, _ := json.Marshal(want)
+				g, _ := json.Marshal(got)
+				problem = fmt.Sprintf("respuesta distinta\n    grabada: %s\n    real:    %s", clip(w), clip(g))
+			}
+		}
+		if problem != "" {
+			diffs++
+			if diffs <= *maxDiffs {
+				fmt.Printf("DIFF %s %s: %s\n", rec.Method, rec.Path, problem)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("\n%d peticiones, %d diferencias, %d usuarios\n", total, diffs, len(tokens))
+	if diffs > 0 {
+		os.Exit(1)
+	}
+}
+
+func newAccount(email string) (string, error) {
+	creds, _ := json.Marshal(map[string]string{"email": email, "password": "replay-" + email})
+	if status, body, err := call("POST", "/auth/register", "", creds); err != nil || status != 201 {
+		return "", fmt.Errorf("registro: %d %s %v", status, body, err)
+	}
+	status, body, err := call("POST", "/auth/login", "", creds)
+	if err != nil || status != 200 {
+		return "", fmt.Errorf("login: %d %s %v", status, body, err)
+	}
+	var tok struct {
+		Token string `json:"token"`
+	}
+	return tok.Token, json.Unmarshal(body, &tok)
+}
+
+// rewritePath cambia los segmentos numéricos por su id en el destino.
+func rewritePath(path string, ids map[string]string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if _, err := strconv.ParseUint(p, 10, 64); err == nil {
+			if mapped, ok := ids[p]; ok {
+				parts[i] = mapped
+			}
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// learnIDs empareja los "id" de la respuesta grabada con los de la real,
+// recorriendo ambas a la vez (objetos y arrays en el mismo orden).
+func learnIDs(recorded, actual []byte, ids map[string]string) {
+	var a, b any
+	if json.Unmarshal(recorded, &a) != nil || json.Unmarshal(actual, &b) != nil {
+		return
+	}
+	var walk func(a, b any)
+	walk = func(a, b any) {
+		switch x := a.(type) {
+		case map[string]any:
+			y, ok := b.(map[string]any)
+			if !ok {
+				return
+			}
+			if id, ok := x["id"].(float64); ok {
+				if id2, ok := y["id"].(float64); ok {
+					ids[strconv.FormatFloat(id, 'f', -1, 64)] = strconv.FormatFloat(id2, 'f', -1, 64)
+				}
+			}
+			for k, v := range x {
+				walk(v, y[k])
+			}
+		case []any:
+			y, ok := b.([]any)
+			if !ok {
+				return
+			}
+			for i := 0; i < len(x) && i < len(y); i++ {
+				walk(x[i], y[i])
+			}
+		}
+	}
+	walk(a, b)
+}
+
+// normalize quita los campos ignorados y, si se pasa ids, traduce los ids
+// reales a los grabados para poder comparar.
+func normalize(raw []byte, ignored map[string]bool, ids map[string]string) any {
+	var v any
+	if json.Unmarshal(raw, &v) != nil {
+		return string(raw)
+	}
+	reverse := map[float64]float64{}
+	for rec, real := range ids {
+		r, _ := strconv.ParseFloat(rec, 64)
+		x, _ := strconv.ParseFloat(real, 64)
+		reverse[x] = r
+	}
+	var walk func(key string, v any) any
+	walk = func(key string, v any) any {
+		switch t := v.(type) {
+		case map[string]any:
+			for k, val := range t {
+				if ignored[k] {
+					delete(t, k)
+					continue
+				}
+				t[k] = walk(k, val)
+			}
+			return t
+		case []any:
+			for i := range t {
+				t[i] = walk(key, t[i])
+			}
+			return t
+		case float64:
+			if ids != nil && (key == "id" || strings.HasSuffix(key, "_id")) {
+				if r, ok := reverse[t]; ok {
+					return r
+				}
+			}
+		}
+		return v
+	}
+	return walk("", v)
+}
+
+func call(method, path, token string, body []byte) (int, []byte, error) {
+	var r io.Reader
+	if len(body) > 0 {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(*baseURL, "/")+path, r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, out, err
+}
+
+func hasPrefixAny(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if p != "" && strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func clip(b []byte) string {
+	if len(b) > 300 {
+		return string(b[:300]) + "…"
+	}
+	return string(b)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+// ========= COMPROBACIÓN DE CONSISTENCIA =========
+//
+// El trabajo "consistency.check" compara lo derivado con las tablas de origen:
+//   - search_indexes: los índices de búsqueda existen y son válidos (un
+//     CREATE INDEX CONCURRENTLY cortado los deja inválidos). Los vectores FTS
+//     se calculan al vuelo, así que basta con el índice.
+//   - completed_at: las tareas hechas tienen completed_at y las pendientes no.
+//   - stats_*: las vistas materializadas cuadran con tasks.
+//   - imports: las terminadas cuadran (procesadas = total = importadas + omitidas).
+//
+// Con repair arregla lo que se puede arreglar (reencola search.reindex,
+// rellena completed_at, refresca las vistas). Corre cada
+// CONSISTENCY_CHECK_HOURS (24; 0 lo desactiva) y a petición desde /admin. El
+// último informe se guarda en el ajuste "consistency.last_report" y las
+// diferencias salen en la métrica taskflow_consistency_discrepancies.
+
+const settingConsistencyReport = "consistency.last_report"
+
+var consistencyDiscrepancies = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "taskflow_consistency_discrepancies",
+	Help: "Filas que no cuadraban en la última comprobación de consistencia, por comprobación.",
+}, []string{"check"})
+
+type consistencyResult struct {
+	Check    string `json:"check"`
+	Found    int64  `json:"found"`
+	Repaired bool   `json:"repaired"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type consistencyReport struct {
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt time.Time           `json:"finished_at"`
+	Repair     bool                `json:"repair"`
+	Results    []consistencyResult `json:"results"`
+}
+
+type consistencyCheck struct {
+	name   string
+	count  func(ctx context.Context, db *gorm.DB) (int64, string, error)
+	repair func(ctx context.Context, db *gorm.DB) error
+}
+
+var consistencyChecks = []consistencyCheck{
+	{
+		name: "search_indexes",
+		count: func(ctx context.Context, db *gorm.DB) (int64, string, error) {
+			var valid int64
+			err := db.WithContext(ctx).Raw(`SELECT count(*) FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+				WHERE c.relname IN ? AND i.indisvalid`, searchIndexes).Scan(&valid).Error
+			return int64(len(searchIndexes)) - valid, "índices ausentes o inválidos", err
+		},
+		repair: func(_ context.Context, db *gorm.DB) error {
+			_, err := enqueueJob(db, "search.reindex", nil)
+			return err
+		},
+	},
+	{
+		name: "completed_at",
+		count: func(ctx context.Context, db *gorm.DB) (int64, string, error) {
+			var n int64
+			err := db.WithContext(ctx).Model(&Task{}).
+				Where("(done AND completed_at IS NULL) OR (NOT done AND completed_at IS NOT NULL)").Count(&n).Error
+			return n, "tareas con completed_at que no cuadra con done", err
+		},
+		repair: func(ctx context.Context, db *gorm.DB) error {
+			conn := db.WithContext(ctx)
+			if err := conn.Exec(`UPDATE tasks SET completed_at = updated_at WHERE done AND completed_at IS NULL`).Error; err != nil {
+				return err
+			}
+			return conn.Exec(`UPDATE tasks SET completed_at = NULL WHERE NOT done AND completed_at IS NOT NULL`).Error
+		},
+	},
+	{
+		name: "stats_user_completions",
+		count: func(ctx context.Context, db *gorm.DB) (int64, string, error) {
+			var n int64
+			err := db.WithContext(ctx).Raw(`SELECT count(*) FROM (
+					SELECT user_id, count(*)::int AS total, count(*) FILTER (WHERE done)::int AS done FROM tasks GROUP BY user_id
+				) t FULL JOIN stats_user_completions s USING (user_id)
+				WHERE t.total IS DISTINCT FROM s.total OR t.done IS DISTINCT FROM s.done`).Scan(&n).Error
+			return n, "usuarios con totales desfasados", err
+		},
+		repair: refreshStatsJobRepair,
+	},
+	{
+		name: "stats_tasks_per_day",
+		count: func(ctx context.Context, db *gorm.DB) (int64, string, error) {
+			var n int64
+			err := db.WithContext(ctx).Raw(`SELECT count(*) FROM (
+					SELECT user_id, count(*)::int AS created, count(completed_at)::int AS completed FROM tasks GROUP BY user_id
+				) t FULL JOIN (
+					SELECT user_id, sum(created)::int AS created, sum(completed)::int AS completed FROM stats_tasks_per_day GROUP BY user_id
+				) s USING (user_id)
+				WHERE t.created IS DISTINCT FROM s.created OR t.completed IS DISTINCT FROM s.completed`).Scan(&n).Error
+			return n, "usuarios con la serie diaria desfasada", err
+		},
+		repair: refreshStatsJobRepair,
+	},
+	{
+		name: "imports",
+		count: func(ctx context.Context, db *gorm.DB) (int64, string, error) {
+			var n int64
+			err := db.WithContext(ctx).Model(&Import{}).
+				Where("status = ? AND (processed <> total OR imported + skipped <> processed)", ImportDone).Count(&n).Error
+			return n, "importaciones terminadas con contadores que no suman (solo se informa)", err
+		},
+	},
+}
+
+func refreshStatsJobRepair(ctx context.Context, db *gorm.DB) error {
+	return refreshStatsJob(ctx, db, Job{})
+}
+
+func runConsistencyCheck(ctx context.Context, db *gorm.DB, repair bool) consistencyReport {
+	r := consistencyReport{StartedAt: time.Now(), Repair: repair}
+	refreshed := false
+	for _, chk := range consistencyChecks {
+		res := consistencyResult{Check: chk.name}
+		n, detail, err := chk.count(ctx, db)
+		res.Found, res.Detail = n, detail
+		if err != nil {
+			res.Error = err.Error()
+		} else if n > 0 && repair && chk.repair != nil {
+			// Las dos vistas de stats se arreglan con el mismo refresco.
+			isStats := chk.name == "stats_user_completions" || chk.name == "stats_tasks_per_day"
+			if isStats && refreshed {
+				res.Repaired = true
+			} else if err := chk.repair(ctx, db); err != nil {
+				res.Error = "repair: " + err.Error()
+			} else {
+				res.Repaired = true
+				refreshed = refreshed || isStats
+			}
+		}
+		if n > 0 {
+			log.Printf("[CONSISTENCY] %s: %d (%s) reparado=%v", chk.name, n, detail, res.Repaired)
+		}
+		consistencyDiscrepancies.WithLabelValues(chk.name).Set(float64(n))
+		r.Results = append(r.Results, res)
+	}
+	r.FinishedAt = time.Now()
+	return r
+}
+
+type consistencyPayload struct {
+	Repair bool `json:"repair"`
+}
+
+func consistencyJob(ctx context.Context, db *gorm.DB, j Job) error {
+	var p consistencyPayload
+	if err := json.Unmarshal([]byte(j.Payload), &p); err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	return putSetting(db, settingConsistencyReport, runConsistencyCheck(ctx, db, p.Repair))
+}
+
+func enqueueConsistencyCheck(db *gorm.DB, repair bool) (Job, bool, error) {
+	var n int64
+	db.Model(&Job{}).Where("kind = ? AND status IN ?", "consistency.check", []string{JobPending, JobRunning}).Count(&n)
+	if n > 0 {
+		return Job{}, false, nil
+	}
+	j, err := enqueueJob(db, "consistency.check", consistencyPayload{Repair: repair})
+	return j, err == nil, err
+}
+
+// startConsistencyScheduler encola una comprobación (con reparación) por
+// intervalo; como en stats, no se duplica si ya hay una pendiente.
+func startConsistencyScheduler(db *gorm.DB, every time.Duration) {
+	for range time.Tick(every) {
+		if _, _, err := enqueueConsistencyCheck(db, true); err != nil {
+			log.Printf("[CONSISTENCY] no pude encolar la comprobación: %v", err)
+		}
+	}
+}
+
+func adminConsistencyReportHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var r consistencyReport
+		found, err := getSetting(db, settingConsistencyReport, &r)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if !found {
+			c.JSON(404, gin.H{"error": "todavía no se ha hecho ninguna comprobación"})
+			return
+		}
+		c.JSON(200, r)
+	}
+}
+
+func adminConsistencyCheckHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in consistencyPayload
+		if err := c.ShouldBindJSON(&in); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		j, queued, err := enqueueConsistencyCheck(requestDB(db, c.Request.Context()), in.Repair)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if !queued {
+			c.JSON(409, gin.H{"error": "ya hay una comprobación en marcha"})
+			return
+		}
+		c.JSON(202, gin.H{"job_id": j.ID})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// Tests de contrato: openapi/openapi.yaml frente a lo que de verdad monta y
+// responde /api. Si alguien añade una ruta o cambia un campo sin tocar la
+// especificación (o al revés), fallan aquí y no en el cliente TypeScript.
+
+func loadSpec(t *testing.T) map[string]any {
+	t.Helper()
+	var spec map[string]any
+	if err := yaml.Unmarshal(openapiSpec, &spec); err != nil {
+		t.Fatalf("openapi.yaml: %v", err)
+	}
+	return spec
+}
+
+var ginParam = regexp.MustCompile(`:([a-z_]+)`)
+
+func TestOpenAPICoversAPIRoutes(t *testing.T) {
+	spec := loadSpec(t)
+	inSpec := map[string]bool{}
+	for path, item := range spec["paths"].(map[string]any) {
+		if !strings.HasPrefix(path, "/api/") {
+			continue
+		}
+		for method := range item.(map[string]any) {
+			if method != "parameters" {
+				inSpec[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+
+	db, _ := newMockDB(t)
+	r := gin.New()
+	api := r.Group("/api")
+	registerAPIRoutes(api, db)
+	// Las del plugin de gamificación también están documentadas (solo existen
+	// con GAMIFICATION_ENABLED).
+	(&gamificationPlugin{}).RegisterRoutes(db, r, api)
+	mounted := map[string]bool{}
+	for _, rt := range r.Routes() {
+		mounted[rt.Method+" "+ginParam.ReplaceAllString(rt.Path, "{$1}")] = true
+	}
+
+	for route := range mounted {
+		if !inSpec[route] {
+			t.Errorf("%s está montada pero no en openapi.yaml", route)
+		}
+	}
+	for route := range inSpec {
+		if !mounted[route] {
+			t.Errorf("%s está en openapi.yaml pero no montada", route)
+		}
+	}
+}
+
+// resolveRef sigue un $ref local (#/components/...).
+func resolveRef(spec map[string]any, ref string) map[string]any {
+	var node any = spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		node = node.(map[string]any)[part]
+	}
+	return node.(map[string]any)
+}
+
+// responseSchema es el esquema JSON de method path (tal cual en la
+// especificación) para status.
+func responseSchema(t *testing.T, spec map[string]any, method, path string, status int) map[string]any {
+	t.Helper()
+	item, ok := spec["paths"].(map[string]any)[path].(map[string]any)
+	if !ok {
+		t.Fatalf("%s no está en openapi.yaml", path)
+	}
+	op, ok := item[strings.ToLower(method)].(map[string]any)
+	if !ok {
+		t.Fatalf("%s %s no está en openapi.yaml", method, path)
+	}
+	resp, ok := op["responses"].(map[string]any)[strconv.Itoa(status)].(map[string]any)
+	if !ok {
+		t.Fatalf("%s %s no documenta %d", method, path, status)
+	}
+	if ref, ok := resp["$ref"].(string); ok {
+		resp = resolveRef(spec, ref)
+	}
+	content, ok := resp["content"].(map[string]any)["application/json"].(map[string]any)
+	if !ok {
+		t.Fatalf("%s %s %d no tiene cuerpo JSON", method, path, status)
+	}
+	return content["schema"].(map[string]any)
+}
+
+// schemaErrors compara v (JSON ya decodificado) con schema. Cubre lo que usa
+// openapi.yaml: $ref, allOf, type, nullable, enum, required, properties,
+// additionalProperties, items y format date-time. Un campo que el esquema no
+// declara también es un error: si no, la especificación se queda atrás sin
+// que nadie se entere.
+func schemaErrors(spec, schema map[string]any, v any, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return schemaErrors(spec, resolveRef(spec, ref), v, at)
+	}
+	var errs []string
+	for _, sub := range asList(schema["allOf"]) {
+		errs = append(errs, schemaErrors(spec, sub.(map[string]any), v, at)...)
+	}
+	if v == nil {
+		if schema["nullable"] == true || schema["type"] == nil {
+			return errs
+		}
+		return append(errs, at+": null y el esquema no es nullable")
+	}
+	if enum := asList(schema["enum"]); enum != nil && !slices.Contains(enum, v) {
+		errs = append(errs, fmt.Sprintf("%s: %v no está en %v", at, v, enum))
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: se esperaba objeto, llegó %T", at, v))
+		}
+		for _, k := range asList(schema["required"]) {
+			if _, ok := obj[k.(string)]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: falta %s", at, k))
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		extra, _ := schema["additionalProperties"].(map[string]any)
+		for k, fv := range obj {
+			switch p, ok := props[k].(map[string]any); {
+			case ok:
+				errs = append(errs, schemaErrors(spec, p, fv, at+"."+k)...)
+			case extra != nil:
+				errs = append(errs, schemaErrors(spec, extra, fv, at+"."+k)...)
+			case schema["additionalProperties"] != true && props != nil:
+				errs = append(errs, fmt.Sprintf("%s.%s: no está en el esquema", at, k))
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: se esperaba array, llegó %T", at, v))
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, iv := range arr {
+			errs = append(errs, schemaErrors(spec, items, iv, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: se esperaba string, llegó %T", at, v))
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q no es date-time", at, s))
+			}
+		}
+	case "integer":
+		if f, ok := v.(float64); !ok || f != float64(int64(f)) {
+			errs = append(errs, fmt.Sprintf("%s: se esperaba integer, llegó %v", at, v))
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			errs = append(errs, fmt.Sprintf("%s: se esperaba number, llegó %T", at, v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: se esperaba boolean, llegó %T", at, v))
+		}
+	}
+	return errs
+}
+
+func asList(v any) []any {
+	l, _ := v.([]any)
+	return l
+}
+
+func TestSchemaErrors(t *testing.T) {
+	spec := loadSpec(t)
+	task := map[string]any{"$ref": "#/components/schemas/Task"}
+	ok := map[string]any{"id": 1.0, "user_id": 2.0, "title": "x", "done": false, "priority": "high",
+		"created_at": "2026-01-02T03:04:05Z", "updated_at": "2026-01-02T03:04:05Z"}
+	if errs := schemaErrors(spec, task, ok, "Task"); len(errs) > 0 {
+		t.Fatalf("una tarea válida da errores: %v", errs)
+	}
+	bad := map[string]any{"id": "1", "title": "x", "done": false, "priority": "urgent",
+		"created_at": "ayer", "updated_at": "2026-01-02T03:04:05Z", "due_at": nil, "color": "red"}
+	want := []string{
+		"Task: falta user_id",
+		"Task.id: se esperaba integer, llegó 1",
+		`Task.priority: urgent no está en [low normal high]`,
+		`Task.created_at: "ayer" no es date-time`,
+		"Task.due_at: null y el esquema no es nullable",
+		"Task.color: no está en el esquema",
+	}
+	got := schemaErrors(spec, task, bad, "Task")
+	for _, w := range want {
+		if !slices.Contains(got, w) {
+			t.Errorf("falta el error %q; salieron %v", w, got)
+		}
+	}
+}
+
+// contractCase es una petición a /api con la BD simulada y el esquema
+// contra el que se comprueba su respuesta.
+type contractCase struct {
+	method, path string // la petición
+	specPath     string // la ruta tal cual en openapi.yaml
+	status       int
+	mock         func(sqlmock.Sqlmock)
+}
+
+var (
+	contractNow = time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	taskColumns = []string{"id", "user_id", "title", "done", "priority", "due_at", "created_at", "updated_at", "completed_at", "reminder"}
+)
+
+func taskRows() *sqlmock.Rows {
+	return sqlmock.NewRows(taskColumns).
+		AddRow(1, 7, "Pagar el alquiler", false, "high", contractNow.Add(48*time.Hour), contractNow, contractNow, nil, `{"label":"Alquiler","category":"casa"}`).
+		AddRow(2, 7, "Llamar a Ana", true, "normal", nil, contractNow, contractNow, contractNow, nil)
+}
+
+var contractCases = []contractCase{
+	{"GET", "/api/tasks?per_page=20", "/api/tasks", 200, func(m sqlmock.Sqlmock) {
+		m.ExpectQuery(`SELECT "id","list_prefs" FROM "users"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "list_prefs"}).AddRow(7, `{}`))
+		m.ExpectQuery(`SELECT count\(\*\) FROM "tasks"`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		m.ExpectQuery(`FROM "tasks"`).WillReturnRows(taskRows())
+	}},
+	{"GET", "/api/tasks/1", "/api/tasks/{id}", 200, func(m sqlmock.Sqlmock) {
+		m.ExpectQuery(`FROM "tasks"`).WillReturnRows(taskRows())
+	}},
+	{"GET", "/api/tasks/99", "/api/tasks/{id}", 404, func(m sqlmock.Sqlmock) {
+		m.ExpectQuery(`FROM "tasks"`).WillReturnRows(sqlmock.NewRows(taskColumns))
+	}},
+	{"GET", "/api/me", "/api/me", 200, func(m sqlmock.Sqlmock) {
+		m.ExpectQuery(`FROM "users"`).WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "email", "created_at", "role", "phone", "phone_verified", "search_language", "timezone", "public_slug", "list_prefs"}).
+			AddRow(7, "ana@example.com", contractNow, "user", "+34600000000", true, "spanish", "Europe/Madrid", "ana", `{"sort":"due_at","order":"asc"}`))
+	}},
+	{"GET", "/api/searches", "/api/searches", 200, func(m sqlmock.Sqlmock) {
+		m.ExpectQuery(`FROM "saved_searches"`).WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "user_id", "query", "created_at"}).AddRow(3, 7, "priority:high", contractNow))
+	}},
+	{"GET", "/api/notifications/channels", "/api/notifications/channels", 200, func(m sqlmock.Sqlmock) {
+		m.ExpectQuery(`FROM "notification_channels"`).WillReturnRows(sqlmock.NewRows(
+			[]string{"id", "user_id", "kind", "server_url", "room_id", "access_token", "enabled", "created_at", "last_success_at"}).
+			AddRow(4, 7, "matrix", "https://matrix.example.com", "!sala:example.com", "secreto", true, contractNow, contractNow))
+	}},
+}
+
+func TestOpenAPIResponses(t *testing.T) {
+	spec := loadSpec(t)
+	for _, tc := range contractCases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			tc.mock(mock)
+			r := gin.New()
+			r.Use(RequestID())
+			registerAPIRoutes(r.Group("/api", asUser(User{ID: 7, Timezone: "UTC"})), db)
+
+			w := doRequest(r, tc.method, tc.path, "")
+			if w.Code != tc.status {
+				t.Fatalf("status %d, quería %d: %s", w.Code, tc.status, w.Body)
+			}
+			var body any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("la respuesta no es JSON: %v", err)
+			}
+			schema := responseSchema(t, spec, tc.method, tc.specPath, tc.status)
+			for _, e := range schemaErrors(spec, schema, body, "body") {
+				t.Error(e)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// ========= DB =========
+//
+// Caché de sentencias preparadas en dos niveles:
+//   - GORM (DB_PREPARE_STMT=true por defecto): reutiliza el *sql.Stmt de cada
+//     SQL. DB_PREPARE_STMT_MAX (512) limita cuántos guarda y
+//     DB_PREPARE_STMT_TTL_MINUTES (60) los caduca.
+//   - pgx (DB_QUERY_EXEC_MODE): cache_statement (por defecto en pgx),
+//     cache_describe, describe_exec, exec o simple_protocol, con
+//     DB_STATEMENT_CACHE_CAPACITY entradas por conexión.
+//
+// Detrás de PgBouncer en modo transacción las sentencias preparadas no
+// sobreviven entre transacciones: usar DB_PREPARE_STMT=false y
+// DB_QUERY_EXEC_MODE=simple_protocol.
+
+var pgxExecModes = map[string]bool{
+	"cache_statement": true, "cache_describe": true, "describe_exec": true, "exec": true, "simple_protocol": true,
+}
+
+func openDB(dsn string) (*gorm.DB, error) {
+	params := map[string]string{}
+	if mode := getEnv("DB_QUERY_EXEC_MODE", ""); mode != "" {
+		if !pgxExecModes[mode] {
+			return nil, fmt.Errorf("DB_QUERY_EXEC_MODE desconocido: %s", mode)
+		}
+		params["default_query_exec_mode"] = mode
+	}
+	if n := getEnvInt("DB_STATEMENT_CACHE_CAPACITY", 0); n > 0 {
+		params["statement_cache_capacity"] = fmt.Sprint(n)
+	}
+	prepare := getEnv("DB_PREPARE_STMT", "true") == "true"
+	if params["default_query_exec_mode"] == "simple_protocol" && prepare {
+		return nil, fmt.Errorf("DB_QUERY_EXEC_MODE=simple_protocol necesita DB_PREPARE_STMT=false")
+	}
+	return gorm.Open(postgres.Open(withDSNParams(dsn, params)), &gorm.Config{
+		PrepareStmt:        prepare,
+		PrepareStmtMaxSize: getEnvInt("DB_PREPARE_STMT_MAX", 512),
+		PrepareStmtTTL:     time.Duration(getEnvInt("DB_PREPARE_STMT_TTL_MINUTES", 60)) * time.Minute,
+	})
+}
+
+// withDSNParams añade parámetros tanto a un DSN "clave=valor" como a una URL
+// postgres://.
+func withDSNParams(dsn string, params map[string]string) string {
+	for k, v := range params {
+		switch {
+		case !strings.Contains(dsn, "://"):
+			dsn += " " + k + "=" + v
+		case strings.Contains(dsn, "?"):
+			dsn += "&" + k + "=" + v
+		default:
+			dsn += "?" + k + "=" + v
+		}
+	}
+	return dsn
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= DESACTIVACIÓN =========
+//
+// Una cuenta desactivada conserva todos sus datos pero no puede entrar (login,
+// SSO, JWT y tokens OAuth vigentes) y no recibe recordatorios: los que vencen
+// mientras está desactivada se saltan, no se acumulan. DeactivatedBy dice
+// quién la desactivó; solo la que desactivó el propio usuario puede
+// reactivarse sola (POST /auth/login con "reactivate": true). Las de un admin
+// (moderación) o del IdP por SCIM las reactiva quien las desactivó.
+
+const (
+	DeactivatedBySelf  = "self"
+	DeactivatedByAdmin = "admin"
+	DeactivatedBySCIM  = "scim"
+)
+
+func deactivateUser(db *gorm.DB, u *User, by string, actor uint) error {
+	if u.DeactivatedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	if err := db.Model(u).Updates(map[string]any{"deactivated_at": now, "deactivated_by": by}).Error; err != nil {
+		return err
+	}
+	u.DeactivatedAt, u.DeactivatedBy = &now, by
+	recordEvent(db, u.ID, "account.deactivated", nil, gin.H{"by": actor, "reason": by})
+	purgeCDN(db, userCacheKey(u.ID)) // su perfil público deja de existir
+	return nil
+}
+
+func reactivateUser(db *gorm.DB, u *User, actor uint) error {
+	if u.DeactivatedAt == nil {
+		return nil
+	}
+	if err := db.Model(u).Updates(map[string]any{"deactivated_at": nil, "deactivated_by": ""}).Error; err != nil {
+		return err
+	}
+	u.DeactivatedAt, u.DeactivatedBy = nil, ""
+	recordEvent(db, u.ID, "account.reactivated", nil, gin.H{"by": actor})
+	return nil
+}
+
+// userActive indica si la cuenta existe y no está desactivada.
+func userActive(db *gorm.DB, uid uint) bool {
+	var n int64
+	if err := db.Model(&User{}).Where("id = ? AND deactivated_at IS NULL", uid).Count(&n).Error; err != nil {
+		log.Printf("[USERS] no pude comprobar si %d está activo: %v", uid, err)
+		return true // ante la duda, avisar
+	}
+	return n > 0
+}
+
+func deactivateMeHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		if u.Role == RoleAdmin && !otherAdminsExist(db, u.ID) {
+			c.JSON(409, gin.H{"error": "no se puede desactivar el último admin"})
+			return
+		}
+		if err := deactivateUser(db, &u, DeactivatedBySelf, u.ID); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, u)
+	}
+}
+
+func adminDeactivateUserHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		if u.Role == RoleAdmin && !otherAdminsExist(db, u.ID) {
+			c.JSON(409, gin.H{"error": "no se puede desactivar el último admin"})
+			return
+		}
+		if err := deactivateUser(db, &u, DeactivatedByAdmin, c.GetUint("user_id")); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, u)
+	}
+}
+
+func adminReactivateUserHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		if err := reactivateUser(db, &u, c.GetUint("user_id")); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, u)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ========= DEMO MODE =========
+//
+// Con DEMO_MODE=true cualquiera puede pedir una cuenta desechable con datos de
+// ejemplo. Las cuentas demo no envían nada fuera (canales de notificación,
+// SMS) y se borran cada noche a DEMO_WIPE_HOUR (UTC).
+
+var (
+	demoMode     = getEnv("DEMO_MODE", "false") == "true"
+	demoWipeHour = getEnvInt("DEMO_WIPE_HOUR", 3)
+	demoLimiter  rateLimiter
+)
+
+var demoSampleTasks = []struct {
+	title    string
+	priority string
+	dueIn    time.Duration
+}{
+	{"Explorar TaskFlow", "normal", 0},
+	{"Marcar esta tarea como hecha", "low", 0},
+	{"Revisar la tarea con recordatorio", "high", 10 * time.Minute},
+	{"Preparar la reunión del lunes", "normal", 72 * time.Hour},
+}
+
+// rateLimiter limita acciones por clave (aquí, la IP). Con STATE_BACKEND=postgres
+// el contador se comparte entre réplicas (pgRateLimiter, ver cluster.go).
+type rateLimiter interface {
+	allow(key string) bool
+}
+
+func newDemoLimiter(db *gorm.DB, backend string) rateLimiter {
+	max := getEnvInt("DEMO_ACCOUNTS_PER_HOUR", 5)
+	if backend == StatePostgres {
+		return &pgRateLimiter{db: db, prefix: "demo:", max: max, window: time.Hour}
+	}
+	return newIPLimiter(max, time.Hour)
+}
+
+// ipLimiter es una ventana deslizante por IP, suficiente para frenar abusos en
+// la demo pública.
+type ipLimiter struct {
+	mu     sync.Mutex
+	max    int
+	window time.Duration
+	hits   map[string][]time.Time
+}
+
+func newIPLimiter(max int, window time.Duration) *ipLimiter {
+	return &ipLimiter{max: max, window: window, hits: map[string][]time.Time{}}
+}
+
+func (l *ipLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	kept := l.hits[ip][:0]
+	for _, t := range l.hits[ip] {
+		if now.Sub(t) < l.window {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) >= l.max {
+		l.hits[ip] = kept
+		return false
+	}
+	l.hits[ip] = append(kept, now)
+	return true
+}
+
+// isDemoUser indica si el usuario es una cuenta demo (y por tanto no debe
+// enviar nada a servicios externos).
+func isDemoUser(db *gorm.DB, userID uint) bool {
+	if !demoMode {
+		return false
+	}
+	var u User
+	return db.Select("is_demo").First(&u, userID).Error == nil && u.IsDemo
+}
+
+func demoAccountHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !demoLimiter.allow(c.ClientIP()) {
+			c.JSON(429, gin.H{"error": "demasiadas cuentas demo, prueba más tarde"})
+			return
+		}
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			c.JSON(500, gin.H{"error": "no se pudo crear la cuenta"})
+			return
+		}
+		suffix := hex.EncodeToString(buf)
+		hash, _ := bcrypt.GenerateFromPassword([]byte(suffix), bcrypt.DefaultCost)
+		u := User{Email: "demo-" + suffix + "@demo.invalid", PasswordHash: string(hash), IsDemo: true}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&u).Error; err != nil {
+				return err
+			}
+			for _, s := range demoSampleTasks {
+				t := Task{UserID: u.ID, Title: s.title, Priority: s.priority}
+				if s.dueIn > 0 {
+					due := time.Now().Add(s.dueIn)
+					t.DueAt = &due
+				}
+				if err := tx.Create(&t).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		tok, err := issueToken(u)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "no se pudo firmar token"})
+			return
+		}
+		c.JSON(201, gin.H{"token": tok, "email": u.Email, "expires": "las cuentas demo se borran cada noche"})
+	}
+}
+
+// purgeUsers borra los usuarios indicados junto con todos sus datos. Si
+// alguno está en retención legal no borra nada y devuelve errLegalHold (quien
+// llama ya debería haberlo comprobado con checkLegalHold).
+//
+// Los eventos se quedan para la auditoría, pero sin data: ahí van títulos de
+// tareas y emails. Queda qué pasó y cuándo, no sobre qué.
+func purgeUsers(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if held, err := heldUserIDs(tx, ids); err != nil {
+		return err
+	} else if len(held) > 0 {
+		return errLegalHold
+	}
+	var apps []uint
+	if err := tx.Model(&OAuthApp{}).Where("user_id IN ?", ids).Pluck("id", &apps).Error; err != nil {
+		return err
+	}
+	if err := purgeOAuthApps(tx, apps); err != nil {
+		return err
+	}
+	if err := tx.Model(&Event{}).Where("user_id IN ?", ids).Update("data", nil).Error; err != nil {
+		return err
+	}
+	for _, model := range []any{&TaskView{}, &Task{}, &NotificationChannel{}, &SavedSearch{}, &Import{}, &DigestItem{}, &OAuthCode{}, &OAuthToken{}, &QuotaWarning{}, &ViewPreset{}, &PointAward{}, &Achievement{}, &HabitCheckin{}, &Habit{}, &FocusItem{}} {
+		if err := tx.Where("user_id IN ?", ids).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("id IN ?", ids).Delete(&User{}).Error
+}
+
+// deleteAccounts borra las cuentas ids con purgeUsers en una transacción y,
+// una vez confirmada, sus ficheros del blob store (avatar e importaciones):
+// un blob borrado no vuelve con un rollback, así que no puede ir dentro.
+// Cada cuenta deja un evento account.deleted con quién la borró (actor, 0 si
+// fue el sistema) y por qué vía (reason), como account.deactivated.
+func deleteAccounts(db *gorm.DB, ids []uint, reason string, actor uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var keys []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if keys, err = userBlobKeys(tx, ids); err != nil {
+			return err
+		}
+		if err := purgeUsers(tx, ids); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			recordEvent(tx, id, "account.deleted", nil, gin.H{"by": actor, "reason": reason})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	deleteBlobs(keys)
+	cacheKeys := make([]string, len(ids))
+	for i, id := range ids {
+		cacheKeys[i] = userCacheKey(id)
+	}
+	purgeCDN(db, cacheKeys...)
+	return nil
+}
+
+func wipeDemoAccounts(db *gorm.DB) {
+	var ids []uint
+	if err := db.Model(&User{}).Where("is_demo = ?", true).Pluck("id", &ids).Error; err != nil {
+		log.Printf("[DEMO] no puedo listar cuentas demo: %v", err)
+		return
+	}
+	// Las demo en retención legal se quedan hasta que se levante.
+	held, err := heldUserIDs(db, ids)
+	if err != nil {
+		log.Printf("[DEMO] no puedo comprobar la retención legal: %v", err)
+		return
+	}
+	for _, id := range held {
+		recordEvent(db, id, "legal_hold.blocked", nil, gin.H{"action": "demo.wipe", "by": 0})
+		ids = slices.DeleteFunc(ids, func(x uint) bool { return x == id })
+	}
+	if err := deleteAccounts(db, ids, "demo", 0); err != nil {
+		log.Printf("[DEMO] borrado nocturno falló: %v", err)
+		return
+	}
+	log.Printf("[DEMO] borradas %d cuentas demo", len(ids))
+}
+
+// startDemoWiper espera hasta la próxima DEMO_WIPE_HOUR y repite cada 24h.
+func startDemoWiper(db *gorm.DB) {
+	for {
+		now := time.Now().UTC()
+		next := time.Date(now.Year(), now.Month(), now.Day(), demoWipeHour, 0, 0, 0, time.UTC)
+		if !next.After(now) {
+			next = next.Add(24 * time.Hour)
+		}
+		time.Sleep(time.Until(next))
+		wipeDemoAccounts(db)
+	}
+}
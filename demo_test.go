@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectPurge son las consultas de purgeUsers para una cuenta sin apps OAuth.
+func expectPurge(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT "id" FROM "users" WHERE id IN .* legal_hold_at IS NOT NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT "id" FROM "oauth_apps"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(`UPDATE "events" SET "data"=`).WillReturnResult(sqlmock.NewResult(0, 3))
+	for range 16 { // las 15 tablas con user_id y la de usuarios
+		mock.ExpectExec(`DELETE FROM`).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+}
+
+// expectDeletedEvent es el account.deleted que deja deleteAccounts.
+func expectDeletedEvent(mock sqlmock.Sqlmock, by uint, reason string) {
+	mock.ExpectQuery(`INSERT INTO "events"`).
+		WithArgs(sqlmock.AnyArg(), "account.deleted", nil, fmt.Sprintf(`{"by":%d,"reason":"%s"}`, by, reason), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
+
+func TestDeleteAccountsRemovesBlobsAfterCommit(t *testing.T) {
+	blobs := withRecordingBlobStore(t)
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "avatar_key" FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"avatar_key"}).AddRow("avatars/5/abc.png"))
+	mock.ExpectQuery(`SELECT "blob_key" FROM "imports"`).
+		WillReturnRows(sqlmock.NewRows([]string{"blob_key"}).AddRow("imports/5/x.json"))
+	expectPurge(mock)
+	expectDeletedEvent(mock, 0, "demo")
+	mock.ExpectCommit()
+
+	if err := deleteAccounts(db, []uint{5}, "demo", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"avatars/5/abc.png", "imports/5/x.json"}; !slices.Equal(blobs.deleted, want) {
+		t.Fatalf("borrados %v, quería %v", blobs.deleted, want)
+	}
+}
+
+// Si la transacción no se confirma, los ficheros se quedan.
+func TestDeleteAccountsKeepsBlobsOnRollback(t *testing.T) {
+	blobs := withRecordingBlobStore(t)
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "avatar_key" FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"avatar_key"}).AddRow("avatars/5/abc.png"))
+	mock.ExpectQuery(`SELECT "blob_key" FROM "imports"`).WillReturnRows(sqlmock.NewRows([]string{"blob_key"}))
+	mock.ExpectQuery(`SELECT "id" FROM "users" WHERE id IN .* legal_hold_at IS NOT NULL`).
+		WillReturnError(errors.New("conexión perdida"))
+	mock.ExpectRollback()
+
+	if err := deleteAccounts(db, []uint{5}, "demo", 0); err == nil {
+		t.Fatal("quería el error de la BD")
+	}
+	if len(blobs.deleted) > 0 {
+		t.Fatalf("borró %v sin haber borrado la cuenta", blobs.deleted)
+	}
+}
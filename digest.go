@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ========= NOTIFICATION BUDGET =========
+//
+// Cada usuario recibe como mucho NOTIFY_MAX_PER_HOUR avisos por hora (10 por
+// defecto). Lo que se pase se guarda y sale en un único resumen al final de la
+// hora, para que importar 500 tareas vencidas no dispare 500 pushes.
+
+type DigestItem struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	TaskID    uint      `gorm:"not null"`
+	Priority  string    `gorm:"not null"`
+	Title     string    `gorm:"not null"`
+	Body      string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+const digestWindow = time.Hour
+
+var (
+	notifyBudget     rateLimiter
+	notifyMaxPerHour = getEnvInt("NOTIFY_MAX_PER_HOUR", 10)
+)
+
+func newNotifyBudget(db *gorm.DB, backend string) rateLimiter {
+	if backend == StatePostgres {
+		return &pgRateLimiter{db: db, prefix: "notify:", max: notifyMaxPerHour, window: digestWindow}
+	}
+	return newIPLimiter(notifyMaxPerHour, digestWindow)
+}
+
+// deferToDigest guarda el aviso y, si no hay ya un resumen pendiente para el
+// usuario, lo programa para dentro de una hora.
+func deferToDigest(db *gorm.DB, n Notification) {
+	item := DigestItem{UserID: n.UserID, TaskID: n.TaskID, Priority: n.Priority, Title: n.Title, Body: n.Body}
+	if err := db.Create(&item).Error; err != nil {
+		log.Printf("[NOTIFY] no pude aplazar el aviso del user %d: %v", n.UserID, err)
+		return
+	}
+	var pending int64
+	db.Model(&Job{}).
+		Where("kind = ? AND status = ? AND (payload->>'user_id')::bigint = ?", "notify.digest", JobPending, n.UserID).
+		Count(&pending)
+	if pending > 0 {
+		return
+	}
+	if _, err := enqueueJobAt(db, "notify.digest", map[string]uint{"user_id": n.UserID}, time.Now().Add(digestWindow)); err != nil {
+		log.Printf("[NOTIFY] no pude programar el resumen del user %d: %v", n.UserID, err)
+	}
+}
+
+// digestJob agrupa los avisos aplazados en uno solo. No pasa por el cupo: es
+// justo lo que el cupo pretende producir.
+func digestJob(_ context.Context, db *gorm.DB, j Job) error {
+	var p struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.Unmarshal([]byte(j.Payload), &p); err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	var items []DigestItem
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", p.UserID).Order("id").Find(&items).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Delete(&items).Error
+	})
+	if err != nil || len(items) == 0 {
+		return err
+	}
+	deliverNotification(db, buildDigest(p.UserID, items))
+	return nil
+}
+
+func buildDigest(userID uint, items []DigestItem) Notification {
+	const shown = 15
+	n := Notification{UserID: userID, Priority: "normal", Title: fmt.Sprintf("%d recordatorios pendientes", len(items))}
+	var b strings.Builder
+	for i, it := range items {
+		if it.Priority == "high" {
+			n.Priority = "high"
+		}
+		if i < shown {
+			fmt.Fprintf(&b, "• %s\n", it.Body)
+		}
+	}
+	if len(items) > shown {
+		fmt.Fprintf(&b, "… y %d más", len(items)-shown)
+	}
+	n.Body = strings.TrimRight(b.String(), "\n")
+	return n
+}
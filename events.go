@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= EVENT LOG =========
+//
+// Registro append-only de lo que pasa en la cuenta. El ID es creciente y sirve
+// de cursor: quien exporta guarda el último id recibido y reanuda con
+// ?since=<id>.
+
+type Event struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index:idx_events_user_id_id,priority:1;not null" json:"user_id"`
+	Kind      string    `gorm:"not null" json:"kind"`
+	TaskID    *uint     `json:"task_id,omitempty"`
+	Data      string    `gorm:"type:jsonb" json:"data,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// recordEvent añade un evento. Un fallo se loguea pero no rompe la operación
+// que lo originó.
+func recordEvent(db *gorm.DB, userID uint, kind string, taskID *uint, data any) {
+	ev := Event{UserID: userID, Kind: kind, TaskID: taskID}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			log.Printf("[EVENTS] %s: %v", kind, err)
+			return
+		}
+		ev.Data = string(raw)
+	}
+	if err := db.Create(&ev).Error; err != nil {
+		log.Printf("[EVENTS] no pude guardar %s de %d: %v", kind, userID, err)
+	}
+}
+
+// activityPlugin vuelca los eventos de tareas en el registro.
+type activityPlugin struct {
+	db *gorm.DB
+}
+
+func (*activityPlugin) Name() string { return "activity-log" }
+
+func (p *activityPlugin) OnTaskEvent(_ context.Context, ev TaskEvent) {
+	id := ev.Task.ID
+	recordEvent(p.db, ev.UserID, ev.Kind, &id, ev.Task)
+}
+
+// streamEvents escribe un evento JSON por línea, por lotes y en orden de id.
+// Cada lote se pide después de haber escrito el anterior, así que un cliente
+// lento frena la lectura de la base de datos en vez de acumularlo en memoria.
+func streamEvents(c *gin.Context, db *gorm.DB, scope func(*gorm.DB) *gorm.DB) {
+	since, err := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "since debe ser un id de evento"})
+		return
+	}
+	const batch = 500
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(200)
+	enc := json.NewEncoder(c.Writer)
+	ctx := c.Request.Context()
+	for ctx.Err() == nil {
+		var events []Event
+		err := scope(db.WithContext(ctx)).Where("id > ?", since).Order("id").Limit(batch).Find(&events).Error
+		if err != nil {
+			// Las cabeceras ya salieron; el cliente reanuda desde el último id.
+			log.Printf("[EVENTS] export interrumpido tras %d: %v", since, err)
+			return
+		}
+		for _, ev := range events {
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			since = ev.ID
+		}
+		c.Writer.Flush()
+		if len(events) < batch {
+			return
+		}
+	}
+}
+
+// exportEventsHandler: GET /api/export/events.ndjson?since=<id>
+func exportEventsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		streamEvents(c, db, func(q *gorm.DB) *gorm.DB { return q.Where("user_id = ?", uid) })
+	}
+}
+
+// eventsCSVHeader son las columnas de /admin/export/events.csv.
+var eventsCSVHeader = []string{"id", "created_at", "user_id", "email", "kind", "task_id", "data"}
+
+// csvSafe evita que una hoja de cálculo tome como fórmula un valor que el
+// usuario controla (título de una tarea, email...).
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// eventTime lee since/until: RFC 3339 o fecha (until incluye todo ese día).
+func eventTime(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return t, errors.New("debe ser RFC 3339 o 2006-01-02")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// eventFilters traduce los parámetros de la exportación CSV a condiciones:
+// since y until (fechas), user_id o email (quién) y kind (qué, separados por
+// comas; "task.*" vale para todos los task.).
+func eventFilters(c *gin.Context, db *gorm.DB) (func(*gorm.DB) *gorm.DB, error) {
+	var conds []func(*gorm.DB) *gorm.DB
+	if v := c.Query("since"); v != "" {
+		t, err := eventTime(v, false)
+		if err != nil {
+			return nil, errors.New("since " + err.Error())
+		}
+		conds = append(conds, func(q *gorm.DB) *gorm.DB { return q.Where("e.created_at >= ?", t) })
+	}
+	if v := c.Query("until"); v != "" {
+		t, err := eventTime(v, true)
+		if err != nil {
+			return nil, errors.New("until " + err.Error())
+		}
+		conds = append(conds, func(q *gorm.DB) *gorm.DB { return q.Where("e.created_at < ?", t) })
+	}
+	if v := c.Query("user_id"); v != "" {
+		uid, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, errors.New("user_id debe ser un número")
+		}
+		conds = append(conds, func(q *gorm.DB) *gorm.DB { return q.Where("e.user_id = ?", uid) })
+	} else if v := c.Query("email"); v != "" {
+		var u User
+		if err := db.Select("id").Where("email = ?", strings.ToLower(strings.TrimSpace(v))).First(&u).Error; err != nil {
+			return nil, errors.New("no hay ningún usuario con ese email")
+		}
+		conds = append(conds, func(q *gorm.DB) *gorm.DB { return q.Where("e.user_id = ?", u.ID) })
+	}
+	if v := c.Query("kind"); v != "" {
+		var exact, prefixes []string
+		for _, k := range strings.Split(v, ",") {
+			k = strings.TrimSpace(k)
+			if p, ok := strings.CutSuffix(k, "*"); ok {
+				prefixes = append(prefixes, p)
+			} else if k != "" {
+				exact = append(exact, k)
+			}
+		}
+		conds = append(conds, func(q *gorm.DB) *gorm.DB {
+			// "" para que IN () no quede vacío si solo hay prefijos.
+			or := db.Where("e.kind IN ?", append(exact, ""))
+			for _, p := range prefixes {
+				or = or.Or("starts_with(e.kind, ?)", p)
+			}
+			return q.Where(or)
+		})
+	}
+	return func(q *gorm.DB) *gorm.DB {
+		for _, cond := range conds {
+			q = cond(q)
+		}
+		return q
+	}, nil
+}
+
+// adminExportEventsCSVHandler: GET /admin/export/events.csv, el registro de
+// actividad filtrado para auditoría. Va por lotes en orden de id, como el
+// NDJSON, y deja constancia de quién lo exportó y con qué filtros.
+func adminExportEventsCSVHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope, err := eventFilters(c, db)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		recordEvent(requestDB(db, c.Request.Context()), c.GetUint("user_id"), "events.exported", nil, gin.H{"format": "csv", "filters": c.Request.URL.Query()})
+
+		const batch = 1000
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="eventos.csv"`)
+		c.Status(200)
+		w := csv.NewWriter(c.Writer)
+		w.Write(eventsCSVHeader)
+		ctx := c.Request.Context()
+		var since uint64
+		for ctx.Err() == nil {
+			var rows []struct {
+				Event
+				Email string
+			}
+			err := scope(db.WithContext(ctx).Table("events e").
+				Select("e.*, u.email").Joins("LEFT JOIN users u ON u.id = e.user_id")).
+				Where("e.id > ?", since).Order("e.id").Limit(batch).Scan(&rows).Error
+			if err != nil {
+				log.Printf("[EVENTS] export CSV interrumpido tras %d: %v", since, err)
+				return
+			}
+			for _, r := range rows {
+				task := ""
+				if r.TaskID != nil {
+					task = strconv.FormatUint(uint64(*r.TaskID), 10)
+				}
+				w.Write([]string{strconv.FormatUint(r.ID, 10), r.CreatedAt.UTC().Format(time.RFC3339),
+					strconv.FormatUint(uint64(r.UserID), 10), csvSafe(r.Email), r.Kind, task, csvSafe(r.Data)})
+				since = r.ID
+			}
+			w.Flush()
+			if w.Error() != nil || len(rows) < batch {
+				return
+			}
+		}
+	}
+}
+
+// adminExportEventsHandler exporta los eventos de toda la instancia.
+func adminExportEventsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		streamEvents(c, db, func(q *gorm.DB) *gorm.DB { return q })
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= EXPORT =========
+
+// exportTasksHandler exporta las tareas del usuario, con los mismos filtros
+// que el listado (done, priority, sort, order). format=markdown genera una
+// checklist lista para pegar en un wiki o README; format=json (por defecto)
+// devuelve lo mismo que GET /api/tasks.
+func exportTasksHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		sort := c.DefaultQuery("sort", "due_at")
+		if !taskSortColumns[sort] {
+			c.JSON(400, gin.H{"error": "sort debe ser id, created_at, updated_at o due_at"})
+			return
+		}
+		order := c.DefaultQuery("order", "asc")
+		if order != "asc" && order != "desc" {
+			c.JSON(400, gin.H{"error": "order debe ser asc o desc"})
+			return
+		}
+		q := db.Where("user_id = ?", uid)
+		switch c.Query("done") {
+		case "":
+		case "true":
+			q = q.Where("done")
+		case "false":
+			q = q.Where("NOT done")
+		default:
+			c.JSON(400, gin.H{"error": "done debe ser true o false"})
+			return
+		}
+		if p := c.Query("priority"); p != "" {
+			if !validPriorities[p] {
+				c.JSON(400, gin.H{"error": "priority debe ser low, normal o high"})
+				return
+			}
+			q = q.Where("priority = ?", p)
+		}
+		var tasks []Task
+		if err := q.Order(sort + " " + order + " NULLS LAST, id").Find(&tasks).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		switch c.DefaultQuery("format", "json") {
+		case "json":
+			c.JSON(200, tasks)
+		case "markdown", "md":
+			c.Header("Content-Disposition", `attachment; filename="tareas.md"`)
+			c.Data(200, "text/markdown; charset=utf-8", []byte(tasksMarkdown(tasks)))
+		default:
+			c.JSON(400, gin.H{"error": "format debe ser json o markdown"})
+		}
+	}
+}
+
+// tasksMarkdown escribe una línea "- [ ] título (vence 2006-01-02)" por tarea.
+func tasksMarkdown(tasks []Task) string {
+	var b strings.Builder
+	for _, t := range tasks {
+		check := " "
+		if t.Done {
+			check = "x"
+		}
+		fmt.Fprintf(&b, "- [%s] %s", check, markdownInline(t.Title))
+		var extra []string
+		if t.DueAt != nil {
+			extra = append(extra, "vence "+t.DueAt.UTC().Format("2006-01-02 15:04")+" UTC")
+		}
+		if t.Priority == "high" {
+			extra = append(extra, "prioridad alta")
+		}
+		if len(extra) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(extra, ", "))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// markdownEscaper deja el título en una sola línea y escapa lo que Markdown
+// interpretaría como formato.
+var markdownEscaper = strings.NewReplacer(
+	"\r", " ", "\n", " ",
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, "#", `\#`,
+)
+
+func markdownInline(s string) string {
+	return markdownEscaper.Replace(strings.TrimSpace(s))
+}
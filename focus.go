@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========= MI DÍA =========
+//
+// Una lista corta de tareas elegidas para hoy. Cada entrada es de un día (en
+// la zona del usuario), así que a medianoche la lista de hoy empieza vacía sin
+// tener que borrar nada.
+//
+// Cada mañana, a FOCUS_MORNING_HOUR (7; -1 lo desactiva) en cada zona horaria,
+// el trabajo "focus.morning" propone a quien usó Mi día en la última semana lo
+// que quedó sin hacer de la lista de ayer y lo que vence hoy, y le manda un
+// resumen del día por sus canales. Las propuestas salen con suggested: true
+// hasta que se aceptan con POST /api/focus o se quitan.
+
+const (
+	focusMaxItems  = 50
+	focusKeepDays  = 30 // las entradas más viejas se borran
+	focusIdleDays  = 7  // sin usar Mi día en este tiempo, no hay propuestas
+	focusDigestMax = 10
+	// focusMorningWindow son las horas tras FOCUS_MORNING_HOUR en que aún se
+	// manda la mañana.
+	focusMorningWindow = 3
+)
+
+var focusMorningHour = getEnvInt("FOCUS_MORNING_HOUR", 7)
+
+type FocusItem struct {
+	UserID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Day       string `gorm:"primaryKey;type:date"`
+	TaskID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Suggested bool   `gorm:"not null;default:false"`
+	// Reason de una propuesta: "carryover" (de ayer) o "due" (vence hoy).
+	Reason    string
+	CreatedAt time.Time
+}
+
+type focusEntry struct {
+	Task
+	Suggested bool   `json:"suggested"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// loadFocus devuelve la lista de day con sus tareas; las borradas no salen.
+func loadFocus(db *gorm.DB, uid uint, day string) ([]focusEntry, error) {
+	var items []FocusItem
+	if err := db.Where("user_id = ? AND day = ?", uid, day).Order("created_at").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	out := []focusEntry{}
+	if len(items) == 0 {
+		return out, nil
+	}
+	ids := make([]uint, len(items))
+	for i, it := range items {
+		ids[i] = it.TaskID
+	}
+	var tasks []Task
+	if err := db.Where("user_id = ? AND id IN ?", uid, ids).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+	for _, it := range items {
+		if t, ok := byID[it.TaskID]; ok {
+			out = append(out, focusEntry{Task: t, Suggested: it.Suggested, Reason: it.Reason})
+		}
+	}
+	return out, nil
+}
+
+func userToday(c *gin.Context) string {
+	return civilDay(time.Now(), userLocation(c.GetString("timezone"))).Format(time.DateOnly)
+}
+
+// listFocusHandler: GET /api/focus
+func listFocusHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		day := userToday(c)
+		entries, err := loadFocus(db, c.GetUint("user_id"), day)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"date": day, "tasks": entries})
+	}
+}
+
+// addFocusHandler: POST /api/focus {"task_id"}. Sobre una propuesta, la acepta.
+func addFocusHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		TaskID uint `json:"task_id" binding:"required"`
+	}
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var t Task
+		if err := db.Where("user_id = ? AND id = ?", uid, in.TaskID).First(&t).Error; err != nil {
+			c.JSON(404, gin.H{"error": "task no encontrada"})
+			return
+		}
+		day := userToday(c)
+		var n int64
+		db.Model(&FocusItem{}).Where("user_id = ? AND day = ? AND NOT suggested", uid, day).Count(&n)
+		if n >= focusMaxItems {
+			c.JSON(409, gin.H{"error": fmt.Sprintf("Mi día admite como mucho %d tareas", focusMaxItems)})
+			return
+		}
+		err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "day"}, {Name: "task_id"}},
+			DoUpdates: clause.Assignments(map[string]any{"suggested": false}),
+		}).Create(&FocusItem{UserID: uid, Day: day, TaskID: t.ID}).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		entries, err := loadFocus(db, uid, day)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"date": day, "tasks": entries})
+	}
+}
+
+// removeFocusHandler: DELETE /api/focus/:task_id, la saca de hoy (la tarea
+// no se toca).
+func removeFocusHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		day := userToday(c)
+		res := db.Where("user_id = ? AND day = ? AND task_id = ?", uid, day, c.Param("task_id")).Delete(&FocusItem{})
+		if res.Error != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(404, gin.H{"error": "la tarea no está en Mi día"})
+			return
+		}
+		entries, err := loadFocus(db, uid, day)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"date": day, "tasks": entries})
+	}
+}
+
+type focusMorningPayload struct {
+	Timezone string `json:"timezone"`
+	Day      string `json:"day"`
+}
+
+// startFocusScheduler encola, para cada zona horaria donde ya es la hora de la
+// mañana, un "focus.morning" por día. Con varias réplicas no se duplica: se
+// mira si ya hay uno (en cualquier estado) para esa zona y día.
+func startFocusScheduler(db *gorm.DB, every time.Duration) {
+	for range time.Tick(every) {
+		var zones []string
+		err := db.Model(&User{}).
+			Where("deactivated_at IS NULL AND id IN (SELECT user_id FROM focus_items WHERE day >= current_date - ?::int AND NOT suggested)", focusIdleDays).
+			Distinct().Pluck("timezone", &zones).Error
+		if err != nil {
+			log.Printf("[FOCUS] no pude leer las zonas: %v", err)
+			continue
+		}
+		for _, tz := range zones {
+			// Si el servidor arranca a media tarde, esa mañana ya pasó.
+			now := time.Now().In(userLocation(tz))
+			if now.Hour() < focusMorningHour || now.Hour() >= focusMorningHour+focusMorningWindow {
+				continue
+			}
+			p := focusMorningPayload{Timezone: tz, Day: now.Format(time.DateOnly)}
+			var n int64
+			db.Model(&Job{}).
+				Where("kind = ? AND payload->>'timezone' = ? AND payload->>'day' = ?", "focus.morning", p.Timezone, p.Day).
+				Count(&n)
+			if n > 0 {
+				continue
+			}
+			if _, err := enqueueJob(db, "focus.morning", p); err != nil {
+				log.Printf("[FOCUS] no pude encolar la mañana de %s: %v", tz, err)
+			}
+		}
+	}
+}
+
+// focusMorningJob propone la lista del día a los usuarios de una zona y les
+// manda el resumen. Repetirlo no duplica propuestas ni avisos.
+func focusMorningJob(ctx context.Context, db *gorm.DB, j Job) error {
+	var p focusMorningPayload
+	if err := json.Unmarshal([]byte(j.Payload), &p); err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	loc := userLocation(p.Timezone)
+	start, err := time.ParseInLocation(time.DateOnly, p.Day, loc)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	db = db.WithContext(ctx)
+	yesterday := start.AddDate(0, 0, -1).Format(time.DateOnly)
+	var uids []uint
+	err = db.Model(&User{}).
+		Where("timezone = ? AND deactivated_at IS NULL AND id IN (SELECT user_id FROM focus_items WHERE day >= ?::date - ?::int AND NOT suggested)",
+			p.Timezone, p.Day, focusIdleDays).
+		Pluck("id", &uids).Error
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		if err := suggestFocus(db, uid, p.Day, yesterday, start, start.AddDate(0, 0, 1)); err != nil {
+			return err
+		}
+	}
+	// Entradas viejas de todas las zonas: cualquier mañana vale para borrarlas.
+	// Las de cuentas en retención legal se quedan.
+	old := start.AddDate(0, 0, -focusKeepDays).Format(time.DateOnly)
+	var held []uint
+	db.Model(&FocusItem{}).Where("day < ? AND user_id IN (SELECT id FROM users WHERE legal_hold_at IS NOT NULL)", old).
+		Distinct().Pluck("user_id", &held)
+	for _, id := range held {
+		recordEvent(db, id, "legal_hold.blocked", nil, gin.H{"action": "focus.prune", "by": 0})
+	}
+	if err := db.Where("day < ? AND user_id NOT IN (SELECT id FROM users WHERE legal_hold_at IS NOT NULL)", old).Delete(&FocusItem{}).Error; err != nil {
+		log.Printf("[FOCUS] no pude borrar entradas viejas: %v", err)
+	}
+	return nil
+}
+
+// suggestFocus añade a day las tareas sin hacer de la lista de yesterday y las
+// que vencen en [from, to), y manda el resumen si hay algo nuevo.
+func suggestFocus(db *gorm.DB, uid uint, day, yesterday string, from, to time.Time) error {
+	var carry, due []uint
+	err := db.Model(&Task{}).
+		Where("user_id = ? AND NOT done AND id IN (SELECT task_id FROM focus_items WHERE user_id = ? AND day = ? AND NOT suggested)", uid, uid, yesterday).
+		Pluck("id", &carry).Error
+	if err != nil {
+		return err
+	}
+	err = db.Model(&Task{}).Where("user_id = ? AND NOT done AND due_at >= ? AND due_at < ?", uid, from, to).Pluck("id", &due).Error
+	if err != nil {
+		return err
+	}
+	items := make([]FocusItem, 0, len(carry)+len(due))
+	for _, id := range carry {
+		items = append(items, FocusItem{UserID: uid, Day: day, TaskID: id, Suggested: true, Reason: "carryover"})
+	}
+	for _, id := range due {
+		items = append(items, FocusItem{UserID: uid, Day: day, TaskID: id, Suggested: true, Reason: "due"})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&items)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil // ya se propuso (trabajo repetido)
+	}
+	entries, err := loadFocus(db, uid, day)
+	if err != nil {
+		return err
+	}
+	dispatchNotification(db, buildFocusDigest(uid, entries))
+	return nil
+}
+
+func buildFocusDigest(uid uint, entries []focusEntry) Notification {
+	n := Notification{UserID: uid, Priority: "low", Title: fmt.Sprintf("Mi día: %d tareas", len(entries))}
+	var b strings.Builder
+	for i, e := range entries {
+		if i == focusDigestMax {
+			fmt.Fprintf(&b, "… y %d más", len(entries)-focusDigestMax)
+			break
+		}
+		mark := "•"
+		if e.Suggested {
+			mark = "○" // propuesta, aún sin aceptar
+		}
+		fmt.Fprintf(&b, "%s %s\n", mark, e.Title)
+	}
+	n.Body = strings.TrimRight(b.String(), "\n")
+	return n
+}
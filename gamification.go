@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========= PUNTOS Y LOGROS =========
+//
+// Opcional (GAMIFICATION_ENABLED=true). Es un plugin más: al completar una
+// tarea suma puntos según la prioridad, con un 50% extra si se hizo antes de
+// due_at, y comprueba los logros. Desmarcarla quita sus puntos (así no se
+// ganan marcando y desmarcando); los logros, una vez conseguidos, se quedan.
+// Las tareas importadas ya hechas no puntúan.
+//
+// Subir de nivel y desbloquear un logro dejan un evento (level.up,
+// achievement.unlocked) en el registro y avisan por los canales del usuario.
+
+var gamificationEnabled = getEnv("GAMIFICATION_ENABLED", "false") == "true"
+
+var priorityPoints = map[string]int{"low": 5, "normal": 10, "high": 20}
+
+const (
+	onTimeBonus = 0.5
+	// levelStep: el nivel n empieza en levelStep * (n-1)^2 puntos.
+	levelStep = 50
+)
+
+// PointAward son los puntos de una tarea completada; uno por tarea.
+type PointAward struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"index;not null" json:"-"`
+	TaskID    uint      `gorm:"uniqueIndex;not null" json:"task_id"`
+	Points    int       `gorm:"not null" json:"points"`
+	OnTime    bool      `json:"on_time"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Achievement struct {
+	UserID     uint      `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	Code       string    `gorm:"primaryKey" json:"code"`
+	UnlockedAt time.Time `json:"unlocked_at"`
+}
+
+type scoreStats struct {
+	Points    int64 `json:"points"`
+	Completed int64 `json:"completed"`
+	OnTime    int64 `json:"on_time"`
+	High      int64 `json:"high_priority"`
+	Streak    int   `json:"streak"`
+}
+
+type achievementDef struct {
+	Code, Title, Description string
+	Reached                  func(s scoreStats) bool
+}
+
+var achievementDefs = []achievementDef{
+	{"first_task", "Primer paso", "Completa tu primera tarea", func(s scoreStats) bool { return s.Completed >= 1 }},
+	{"ten_tasks", "En marcha", "Completa 10 tareas", func(s scoreStats) bool { return s.Completed >= 10 }},
+	{"hundred_tasks", "Centenario", "Completa 100 tareas", func(s scoreStats) bool { return s.Completed >= 100 }},
+	{"punctual", "Puntual", "Completa 10 tareas antes de que venzan", func(s scoreStats) bool { return s.OnTime >= 10 }},
+	{"high_stakes", "Lo importante primero", "Completa 25 tareas de prioridad alta", func(s scoreStats) bool { return s.High >= 25 }},
+	{"week_streak", "Semana redonda", "Completa alguna tarea 7 días seguidos", func(s scoreStats) bool { return s.Streak >= 7 }},
+	{"level_5", "Nivel 5", "Llega al nivel 5", func(s scoreStats) bool { return levelFor(s.Points) >= 5 }},
+}
+
+func levelFor(points int64) int {
+	return 1 + int(math.Sqrt(float64(max(points, 0))/levelStep))
+}
+
+// taskPoints calcula lo que vale una tarea recién completada.
+func taskPoints(t Task) (int, bool) {
+	base, ok := priorityPoints[t.Priority]
+	if !ok {
+		base = priorityPoints["normal"]
+	}
+	onTime := t.DueAt != nil && t.CompletedAt != nil && !t.CompletedAt.After(*t.DueAt)
+	if onTime {
+		return base + int(float64(base)*onTimeBonus), true
+	}
+	return base, false
+}
+
+func loadScoreStats(db *gorm.DB, uid uint) (scoreStats, error) {
+	var s scoreStats
+	err := db.Raw(`SELECT COALESCE(sum(a.points), 0), count(*), count(*) FILTER (WHERE a.on_time),
+			count(*) FILTER (WHERE t.priority = 'high')
+		FROM point_awards a LEFT JOIN tasks t ON t.id = a.task_id
+		WHERE a.user_id = ?`, uid).Row().Scan(&s.Points, &s.Completed, &s.OnTime, &s.High)
+	if err != nil {
+		return s, err
+	}
+	var u User
+	if err := db.Select("id", "timezone").First(&u, uid).Error; err != nil {
+		return s, err
+	}
+	// Para la racha del logro basta con la última semana y pico.
+	loc := userLocation(u.Timezone)
+	var rows []struct{ Day time.Time }
+	err = db.Raw(`SELECT DISTINCT (completed_at AT TIME ZONE ?)::date AS day FROM tasks
+		WHERE user_id = ? AND completed_at > ? ORDER BY day DESC`,
+		loc.String(), uid, time.Now().AddDate(0, 0, -9)).Scan(&rows).Error
+	if err != nil {
+		return s, err
+	}
+	days := make([]time.Time, len(rows))
+	for i, r := range rows {
+		days[i] = r.Day
+	}
+	now := time.Now().In(loc)
+	s.Streak, _ = completionStreaks(days, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+	return s, nil
+}
+
+type gamificationPlugin struct {
+	db *gorm.DB
+}
+
+func (*gamificationPlugin) Name() string { return "gamification" }
+
+func (p *gamificationPlugin) OnTaskEvent(ctx context.Context, ev TaskEvent) {
+	if ev.Kind != TaskUpdated {
+		return
+	}
+	db := requestDB(p.db, ctx)
+	t := ev.Task
+	if !t.Done {
+		if err := db.Where("task_id = ?", t.ID).Delete(&PointAward{}).Error; err != nil {
+			log.Printf("[GAME] no pude quitar los puntos de la tarea %d: %v", t.ID, err)
+		}
+		return
+	}
+	before, err := loadScoreStats(db, t.UserID)
+	if err != nil {
+		log.Printf("[GAME] no pude leer la puntuación del user %d: %v", t.UserID, err)
+		return
+	}
+	points, onTime := taskPoints(t)
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&PointAward{UserID: t.UserID, TaskID: t.ID, Points: points, OnTime: onTime})
+	if res.Error != nil {
+		log.Printf("[GAME] no pude apuntar los puntos de la tarea %d: %v", t.ID, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		return
+	}
+	after, err := loadScoreStats(db, t.UserID)
+	if err != nil {
+		log.Printf("[GAME] no pude leer la puntuación del user %d: %v", t.UserID, err)
+		return
+	}
+	if lvl := levelFor(after.Points); lvl > levelFor(before.Points) {
+		recordEvent(db, t.UserID, "level.up", nil, gin.H{"level": lvl, "points": after.Points})
+		queueGameNotification(db, Notification{UserID: t.UserID, Priority: "low",
+			Title: fmt.Sprintf("¡Nivel %d!", lvl), Body: fmt.Sprintf("Llevas %d puntos.", after.Points)})
+	}
+	unlockAchievements(db, t.UserID, after)
+}
+
+func unlockAchievements(db *gorm.DB, uid uint, s scoreStats) {
+	for _, def := range achievementDefs {
+		if !def.Reached(s) {
+			continue
+		}
+		res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Achievement{UserID: uid, Code: def.Code, UnlockedAt: time.Now()})
+		if res.Error != nil {
+			log.Printf("[GAME] no pude guardar el logro %s del user %d: %v", def.Code, uid, res.Error)
+			continue
+		}
+		if res.RowsAffected == 1 {
+			recordEvent(db, uid, "achievement.unlocked", nil, gin.H{"code": def.Code, "title": def.Title})
+			queueGameNotification(db, Notification{UserID: uid, Priority: "low",
+				Title: "Logro desbloqueado: " + def.Title, Body: def.Description + "."})
+		}
+	}
+}
+
+func queueGameNotification(db *gorm.DB, n Notification) {
+	if _, err := enqueueJob(db, "gamification.notify", n); err != nil {
+		log.Printf("[GAME] no pude encolar el aviso del user %d: %v", n.UserID, err)
+	}
+}
+
+func gameNotifyJob(_ context.Context, db *gorm.DB, j Job) error {
+	var n Notification
+	if err := json.Unmarshal([]byte(j.Payload), &n); err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	dispatchNotification(db, n)
+	return nil
+}
+
+func (p *gamificationPlugin) RegisterRoutes(db *gorm.DB, _ *gin.Engine, api *gin.RouterGroup) {
+	api.GET("/me/score", scoreHandler(db))
+	api.GET("/me/achievements", achievementsHandler(db))
+}
+
+// scoreHandler: GET /api/me/score
+func scoreHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, err := loadScoreStats(db, c.GetUint("user_id"))
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		lvl := levelFor(s.Points)
+		c.JSON(200, gin.H{"level": lvl, "next_level_at": int64(levelStep * lvl * lvl), "stats": s})
+	}
+}
+
+type achievementView struct {
+	Code        string     `json:"code"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"`
+}
+
+// achievementsHandler: GET /api/me/achievements, todos los logros y cuáles
+// tiene ya el usuario.
+func achievementsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var got []Achievement
+		if err := db.Where("user_id = ?", c.GetUint("user_id")).Find(&got).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		unlocked := make(map[string]time.Time, len(got))
+		for _, a := range got {
+			unlocked[a.Code] = a.UnlockedAt
+		}
+		out := make([]achievementView, 0, len(achievementDefs))
+		for _, def := range achievementDefs {
+			v := achievementView{Code: def.Code, Title: def.Title, Description: def.Description}
+			if at, ok := unlocked[def.Code]; ok {
+				v.UnlockedAt = &at
+			}
+			out = append(out, v)
+		}
+		c.JSON(200, out)
+	}
+}
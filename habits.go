@@ -0,0 +1,408 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========= HÁBITOS =========
+//
+// Un hábito no vence: se repite con un objetivo de días por semana (7 =
+// diario) y se marca cada día que se cumple. También se puede saltar un día
+// (viaje, enfermedad): el día saltado no cuenta y rebaja el objetivo de esa
+// semana. La racha son las semanas seguidas, de lunes a domingo en la zona del
+// usuario, en que se cumplió el objetivo; la semana en curso suma en cuanto se
+// cumple y mientras no, no la rompe.
+//
+// GET /api/today junta lo del día: Mi día (focus.go), tareas que vencen hoy o
+// ya vencidas y los hábitos activos. Los hábitos salen también en GET /api/stats.
+
+// habitBackfillDays es cuánto hacia atrás se puede marcar un día olvidado.
+const habitBackfillDays = 7
+
+// habitStreakWeeks es hasta dónde se mira para la racha.
+const habitStreakWeeks = 53
+
+type Habit struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"index;not null" json:"user_id"`
+	Name          string     `gorm:"not null" json:"name"`
+	TargetPerWeek int        `gorm:"not null;default:7" json:"target_per_week"`
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// HabitCheckin es un día marcado (o saltado, con Skipped) de un hábito. Day es
+// la fecha en la zona del usuario, "2006-01-02".
+type HabitCheckin struct {
+	HabitID   uint   `gorm:"primaryKey;autoIncrement:false"`
+	Day       string `gorm:"primaryKey;type:date"`
+	UserID    uint   `gorm:"index;not null"`
+	Skipped   bool   `gorm:"not null;default:false"`
+	CreatedAt time.Time
+}
+
+func (h *Habit) validate() error {
+	h.Name = strings.TrimSpace(h.Name)
+	if h.Name == "" || len(h.Name) > 80 {
+		return errors.New("name requerido (máximo 80 caracteres)")
+	}
+	if h.TargetPerWeek < 1 || h.TargetPerWeek > 7 {
+		return errors.New("target_per_week debe estar entre 1 y 7")
+	}
+	return nil
+}
+
+// civilDay es la fecha de t en loc, a medianoche UTC para poder sumar días.
+func civilDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// weekStart devuelve el lunes de la semana de d.
+func weekStart(d time.Time) time.Time {
+	return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+}
+
+// habitStreak cuenta las semanas seguidas en que se cumplió el objetivo y
+// cuántos días van marcados esta semana. checkins va de "2006-01-02" a si el
+// día se saltó; since es el día en que se creó el hábito (los anteriores no
+// cuentan en su primera semana).
+func habitStreak(checkins map[string]bool, target int, since, today time.Time) (streak, thisWeek int) {
+	current := weekStart(today)
+	oldest := weekStart(since)
+	if limit := current.AddDate(0, 0, -7*habitStreakWeeks); oldest.Before(limit) {
+		oldest = limit
+	}
+	for w := current; !w.Before(oldest); w = w.AddDate(0, 0, -7) {
+		done, open := 0, 0
+		for i := 0; i < 7; i++ {
+			d := w.AddDate(0, 0, i)
+			skipped, ok := checkins[d.Format(time.DateOnly)]
+			switch {
+			case ok && !skipped:
+				done++
+				open++
+			case !ok && !d.Before(since):
+				open++
+			}
+		}
+		if w.Equal(current) {
+			thisWeek = done
+		}
+		if open == 0 {
+			continue // semana entera saltada: ni suma ni rompe
+		}
+		if done >= min(target, open) {
+			streak++
+		} else if !w.Equal(current) {
+			break
+		}
+	}
+	return streak, thisWeek
+}
+
+type habitView struct {
+	Habit
+	StreakWeeks int `json:"streak_weeks"`
+	ThisWeek    int `json:"this_week"`
+	// Today es "done", "skipped" o "".
+	Today string `json:"today"`
+}
+
+// loadHabitViews devuelve los hábitos de uid (solo activos si !archived) con su
+// racha.
+func loadHabitViews(db *gorm.DB, uid uint, loc *time.Location, archived bool) ([]habitView, error) {
+	q := db.Where("user_id = ?", uid)
+	if !archived {
+		q = q.Where("archived_at IS NULL")
+	}
+	var habits []Habit
+	if err := q.Order("id").Find(&habits).Error; err != nil {
+		return nil, err
+	}
+	return habitViews(db, loc, habits)
+}
+
+// habitViews calcula la racha de cada hábito con una sola consulta.
+func habitViews(db *gorm.DB, loc *time.Location, habits []Habit) ([]habitView, error) {
+	today := civilDay(time.Now(), loc)
+	byHabit := map[uint]map[string]bool{}
+	if len(habits) > 0 {
+		ids := make([]uint, len(habits))
+		for i, h := range habits {
+			ids[i] = h.ID
+		}
+		var rows []struct {
+			HabitID uint
+			Day     string
+			Skipped bool
+		}
+		err := db.Raw(`SELECT habit_id, to_char(day, 'YYYY-MM-DD') AS day, skipped FROM habit_checkins
+			WHERE habit_id IN ? AND day >= ?`, ids, weekStart(today).AddDate(0, 0, -7*habitStreakWeeks).Format(time.DateOnly)).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			if byHabit[r.HabitID] == nil {
+				byHabit[r.HabitID] = map[string]bool{}
+			}
+			byHabit[r.HabitID][r.Day] = r.Skipped
+		}
+	}
+	out := make([]habitView, 0, len(habits))
+	for _, h := range habits {
+		v := habitView{Habit: h}
+		checkins := byHabit[h.ID]
+		v.StreakWeeks, v.ThisWeek = habitStreak(checkins, h.TargetPerWeek, civilDay(h.CreatedAt, loc), today)
+		if skipped, ok := checkins[today.Format(time.DateOnly)]; ok {
+			v.Today = map[bool]string{false: "done", true: "skipped"}[skipped]
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func habitViewFor(c *gin.Context, db *gorm.DB, h Habit) (habitView, error) {
+	views, err := habitViews(db, userLocation(c.GetString("timezone")), []Habit{h})
+	if err != nil {
+		return habitView{}, err
+	}
+	return views[0], nil
+}
+
+func findHabit(c *gin.Context, db *gorm.DB) (Habit, bool) {
+	var h Habit
+	if err := db.Where("user_id = ? AND id = ?", c.GetUint("user_id"), c.Param("id")).First(&h).Error; err != nil {
+		c.JSON(404, gin.H{"error": "hábito no encontrado"})
+		return h, false
+	}
+	return h, true
+}
+
+func listHabitsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		views, err := loadHabitViews(db, c.GetUint("user_id"), userLocation(c.GetString("timezone")), c.Query("archived") == "true")
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, views)
+	}
+}
+
+func createHabitHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Name          string `json:"name" binding:"required"`
+		TargetPerWeek *int   `json:"target_per_week"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		h := Habit{UserID: c.GetUint("user_id"), Name: in.Name, TargetPerWeek: 7}
+		if in.TargetPerWeek != nil {
+			h.TargetPerWeek = *in.TargetPerWeek
+		}
+		if err := h.validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Create(&h).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(201, habitView{Habit: h})
+	}
+}
+
+func updateHabitHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Name          *string `json:"name"`
+		TargetPerWeek *int    `json:"target_per_week"`
+		Archived      *bool   `json:"archived"`
+	}
+	return func(c *gin.Context) {
+		h, ok := findHabit(c, db)
+		if !ok {
+			return
+		}
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if in.Name != nil {
+			h.Name = *in.Name
+		}
+		if in.TargetPerWeek != nil {
+			h.TargetPerWeek = *in.TargetPerWeek
+		}
+		if in.Archived != nil {
+			h.ArchivedAt = nil
+			if *in.Archived {
+				now := time.Now()
+				h.ArchivedAt = &now
+			}
+		}
+		if err := h.validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := db.Save(&h).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		v, err := habitViewFor(c, db, h)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, v)
+	}
+}
+
+func deleteHabitHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h, ok := findHabit(c, db)
+		if !ok {
+			return
+		}
+		if legalHoldBlocks(c, db, []uint{h.UserID}, "habit.delete") {
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("habit_id = ?", h.ID).Delete(&HabitCheckin{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&h).Error
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"deleted": c.Param("id")})
+	}
+}
+
+// checkinDay lee el día de la petición ("" = hoy en la zona del usuario) y
+// comprueba que no es futuro ni más viejo de habitBackfillDays.
+func checkinDay(c *gin.Context, raw string) (string, error) {
+	today := civilDay(time.Now(), userLocation(c.GetString("timezone")))
+	if raw == "" {
+		return today.Format(time.DateOnly), nil
+	}
+	d, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return "", errors.New("day debe ser una fecha 2006-01-02")
+	}
+	if d.After(today) || d.Before(today.AddDate(0, 0, -habitBackfillDays)) {
+		return "", errors.New("day debe estar entre hoy y hace 7 días")
+	}
+	return raw, nil
+}
+
+// checkinHabitHandler: POST /api/habits/:id/checkins {"day"?, "skipped"?}.
+// Marcar otra vez el mismo día solo cambia skipped.
+func checkinHabitHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Day     string `json:"day"`
+		Skipped bool   `json:"skipped"`
+	}
+	return func(c *gin.Context) {
+		h, ok := findHabit(c, db)
+		if !ok {
+			return
+		}
+		var in inT
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&in); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if h.ArchivedAt != nil {
+			c.JSON(409, gin.H{"error": "el hábito está archivado"})
+			return
+		}
+		day, err := checkinDay(c, in.Day)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		ci := HabitCheckin{HabitID: h.ID, Day: day, UserID: h.UserID, Skipped: in.Skipped}
+		err = db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "habit_id"}, {Name: "day"}},
+			DoUpdates: clause.AssignmentColumns([]string{"skipped"}),
+		}).Create(&ci).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		v, err := habitViewFor(c, db, h)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, v)
+	}
+}
+
+// uncheckHabitHandler: DELETE /api/habits/:id/checkins/:day
+func uncheckHabitHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h, ok := findHabit(c, db)
+		if !ok {
+			return
+		}
+		if _, err := time.Parse(time.DateOnly, c.Param("day")); err != nil {
+			c.JSON(400, gin.H{"error": "day debe ser una fecha 2006-01-02"})
+			return
+		}
+		if err := db.Where("habit_id = ? AND day = ?", h.ID, c.Param("day")).Delete(&HabitCheckin{}).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		v, err := habitViewFor(c, db, h)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, v)
+	}
+}
+
+// todayHandler: GET /api/today, lo que toca hoy en la zona del usuario.
+func todayHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		loc := userLocation(c.GetString("timezone"))
+		now := time.Now().In(loc)
+		endOfDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+		var tasks []Task
+		err := db.Where("user_id = ? AND NOT done AND due_at < ?", uid, endOfDay).Order("due_at").Find(&tasks).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		habits, err := loadHabitViews(db, uid, loc, false)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		focus, err := loadFocus(db, uid, now.Format(time.DateOnly))
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"date": now.Format(time.DateOnly), "timezone": loc.String(), "focus": focus, "tasks": tasks, "habits": habits})
+	}
+}
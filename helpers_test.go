@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newMockDB abre GORM sobre sqlmock: las consultas se comparan por regexp y,
+// si no hay expectativa para una, falla con error como lo haría la BD.
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger:                 logger.Discard,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock
+}
+
+// countQueries cuenta las sentencias que lanza db a partir de ahora, hayan
+// ido bien o no: una consulta de más que sqlmock rechaza también cuenta.
+func countQueries(t *testing.T, db *gorm.DB) *int {
+	t.Helper()
+	n := new(int)
+	count := func(*gorm.DB) { *n++ }
+	cb := db.Callback()
+	for name, err := range map[string]error{
+		"query":  cb.Query().After("gorm:query").Register("test:count", count),
+		"create": cb.Create().After("gorm:create").Register("test:count", count),
+		"update": cb.Update().After("gorm:update").Register("test:count", count),
+		"delete": cb.Delete().After("gorm:delete").Register("test:count", count),
+		"row":    cb.Row().After("gorm:row").Register("test:count", count),
+		"raw":    cb.Raw().After("gorm:raw").Register("test:count", count),
+	} {
+		if err != nil {
+			t.Fatalf("callback %s: %v", name, err)
+		}
+	}
+	return n
+}
+
+// expectActiveUser es la consulta de AuthMiddleware para una cuenta activa.
+func expectActiveUser(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT "timezone" FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"timezone"}).AddRow("UTC"))
+}
+
+func expectRole(mock sqlmock.Sqlmock, id uint, role string) {
+	mock.ExpectQuery(`SELECT "id","role" FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role"}).AddRow(id, role))
+}
+
+func sessionToken(t *testing.T, id uint) string {
+	t.Helper()
+	tok, err := issueToken(User{ID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func doRequest(r http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// benchDB abre TASKFLOW_BENCH_DSN (una base desechable: se migra) con openDB,
+// con o sin la caché de sentencias de GORM. Sin la variable, el benchmark se
+// salta: sqlmock no dice nada de cuánto tarda Postgres.
+func benchDB(b *testing.B, prepare bool) *gorm.DB {
+	b.Helper()
+	dsn := os.Getenv("TASKFLOW_BENCH_DSN")
+	if dsn == "" {
+		b.Skip("TASKFLOW_BENCH_DSN no definida")
+	}
+	b.Setenv("DB_PREPARE_STMT", strconv.FormatBool(prepare))
+	db, err := openDB(dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	db.Logger = logger.Discard
+	if err := runMigrations(db); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// benchUser crea un usuario con n tareas y lo borra al acabar.
+func benchUser(b *testing.B, db *gorm.DB, n int) User {
+	b.Helper()
+	u := User{Email: fmt.Sprintf("bench-%d@example.com", time.Now().UnixNano())}
+	if err := db.Create(&u).Error; err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { deleteAccounts(db, []uint{u.ID}, "bench", 0) })
+	tasks := make([]Task, n)
+	for i := range tasks {
+		tasks[i] = Task{UserID: u.ID, Title: fmt.Sprintf("tarea %d", i), Priority: "normal"}
+	}
+	if n > 0 {
+		if err := db.CreateInBatches(&tasks, 500).Error; err != nil {
+			b.Fatal(err)
+		}
+	}
+	return u
+}
+
+// asUser hace de AuthMiddleware para los handlers de /api.
+func asUser(u User) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", u.ID)
+		c.Set("timezone", "UTC")
+	}
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// recordingBlobStore apunta los borrados; el resto de métodos no se usa.
+type recordingBlobStore struct {
+	BlobStore
+	deleted []string
+}
+
+func (s *recordingBlobStore) Delete(_ context.Context, key string) error {
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func withRecordingBlobStore(t *testing.T) *recordingBlobStore {
+	t.Helper()
+	prev := blobStore
+	s := &recordingBlobStore{}
+	blobStore = s
+	t.Cleanup(func() { blobStore = prev })
+	return s
+}
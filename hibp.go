@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ========= PASSWORD BREACH CHECK =========
+//
+// Consulta HaveIBeenPwned con k-anonymity: solo se envían los 5 primeros
+// caracteres del SHA-1 y se compara el resto en local. HIBP_MODE:
+//   - off (por defecto): no se consulta.
+//   - warn: se acepta la contraseña pero la respuesta lleva "warning".
+//   - reject: se rechaza con 400.
+// Si el API no responde no bloqueamos el registro.
+
+var (
+	hibpMode     = getEnv("HIBP_MODE", "off")
+	hibpEndpoint = "https://api.pwnedpasswords.com/range/"
+	hibpClient   = &http.Client{Timeout: 5 * time.Second}
+	hibpCache    = &rangeCache{ttl: 24 * time.Hour, entries: map[string]rangeEntry{}}
+)
+
+const breachedPasswordMsg = "esta contraseña aparece en filtraciones públicas, elige otra"
+
+type rangeEntry struct {
+	suffixes map[string]int
+	fetched  time.Time
+}
+
+// rangeCache guarda las respuestas por prefijo; hay 16^5 posibles, así que la
+// limitamos y la vaciamos si crece demasiado.
+type rangeCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]rangeEntry
+}
+
+func (rc *rangeCache) get(prefix string) (map[string]int, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	e, ok := rc.entries[prefix]
+	if !ok || time.Since(e.fetched) > rc.ttl {
+		return nil, false
+	}
+	return e.suffixes, true
+}
+
+func (rc *rangeCache) put(prefix string, suffixes map[string]int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.entries) > 5000 {
+		rc.entries = map[string]rangeEntry{}
+	}
+	rc.entries[prefix] = rangeEntry{suffixes: suffixes, fetched: time.Now()}
+}
+
+func fetchRange(ctx context.Context, prefix string) (map[string]int, error) {
+	if s, ok := hibpCache.get(prefix); ok {
+		return s, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hibpEndpoint+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "taskflow-go")
+	resp, err := hibpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("hibp respondió %d", resp.StatusCode)
+	}
+	suffixes := map[string]int{}
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		suffix, count, ok := strings.Cut(strings.TrimSpace(sc.Text()), ":")
+		if !ok {
+			continue
+		}
+		// Con Add-Padding vienen entradas falsas con contador 0.
+		if n, _ := strconv.Atoi(count); n > 0 {
+			suffixes[suffix] = n
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	hibpCache.put(prefix, suffixes)
+	return suffixes, nil
+}
+
+// passwordBreached devuelve cuántas veces aparece la contraseña en HIBP.
+func passwordBreached(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := fetchRange(ctx, h[:5])
+	if err != nil {
+		return 0, err
+	}
+	return suffixes[h[5:]], nil
+}
+
+// checkBreachedPassword aplica HIBP_MODE. Devuelve rejected=true si hay que
+// rechazar, y un aviso para incluir en la respuesta en modo warn.
+func checkBreachedPassword(ctx context.Context, password string) (rejected bool, warning string) {
+	if hibpMode != "warn" && hibpMode != "reject" {
+		return false, ""
+	}
+	n, err := passwordBreached(ctx, password)
+	if err != nil {
+		log.Printf("[HIBP] no se pudo comprobar la contraseña: %v", err)
+		return false, ""
+	}
+	if n == 0 {
+		return false, ""
+	}
+	if hibpMode == "reject" {
+		return true, ""
+	}
+	return false, breachedPasswordMsg
+}
+
+func changePasswordHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required,min=6"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var u User
+		if err := db.First(&u, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		if !checkPassword(&u, in.CurrentPassword) {
+			c.JSON(401, gin.H{"error": "contraseña actual incorrecta"})
+			return
+		}
+		rejected, warning := checkBreachedPassword(c.Request.Context(), in.NewPassword)
+		if rejected {
+			c.JSON(400, gin.H{"error": breachedPasswordMsg})
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(in.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "no se pudo guardar la contraseña"})
+			return
+		}
+		if err := db.Model(&u).Update("password_hash", string(hash)).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		resp := gin.H{"changed": true}
+		if warning != "" {
+			resp["warning"] = warning
+		}
+		c.JSON(200, resp)
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= IMPORTS =========
+//
+// POST /api/tasks/import valida el fichero, lo guarda en el BlobStore y encola
+// un trabajo "import.tasks". El trabajo inserta por trozos de
+// IMPORT_BATCH_SIZE filas (500 por defecto), cada trozo en su propia
+// transacción junto con el avance (Processed). Si el proceso muere a mitad, el
+// reintento sigue desde el último trozo confirmado: ni se duplican tareas ni se
+// bloquea la tabla durante toda la importación.
+//
+// Es un trabajo pesado (ver jobguard.go): antes de cargar el fichero reserva
+// unas importMemoryFactor veces su tamaño del presupuesto de memoria, y se
+// puede cancelar con POST /api/imports/:id/cancel. Lo ya importado se queda.
+
+const (
+	ImportPending  = "pending"
+	ImportRunning  = "running"
+	ImportDone     = "done"
+	ImportFailed   = "failed"
+	ImportCanceled = "canceled"
+)
+
+type Import struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Source     string     `gorm:"not null" json:"source"`
+	Status     string     `gorm:"not null" json:"status"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Imported   int        `json:"imported"`
+	Skipped    int        `json:"skipped"`
+	Error      string     `json:"error,omitempty"`
+	BlobKey    string     `json:"-"`
+	BlobSize   int64      `json:"-"` // cuenta para la cuota de almacenamiento
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// importRow es una tarea ya normalizada, independiente del formato de origen.
+type importRow struct {
+	Title    string     `json:"title"`
+	Done     bool       `json:"done,omitempty"`
+	Priority string     `json:"priority,omitempty"`
+	DueAt    *time.Time `json:"due_at,omitempty"`
+}
+
+var (
+	importBatchSize = getEnvInt("IMPORT_BATCH_SIZE", 500)
+	importMaxBytes  = int64(getEnvInt("IMPORT_MAX_MB", 20)) << 20
+)
+
+// importMemoryFactor: las filas ya decodificadas ocupan unas cuantas veces lo
+// que el JSON del fichero.
+const importMemoryFactor = 4
+
+// parseImport lee el fichero según format: "json" (array de tareas como en
+// POST /api/tasks) o "todoist" (CSV exportado de Todoist).
+func parseImport(format string, r io.Reader) ([]importRow, error) {
+	switch format {
+	case "json":
+		var in []struct {
+			Title    string  `json:"title"`
+			Done     bool    `json:"done"`
+			Priority string  `json:"priority"`
+			DueAt    *string `json:"due_at"`
+		}
+		if err := json.NewDecoder(r).Decode(&in); err != nil {
+			return nil, err
+		}
+		rows := make([]importRow, 0, len(in))
+		for i, t := range in {
+			row := importRow{Title: strings.TrimSpace(t.Title), Done: t.Done, Priority: t.Priority}
+			if row.Priority != "" && !validPriorities[row.Priority] {
+				return nil, fmt.Errorf("fila %d: priority debe ser low, normal o high", i+1)
+			}
+			if t.DueAt != nil && *t.DueAt != "" {
+				due, err := time.Parse(time.RFC3339, *t.DueAt)
+				if err != nil {
+					return nil, fmt.Errorf("fila %d: due_at no es RFC3339", i+1)
+				}
+				row.DueAt = &due
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	case "todoist":
+		return parseTodoistCSV(r)
+	default:
+		return nil, errors.New("format debe ser json o todoist")
+	}
+}
+
+// parseTodoistCSV usa las columnas TYPE, CONTENT, PRIORITY y DATE. Solo se
+// importan las filas TYPE=task; las fechas en lenguaje natural ("every
+// monday") no se pueden traducir y se ignoran. PRIORITY sigue la numeración
+// de la app de Todoist: 1 es la más alta.
+func parseTodoistCSV(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CSV sin cabecera: %w", err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	if _, ok := col["CONTENT"]; !ok {
+		return nil, errors.New("el CSV no tiene columna CONTENT")
+	}
+	get := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	var rows []importRow
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t := get(rec, "TYPE"); t != "" && t != "task" {
+			continue
+		}
+		row := importRow{Title: get(rec, "CONTENT")}
+		switch get(rec, "PRIORITY") {
+		case "1":
+			row.Priority = "high"
+		case "4":
+			row.Priority = "low"
+		}
+		row.DueAt = parseLooseDate(get(rec, "DATE"))
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseLooseDate(s string) *time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// importTasksHandler: POST /api/tasks/import?format=json|todoist (fichero en el cuerpo)
+func importTasksHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		format := c.DefaultQuery("format", "json")
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, importMaxBytes)
+		rows, err := parseImport(format, body)
+		if err != nil {
+			var tooBig *http.MaxBytesError
+			if errors.As(err, &tooBig) {
+				c.JSON(413, gin.H{"error": fmt.Sprintf("el fichero supera %d MB", importMaxBytes>>20)})
+				return
+			}
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if len(rows) == 0 {
+			c.JSON(400, gin.H{"error": "no hay tareas que importar"})
+			return
+		}
+		// Mejor rechazarla entera ahora que dejarla a medias al llegar al límite.
+		if left, err := taskQuotaHeadroom(db, uid); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		} else if left >= 0 && int64(len(rows)) > left {
+			c.JSON(403, gin.H{"error": fmt.Sprintf("la importación trae %d tareas y solo te quedan %d", len(rows), left), "limit": quotaTasks})
+			return
+		}
+		raw, _ := json.Marshal(rows)
+		if left, err := storageHeadroom(db, uid); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		} else if left >= 0 && int64(len(raw)) > left {
+			c.JSON(403, gin.H{"error": "no te queda espacio para el fichero de la importación", "limit_mb": quotaStorageMB})
+			return
+		}
+		imp := Import{UserID: uid, Source: format, Status: ImportPending, Total: len(rows)}
+		if err := db.Create(&imp).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		imp.BlobKey = fmt.Sprintf("imports/%d/%d.json", uid, imp.ID)
+		if err := blobStore.Put(c.Request.Context(), imp.BlobKey, strings.NewReader(string(raw)), int64(len(raw)), "application/json"); err != nil {
+			db.Delete(&imp)
+			c.JSON(500, gin.H{"error": "no pude guardar el fichero"})
+			return
+		}
+		imp.BlobSize = int64(len(raw))
+		db.Model(&imp).Updates(map[string]any{"blob_key": imp.BlobKey, "blob_size": imp.BlobSize})
+		checkStorageQuota(db, uid)
+		if _, err := enqueueJob(requestDB(db, c.Request.Context()), "import.tasks", gin.H{"import_id": imp.ID}); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(202, imp)
+	}
+}
+
+// getImportHandler: GET /api/imports/:id, para seguir el progreso.
+func getImportHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var imp Import
+		if err := db.Where("user_id = ? AND id = ?", c.GetUint("user_id"), c.Param("id")).First(&imp).Error; err != nil {
+			c.JSON(404, gin.H{"error": "importación no encontrada"})
+			return
+		}
+		c.JSON(200, imp)
+	}
+}
+
+func runImportJob(ctx context.Context, db *gorm.DB, j Job) error {
+	var p struct {
+		ImportID uint `json:"import_id"`
+	}
+	if err := json.Unmarshal([]byte(j.Payload), &p); err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	var imp Import
+	if err := db.First(&imp, p.ImportID).Error; err != nil {
+		return fmt.Errorf("%w: importación %d: %v", errPermanent, p.ImportID, err)
+	}
+	if imp.Status == ImportDone || imp.Status == ImportFailed || imp.Status == ImportCanceled {
+		return nil
+	}
+	if jobCanceled(ctx) {
+		return cancelImport(ctx, db, &imp)
+	}
+	release, err := reserveJobMemory(imp.BlobSize * importMemoryFactor)
+	if err != nil {
+		return err
+	}
+	defer release()
+	db.Model(&imp).Update("status", ImportRunning)
+
+	rows, err := loadImportRows(ctx, imp.BlobKey)
+	if err != nil {
+		if jobCanceled(ctx) {
+			return cancelImport(ctx, db, &imp)
+		}
+		if errors.Is(err, errBlobNotFound) {
+			failImport(db, &imp, "el fichero de la importación ya no existe")
+			return fmt.Errorf("%w: %v", errPermanent, err)
+		}
+		return err
+	}
+
+	for imp.Processed < len(rows) {
+		if jobCanceled(ctx) {
+			return cancelImport(ctx, db, &imp)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := min(imp.Processed+importBatchSize, len(rows))
+		tasks := make([]Task, 0, end-imp.Processed)
+		for _, row := range rows[imp.Processed:end] {
+			t := Task{UserID: imp.UserID, Title: row.Title, Done: row.Done, Priority: row.Priority, DueAt: row.DueAt}
+			if t.Priority == "" {
+				t.Priority = "normal"
+			}
+			if t.Done {
+				now := time.Now()
+				t.CompletedAt = &now
+			}
+			// Las mismas reglas que un alta normal; lo rechazado se cuenta como omitido.
+			if t.Title == "" || runBeforeTaskSave(ctx, &t) != nil {
+				continue
+			}
+			tasks = append(tasks, t)
+		}
+		skipped := (end - imp.Processed) - len(tasks)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if len(tasks) > 0 {
+				if err := tx.CreateInBatches(&tasks, importBatchSize).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&Import{}).Where("id = ?", imp.ID).Updates(map[string]any{
+				"processed": end,
+				"imported":  gorm.Expr("imported + ?", len(tasks)),
+				"skipped":   gorm.Expr("skipped + ?", skipped),
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+		imp.Processed = end
+		imp.Imported += len(tasks)
+		imp.Skipped += skipped
+		reportJobProgress(db, j.ID, imp.Processed, len(rows))
+		for _, t := range tasks {
+			if t.DueAt != nil && !t.Done && t.DueAt.After(time.Now()) {
+				reminders.Schedule(t)
+			}
+		}
+	}
+
+	now := time.Now()
+	db.Model(&imp).Updates(map[string]any{"status": ImportDone, "finished_at": now})
+	checkTaskQuota(db, imp.UserID)
+	if err := releaseImportBlob(ctx, db, &imp); err != nil {
+		log.Printf("[IMPORT] #%d: no pude borrar %s: %v", imp.ID, imp.BlobKey, err)
+	}
+	recordEvent(db, imp.UserID, "tasks.imported", nil, gin.H{"import_id": imp.ID, "source": imp.Source, "imported": imp.Imported, "skipped": imp.Skipped})
+	log.Printf("[IMPORT] #%d: %d tareas importadas, %d omitidas", imp.ID, imp.Imported, imp.Skipped)
+	return nil
+}
+
+func loadImportRows(ctx context.Context, key string) ([]importRow, error) {
+	rc, err := blobStore.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var rows []importRow
+	if err := json.NewDecoder(rc).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	return rows, nil
+}
+
+// cancelImport cierra una importación cancelada; lo importado hasta ahí se
+// queda. Devuelve errJobCanceled para que el trabajo acabe como cancelado.
+func cancelImport(ctx context.Context, db *gorm.DB, imp *Import) error {
+	ctx = context.WithoutCancel(ctx)
+	now := time.Now()
+	db.Model(imp).Updates(map[string]any{"status": ImportCanceled, "finished_at": now})
+	if err := releaseImportBlob(ctx, db, imp); err != nil {
+		log.Printf("[IMPORT] #%d: no pude borrar %s: %v", imp.ID, imp.BlobKey, err)
+	}
+	recordEvent(db, imp.UserID, "tasks.import_canceled", nil, gin.H{"import_id": imp.ID, "imported": imp.Imported, "processed": imp.Processed})
+	log.Printf("[IMPORT] #%d: cancelada tras %d de %d filas", imp.ID, imp.Processed, imp.Total)
+	return errJobCanceled
+}
+
+// cancelImportHandler: POST /api/imports/:id/cancel
+func cancelImportHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var imp Import
+		if err := db.Where("user_id = ? AND id = ?", c.GetUint("user_id"), c.Param("id")).First(&imp).Error; err != nil {
+			c.JSON(404, gin.H{"error": "importación no encontrada"})
+			return
+		}
+		var j Job
+		err := db.Where("kind = ? AND payload->>'import_id' = ? AND status IN ?",
+			"import.tasks", strconv.FormatUint(uint64(imp.ID), 10), []string{JobPending, JobRunning}).
+			Order("id desc").First(&j).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(409, gin.H{"error": "la importación ya terminó"})
+			return
+		}
+		if err == nil {
+			err = cancelJob(db, &j)
+		}
+		if errors.Is(err, errJobFinished) {
+			c.JSON(409, gin.H{"error": "la importación ya terminó"})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(202, imp)
+	}
+}
+
+// importJobFailed cierra la importación de un trabajo que agotó los
+// intentos: los errores pasajeros (BD caída, blob store sin responder) no la
+// marcan como fallida, y sin esto se quedaría "running". El detalle va al log
+// del trabajo.
+func importJobFailed(db *gorm.DB, j Job, _ error) {
+	var p struct {
+		ImportID uint `json:"import_id"`
+	}
+	if json.Unmarshal([]byte(j.Payload), &p) != nil {
+		return
+	}
+	var imp Import
+	if err := db.First(&imp, p.ImportID).Error; err != nil {
+		return
+	}
+	if imp.Status == ImportDone || imp.Status == ImportFailed || imp.Status == ImportCanceled {
+		return
+	}
+	failImport(db, &imp, "la importación falló tras varios intentos")
+}
+
+func failImport(db *gorm.DB, imp *Import, msg string) {
+	now := time.Now()
+	db.Model(imp).Updates(map[string]any{"status": ImportFailed, "error": msg, "finished_at": now})
+}
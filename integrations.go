@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= INTEGRACIONES =========
+//
+// Estado de los servicios conectados (hoy, los canales de notificación) para
+// que el usuario vea por qué no le llega nada sin abrir un ticket. Cada envío
+// deja su resultado en el canal (último éxito, último error) y cada fallo un
+// evento "channel.failed" en el registro, del que salen los errores recientes.
+
+const integrationErrorWindow = 7 * 24 * time.Hour
+
+type Integration struct {
+	ID            uint       `json:"id"`
+	Kind          string     `json:"kind"`
+	Enabled       bool       `json:"enabled"`
+	Status        string     `json:"status"` // ok | failing | disabled | unavailable | unknown
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	RecentErrors  int        `json:"recent_errors"`
+}
+
+// recordChannelResult guarda el resultado de un envío por ch. Un envío
+// saltado (errNotifySkipped) no cuenta.
+func recordChannelResult(db *gorm.DB, ch NotificationChannel, sendErr error) {
+	if errors.Is(sendErr, errNotifySkipped) {
+		return
+	}
+	now := time.Now()
+	updates := map[string]any{"last_success_at": now}
+	if sendErr != nil {
+		msg := channelErrorSummary(sendErr)
+		updates = map[string]any{"last_error_at": now, "last_error": truncate(msg, 500)}
+		recordEvent(db, ch.UserID, "channel.failed", nil, gin.H{"channel_id": ch.ID, "kind": ch.Kind, "error": msg})
+	}
+	if err := db.Model(&NotificationChannel{}).Where("id = ?", ch.ID).Updates(updates).Error; err != nil {
+		log.Printf("[NOTIFY] no pude guardar el estado del canal #%d: %v", ch.ID, err)
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// integrationFor resume un canal. u hace falta para los canales que dependen
+// de la cuenta (email suprimido, teléfono sin verificar).
+func integrationFor(ch NotificationChannel, u User, recentErrors int) Integration {
+	in := Integration{
+		ID:            ch.ID,
+		Kind:          ch.Kind,
+		Enabled:       ch.Enabled,
+		LastSuccessAt: ch.LastSuccessAt,
+		LastErrorAt:   ch.LastErrorAt,
+		LastError:     ch.LastError,
+		RecentErrors:  recentErrors,
+	}
+	_, available := notifiers[ch.Kind]
+	switch {
+	case !available:
+		in.Status = "unavailable"
+	case !ch.Enabled:
+		in.Status = "disabled"
+	case ch.Kind == "email" && u.EmailUndeliverableAt != nil:
+		in.Status, in.LastError = "failing", "dirección suprimida por "+u.EmailSuppressionReason
+	case ch.Kind == "sms" && !u.PhoneVerified:
+		in.Status, in.LastError = "failing", "teléfono sin verificar"
+	case ch.LastErrorAt != nil && (ch.LastSuccessAt == nil || ch.LastErrorAt.After(*ch.LastSuccessAt)):
+		in.Status = "failing"
+	case ch.LastSuccessAt != nil:
+		in.Status = "ok"
+	default:
+		in.Status = "unknown"
+	}
+	return in
+}
+
+// recentChannelErrors cuenta los fallos por canal dentro de la ventana.
+func recentChannelErrors(db *gorm.DB, uid uint) (map[uint]int, error) {
+	var rows []struct {
+		ChannelID uint
+		N         int
+	}
+	err := db.Model(&Event{}).
+		Select("(data->>'channel_id')::bigint AS channel_id, count(*) AS n").
+		Where("user_id = ? AND kind = ? AND created_at > ?", uid, "channel.failed", time.Now().Add(-integrationErrorWindow)).
+		Group("channel_id").
+		Scan(&rows).Error
+	out := map[uint]int{}
+	for _, r := range rows {
+		out[r.ChannelID] = r.N
+	}
+	return out, err
+}
+
+func listIntegrationsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		var u User
+		if err := db.First(&u, uid).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		var chans []NotificationChannel
+		if err := db.Where("user_id = ?", uid).Order("id").Find(&chans).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		errs, err := recentChannelErrors(db, uid)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		out := make([]Integration, 0, len(chans))
+		for _, ch := range chans {
+			out = append(out, integrationFor(ch, u, errs[ch.ID]))
+		}
+		c.JSON(200, out)
+	}
+}
+
+// reconnectIntegrationHandler vuelve a activar un canal y lo prueba. En el
+// canal de email también levanta la supresión por rebote: el usuario dice
+// que la dirección vuelve a funcionar.
+func reconnectIntegrationHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		var u User
+		if err := db.First(&u, uid).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		var ch NotificationChannel
+		if err := db.Where("user_id = ? AND id = ?", uid, c.Param("id")).First(&ch).Error; err != nil {
+			c.JSON(404, gin.H{"error": "canal no encontrado"})
+			return
+		}
+		if ch.Kind == "email" && u.EmailUndeliverableAt != nil {
+			u.EmailUndeliverableAt, u.EmailSuppressionReason = nil, ""
+			if err := db.Model(&u).Updates(map[string]any{"email_undeliverable_at": nil, "email_suppression_reason": ""}).Error; err != nil {
+				c.JSON(500, gin.H{"error": "db error"})
+				return
+			}
+		}
+		if err := db.Model(&ch).Update("enabled", true).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+		n := Notification{UserID: uid, Priority: "high", Title: "TaskFlow", Body: "Canal reconectado: las notificaciones vuelven a llegar aquí."}
+		sendErr := sendToChannel(ctx, ch, n)
+		recordChannelResult(db, ch, sendErr)
+		db.First(&ch, ch.ID)
+		errs, _ := recentChannelErrors(db, uid)
+		in := integrationFor(ch, u, errs[ch.ID])
+		if sendErr != nil {
+			log.Printf("[NOTIFY] reconexión del canal #%d (%s) falló: %v", ch.ID, ch.Kind, sendErr)
+			c.JSON(502, gin.H{"error": channelErrorSummary(sendErr), "integration": in})
+			return
+		}
+		c.JSON(200, in)
+	}
+}
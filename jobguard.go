@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= LÍMITES DE TRABAJOS PESADOS =========
+//
+// Cada réplica corre JOB_WORKERS (4) workers, pero los trabajos pesados
+// (importaciones, reconstruir índices, la comprobación de consistencia) solo
+// pueden ocupar JOB_HEAVY_CONCURRENCY (1) a la vez: el resto de workers sigue
+// con lo ligero y una importación enorme no retrasa los recordatorios.
+//
+// Además, los que cargan ficheros en memoria reservan antes lo que calculan
+// que van a usar contra JOB_MEMORY_BUDGET_MB (256) por réplica. Si no cabe, el
+// trabajo vuelve a la cola sin gastar intento; si él solo ya supera el
+// presupuesto, espera a correr sin nadie más.
+//
+// Los pesados se pueden cancelar (POST /admin/jobs/:id/cancel; el usuario,
+// sus importaciones con POST /api/imports/:id/cancel) y apuntan su avance en
+// progress_done / progress_total.
+
+var (
+	jobWorkers          = max(getEnvInt("JOB_WORKERS", 4), 1)
+	heavyJobConcurrency = max(getEnvInt("JOB_HEAVY_CONCURRENCY", 1), 1)
+	jobMemoryBudget     = int64(getEnvInt("JOB_MEMORY_BUDGET_MB", 256)) << 20
+)
+
+var heavyJobKinds = map[string]bool{
+	"import.tasks":      true,
+	"search.reindex":    true,
+	"consistency.check": true,
+}
+
+const (
+	// jobCancelPoll es cada cuánto mira un trabajo pesado si se pidió cancelarlo.
+	jobCancelPoll = 2 * time.Second
+	// jobDeferDelay es lo que espera un trabajo que no cupo en memoria.
+	jobDeferDelay = 15 * time.Second
+)
+
+var (
+	// errJobDeferred devuelve el trabajo a la cola sin contar el intento.
+	errJobDeferred = errors.New("sin memoria libre para el trabajo, se aplaza")
+	errJobCanceled = errors.New("cancelado")
+)
+
+type jobSlots struct {
+	mu       sync.Mutex
+	heavy    int
+	reserved int64
+}
+
+var heavySlots = &jobSlots{}
+
+func (s *jobSlots) acquireHeavy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.heavy >= heavyJobConcurrency {
+		return false
+	}
+	s.heavy++
+	return true
+}
+
+func (s *jobSlots) releaseHeavy() {
+	s.mu.Lock()
+	s.heavy--
+	s.mu.Unlock()
+}
+
+// reserveJobMemory aparta n bytes del presupuesto; hay que llamar a release
+// al terminar. Con el presupuesto lleno devuelve errJobDeferred.
+func reserveJobMemory(n int64) (release func(), err error) {
+	s := heavySlots
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reserved > 0 && s.reserved+n > jobMemoryBudget {
+		return nil, errJobDeferred
+	}
+	s.reserved += n
+	return func() {
+		s.mu.Lock()
+		s.reserved -= n
+		s.mu.Unlock()
+	}, nil
+}
+
+func heavyKindList() []string {
+	kinds := make([]string, 0, len(heavyJobKinds))
+	for k := range heavyJobKinds {
+		kinds = append(kinds, k)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+// watchJobCancel cancela ctx (con causa errJobCanceled) cuando alguien pide
+// cancelar el trabajo id, esté en esta réplica o no. stop lo para.
+func watchJobCancel(db *gorm.DB, id uint, cancel context.CancelCauseFunc) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(jobCancelPoll)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if jobCancelRequested(db, id) {
+					cancel(errJobCanceled)
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func jobCancelRequested(db *gorm.DB, id uint) bool {
+	var requested []bool
+	db.Model(&Job{}).Where("id = ?", id).Pluck("cancel_requested", &requested)
+	return len(requested) == 1 && requested[0]
+}
+
+// jobCanceled indica si ctx se canceló porque alguien canceló el trabajo.
+func jobCanceled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errJobCanceled)
+}
+
+// reportJobProgress apunta el avance de un trabajo; los fallos solo se pierden.
+func reportJobProgress(db *gorm.DB, id uint, done, total int) {
+	db.Model(&Job{}).Where("id = ?", id).Updates(map[string]any{"progress_done": done, "progress_total": total})
+}
+
+var (
+	errJobNotCancelable = errors.New("este tipo de trabajo no se puede cancelar")
+	errJobFinished      = errors.New("el trabajo ya terminó")
+)
+
+// cancelJob pide cancelar un trabajo pesado. El que está en cola lo recoge
+// enseguida cualquier worker, que lo cierra sin hacer nada; el que está
+// corriendo se entera en unos segundos.
+func cancelJob(db *gorm.DB, j *Job) error {
+	if !heavyJobKinds[j.Kind] {
+		return errJobNotCancelable
+	}
+	res := db.Model(&Job{}).Where("id = ? AND status IN ?", j.ID, []string{JobPending, JobRunning}).
+		Updates(map[string]any{"cancel_requested": true, "run_at": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errJobFinished
+	}
+	j.CancelRequested = true
+	return nil
+}
+
+func cancelJobResponse(c *gin.Context, j Job, err error) {
+	switch {
+	case errors.Is(err, errJobNotCancelable), errors.Is(err, errJobFinished):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(500, gin.H{"error": "db error"})
+	default:
+		c.JSON(202, j)
+	}
+}
+
+// adminGetJobHandler: GET /admin/jobs/:id, con su avance.
+func adminGetJobHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var j Job
+		if err := db.First(&j, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "trabajo no encontrado"})
+			return
+		}
+		c.JSON(200, j)
+	}
+}
+
+// adminCancelJobHandler: POST /admin/jobs/:id/cancel
+func adminCancelJobHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var j Job
+		if err := db.First(&j, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "trabajo no encontrado"})
+			return
+		}
+		cancelJobResponse(c, j, cancelJob(db, &j))
+	}
+}
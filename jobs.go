@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========= JOB QUEUE =========
+//
+// Cola de trabajos en Postgres. Los workers reclaman trabajos con
+// FOR UPDATE SKIP LOCKED, así que pueden correr varias réplicas a la vez.
+// Un trabajo que falla se reintenta con espera exponencial hasta MaxAttempts.
+// Cuántos workers hay y cuánto pueden ocupar los trabajos pesados está en
+// jobguard.go.
+
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+	// JobCanceled: un trabajo pesado que se canceló (ver jobguard.go).
+	JobCanceled = "canceled"
+)
+
+const (
+	// jobTimeout es lo que puede durar un trabajo: después se cancela su ctx.
+	jobTimeout = 5 * time.Minute
+	// jobStuckAfter es cuándo un "running" se da por huérfano y vuelve a la
+	// cola. Tiene que ser mayor que jobTimeout o un trabajo vivo y lento se
+	// correría dos veces; el margen cubre al handler que tarda en soltar tras
+	// la cancelación y el guardado del resultado.
+	jobStuckAfter = jobTimeout + 5*time.Minute
+)
+
+type Job struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Kind        string     `gorm:"index;not null" json:"kind"`
+	Payload     string     `gorm:"type:jsonb;not null" json:"payload"`
+	Status      string     `gorm:"not null;index:idx_jobs_status_run_at,priority:1" json:"status"`
+	RunAt       time.Time  `gorm:"not null;index:idx_jobs_status_run_at,priority:2" json:"run_at"`
+	Attempts    int        `gorm:"not null" json:"attempts"`
+	MaxAttempts int        `gorm:"not null" json:"max_attempts"`
+	LockedAt    *time.Time `json:"locked_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	// Petición que lo encoló (X-Request-ID), si vino de una.
+	RequestID string `gorm:"index" json:"request_id,omitempty"`
+	// Solo en los trabajos pesados (ver jobguard.go).
+	CancelRequested bool      `gorm:"not null;default:false" json:"cancel_requested,omitempty"`
+	ProgressDone    int       `json:"progress_done,omitempty"`
+	ProgressTotal   int       `json:"progress_total,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type jobHandler func(ctx context.Context, db *gorm.DB, job Job) error
+
+var jobHandlers = map[string]jobHandler{}
+
+func registerJobHandler(kind string, h jobHandler) {
+	jobHandlers[kind] = h
+}
+
+// jobFailHooks se llaman cuando un trabajo falla definitivamente (error
+// permanente o último intento), para que deje en orden lo que llevaba: una
+// importación que se quedaría "running" para siempre, por ejemplo.
+var jobFailHooks = map[string]func(db *gorm.DB, j Job, err error){}
+
+func registerJobFailHook(kind string, h func(db *gorm.DB, j Job, err error)) {
+	jobFailHooks[kind] = h
+}
+
+// errPermanent marca errores que no tiene sentido reintentar.
+var errPermanent = errors.New("error permanente")
+
+// enqueueJob guarda un trabajo para ejecutarse lo antes posible.
+func enqueueJob(db *gorm.DB, kind string, payload any) (Job, error) {
+	return enqueueJobAt(db, kind, payload, time.Now())
+}
+
+func enqueueJobAt(db *gorm.DB, kind string, payload any, runAt time.Time) (Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, err
+	}
+	j := Job{Kind: kind, Payload: string(raw), Status: JobPending, RunAt: runAt, MaxAttempts: 5, RequestID: dbRequestID(db)}
+	return j, db.Create(&j).Error
+}
+
+// claimJob marca como running el siguiente trabajo pendiente, si lo hay. Sin
+// heavy no coge trabajos pesados, salvo los que hay que cancelar.
+func claimJob(db *gorm.DB, heavy bool) (*Job, error) {
+	var j Job
+	err := db.Transaction(func(tx *gorm.DB) error {
+		q := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND run_at <= ?", JobPending, time.Now())
+		if !heavy {
+			q = q.Where("(kind NOT IN ? OR cancel_requested)", heavyKindList())
+		}
+		err := q.Order("run_at").First(&j).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		j.Status, j.LockedAt = JobRunning, &now
+		j.Attempts++
+		return tx.Save(&j).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func runJob(db *gorm.DB, j *Job) {
+	h, ok := jobHandlers[j.Kind]
+	var err error
+	canceled := false
+	if !ok {
+		err = fmt.Errorf("%w: tipo de trabajo desconocido %q", errPermanent, j.Kind)
+	} else {
+		ctx, cancel := context.WithTimeout(withRequestID(context.Background(), j.RequestID), jobTimeout)
+		ctx, abort := context.WithCancelCause(ctx)
+		// Uno cancelado mientras esperaba corre igual, con el contexto ya
+		// cancelado, para que su handler deje las cosas en orden.
+		if j.CancelRequested {
+			abort(errJobCanceled)
+		}
+		stop := func() {}
+		if heavyJobKinds[j.Kind] {
+			stop = watchJobCancel(db, j.ID, abort)
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			err = h(ctx, db, *j)
+		}()
+		stop()
+		canceled = jobCanceled(ctx)
+		abort(nil)
+		cancel()
+	}
+	j.LockedAt = nil
+	switch {
+	case err == nil:
+		j.Status, j.LastError = JobDone, ""
+	case canceled || errors.Is(err, errJobCanceled):
+		j.Status, j.LastError = JobCanceled, errJobCanceled.Error()
+		log.Printf("[JOBS] #%d %s cancelado (req=%s)", j.ID, j.Kind, j.RequestID)
+	case errors.Is(err, errJobDeferred):
+		j.Status, j.LastError = JobPending, err.Error()
+		j.Attempts--
+		j.RunAt = time.Now().Add(jobDeferDelay)
+	case errors.Is(err, errPermanent) || j.Attempts >= j.MaxAttempts:
+		j.Status, j.LastError = JobFailed, err.Error()
+		log.Printf("[JOBS] #%d %s falló definitivamente (req=%s): %v", j.ID, j.Kind, j.RequestID, err)
+		if hook, ok := jobFailHooks[j.Kind]; ok {
+			hook(db, *j, err)
+		}
+	default:
+		// 30s, 1m, 2m, 4m...
+		j.Status, j.LastError = JobPending, err.Error()
+		j.RunAt = time.Now().Add(time.Duration(1<<(j.Attempts-1)) * 30 * time.Second)
+		log.Printf("[JOBS] #%d %s reintento %d/%d (req=%s): %v", j.ID, j.Kind, j.Attempts, j.MaxAttempts, j.RequestID, err)
+	}
+	// Sin tocar cancel_requested ni el avance, que se escriben desde fuera.
+	if err := db.Model(j).Select("status", "last_error", "run_at", "attempts", "locked_at", "updated_at").Updates(j).Error; err != nil {
+		log.Printf("[JOBS] no pude guardar el estado de #%d: %v", j.ID, err)
+	}
+}
+
+// requeueStuckJobs devuelve a la cola trabajos "running" de un worker que murió.
+func requeueStuckJobs(db *gorm.DB, olderThan time.Duration) {
+	db.Model(&Job{}).
+		Where("status = ? AND locked_at < ?", JobRunning, time.Now().Add(-olderThan)).
+		Updates(map[string]any{"status": JobPending, "locked_at": nil})
+}
+
+// startJobWorkers arranca JOB_WORKERS workers y el que rescata trabajos
+// atascados.
+func startJobWorkers(db *gorm.DB) {
+	for range jobWorkers {
+		go startJobWorker(db)
+	}
+	go func() {
+		requeueStuckJobs(db, jobStuckAfter)
+		for range time.Tick(time.Minute) {
+			requeueStuckJobs(db, jobStuckAfter)
+		}
+	}()
+}
+
+func startJobWorker(db *gorm.DB) {
+	for {
+		heavy := heavySlots.acquireHeavy()
+		j, err := claimJob(db, heavy)
+		if heavy && (j == nil || !heavyJobKinds[j.Kind]) {
+			heavySlots.releaseHeavy()
+			heavy = false
+		}
+		if err != nil {
+			log.Printf("[JOBS] error reclamando trabajo: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		if j == nil {
+			time.Sleep(time.Second)
+			continue
+		}
+		runJob(db, j)
+		if heavy {
+			heavySlots.releaseHeavy()
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/gorm"
+)
+
+// BenchmarkClaimJob mide una vuelta de un worker sobre un trabajo que no hace
+// nada: encolar, reclamar con SKIP LOCKED y guardar el resultado. Es el coste
+// fijo de cada recordatorio en CLUSTER_MODE.
+func BenchmarkClaimJob(b *testing.B) {
+	db := benchDB(b, true)
+	registerJobHandler("bench.noop", func(context.Context, *gorm.DB, Job) error { return nil })
+	b.Cleanup(func() {
+		delete(jobHandlers, "bench.noop")
+		db.Where("kind = ?", "bench.noop").Delete(&Job{})
+	})
+	for b.Loop() {
+		if _, err := enqueueJobAt(db, "bench.noop", nil, time.Now().Add(-time.Hour)); err != nil {
+			b.Fatal(err)
+		}
+		j, err := claimJob(db, false)
+		if err != nil || j == nil {
+			b.Fatalf("no reclamó nada: %v", err)
+		}
+		runJob(db, j)
+	}
+}
+
+// Un trabajo que agota jobTimeout no puede darse por atascado mientras
+// todavía está soltando: el rescate tiene que esperar más.
+func TestJobStuckAfterOutlivesTimeout(t *testing.T) {
+	if jobStuckAfter <= jobTimeout {
+		t.Fatalf("jobStuckAfter (%v) tiene que ser mayor que jobTimeout (%v)", jobStuckAfter, jobTimeout)
+	}
+}
+
+// Una importación cuyo trabajo agota los intentos con un error pasajero no
+// puede quedarse "running".
+func TestImportFailsWhenJobRunsOutOfAttempts(t *testing.T) {
+	db, mock := newMockDB(t)
+	registerJobHandler("test.import", func(context.Context, *gorm.DB, Job) error { return errors.New("conexión perdida") })
+	registerJobFailHook("test.import", importJobFailed)
+	t.Cleanup(func() {
+		delete(jobHandlers, "test.import")
+		delete(jobFailHooks, "test.import")
+	})
+	mock.ExpectQuery(`FROM "imports"`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(9, 7, ImportRunning))
+	mock.ExpectExec(`UPDATE "imports" SET .*"status"=`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), ImportFailed, sqlmock.AnyArg(), 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "jobs"`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	j := &Job{ID: 1, Kind: "test.import", Payload: `{"import_id":9}`, Attempts: 5, MaxAttempts: 5}
+	runJob(db, j)
+	if j.Status != JobFailed {
+		t.Fatalf("status = %s, quería failed", j.Status)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// ========= LDAP / ACTIVE DIRECTORY =========
+//
+// Autenticación contra un directorio detrás del mismo POST /auth/login. Se
+// busca al usuario con una cuenta de servicio (conexiones reutilizadas en un
+// pool) y se valida la contraseña haciendo bind con su DN en una conexión
+// aparte. Los usuarios se crean en local la primera vez que entran, pero no
+// antes de completar /setup. Con LDAP_ADMIN_GROUP, su rol se recalcula en
+// cada login a partir de los grupos (memberOf), salvo que quitárselo deje la
+// instancia sin admin; sin él, el rol se gestiona en local (ADMIN_EMAILS,
+// /admin) y LDAP no lo toca.
+
+var (
+	errLDAPNoSuchUser = errors.New("usuario no encontrado en LDAP")
+	errBadCredentials = errors.New("credenciales inválidas")
+)
+
+type ldapBackend struct {
+	url          string
+	bindDN       string
+	bindPassword string
+	baseDN       string
+	userFilter   string // con un %s para el email, p.ej. (mail=%s)
+	adminGroup   string // DN del grupo cuyos miembros son admin de instancia
+	startTLS     bool
+	tlsConfig    *tls.Config
+	// Si el usuario no existe en el directorio, se prueba la contraseña local
+	// (útil para el admin de arranque).
+	fallbackLocal bool
+	pool          chan *ldap.Conn
+}
+
+var ldapAuth *ldapBackend
+
+func newLDAPBackend() *ldapBackend {
+	url := os.Getenv("LDAP_URL")
+	if url == "" {
+		return nil
+	}
+	return &ldapBackend{
+		url:           url,
+		bindDN:        os.Getenv("LDAP_BIND_DN"),
+		bindPassword:  os.Getenv("LDAP_BIND_PASSWORD"),
+		baseDN:        os.Getenv("LDAP_BASE_DN"),
+		userFilter:    getEnv("LDAP_USER_FILTER", "(mail=%s)"),
+		adminGroup:    os.Getenv("LDAP_ADMIN_GROUP"),
+		startTLS:      getEnv("LDAP_START_TLS", "false") == "true",
+		tlsConfig:     &tls.Config{InsecureSkipVerify: getEnv("LDAP_INSECURE_SKIP_VERIFY", "false") == "true"},
+		fallbackLocal: getEnv("LDAP_FALLBACK_LOCAL", "true") == "true",
+		pool:          make(chan *ldap.Conn, getEnvInt("LDAP_POOL_SIZE", 4)),
+	}
+}
+
+func (b *ldapBackend) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(b.url, ldap.DialWithTLSConfig(b.tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(10 * time.Second)
+	if b.startTLS {
+		if err := conn.StartTLS(b.tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// serviceConn devuelve una conexión autenticada con la cuenta de servicio,
+// reutilizando una del pool si la hay.
+func (b *ldapBackend) serviceConn() (*ldap.Conn, error) {
+	for {
+		select {
+		case conn := <-b.pool:
+			if !conn.IsClosing() {
+				return conn, nil
+			}
+		default:
+			conn, err := b.dial()
+			if err != nil {
+				return nil, err
+			}
+			if err := conn.Bind(b.bindDN, b.bindPassword); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("bind de servicio: %w", err)
+			}
+			return conn, nil
+		}
+	}
+}
+
+func (b *ldapBackend) release(conn *ldap.Conn) {
+	if conn.IsClosing() {
+		return
+	}
+	select {
+	case b.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+type ldapUser struct {
+	dn     string
+	email  string
+	groups []string
+}
+
+func (b *ldapBackend) lookup(email string) (*ldapUser, error) {
+	conn, err := b.serviceConn()
+	if err != nil {
+		return nil, err
+	}
+	req := ldap.NewSearchRequest(b.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		fmt.Sprintf(b.userFilter, ldap.EscapeFilter(email)), []string{"dn", "mail", "memberOf"}, nil)
+	res, err := conn.Search(req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	b.release(conn)
+	if len(res.Entries) != 1 {
+		return nil, errLDAPNoSuchUser
+	}
+	e := res.Entries[0]
+	u := &ldapUser{dn: e.DN, email: strings.ToLower(e.GetAttributeValue("mail")), groups: e.GetAttributeValues("memberOf")}
+	if u.email == "" {
+		u.email = email
+	}
+	return u, nil
+}
+
+// roleFor devuelve el rol que dan los grupos, o "" si no hay LDAP_ADMIN_GROUP
+// y el rol no lo decide el directorio.
+func (b *ldapBackend) roleFor(groups []string) string {
+	if b.adminGroup == "" {
+		return ""
+	}
+	for _, g := range groups {
+		if strings.EqualFold(g, b.adminGroup) {
+			return RoleAdmin
+		}
+	}
+	return RoleUser
+}
+
+// authenticate valida email/contraseña contra el directorio y devuelve el
+// usuario local, creándolo o actualizando su rol según los grupos.
+func (b *ldapBackend) authenticate(db *gorm.DB, email, password string) (User, error) {
+	var u User
+	lu, err := b.lookup(email)
+	if err != nil {
+		return u, err
+	}
+	conn, err := b.dial()
+	if err != nil {
+		return u, err
+	}
+	defer conn.Close()
+	if err := conn.Bind(lu.dn, password); err != nil {
+		return u, errBadCredentials
+	}
+
+	role := b.roleFor(lu.groups)
+	err = db.Where("email = ?", lu.email).First(&u).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if setupNeeded(db) {
+			return u, errSetupPending
+		}
+		u = User{Email: lu.email, Role: RoleUser}
+		if role != "" {
+			u.Role = role
+		}
+		err = db.Create(&u).Error
+	case err == nil && role != "" && u.Role != role:
+		if u.Role == RoleAdmin && !otherAdminsExist(db, u.ID) {
+			log.Printf("[LDAP] %s ya no está en el grupo de admins, pero es el último admin: conserva el rol", u.Email)
+			break
+		}
+		u.Role = role
+		err = db.Save(&u).Error
+	}
+	if err != nil {
+		log.Printf("[LDAP] no puedo sincronizar %s: %v", lu.email, err)
+	}
+	return u, err
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestLDAPRoleFor(t *testing.T) {
+	admins := "cn=admins,ou=groups,dc=example,dc=com"
+	groups := []string{"cn=staff,ou=groups,dc=example,dc=com", "CN=Admins,OU=groups,DC=example,DC=com"}
+	cases := []struct {
+		adminGroup string
+		groups     []string
+		want       string
+	}{
+		{"", groups, ""}, // sin grupo configurado, LDAP no decide el rol
+		{admins, groups, RoleAdmin},
+		{admins, groups[:1], RoleUser},
+		{admins, nil, RoleUser},
+	}
+	for _, tc := range cases {
+		b := &ldapBackend{adminGroup: tc.adminGroup}
+		if got := b.roleFor(tc.groups); got != tc.want {
+			t.Errorf("roleFor(%q, %v) = %q, quería %q", tc.adminGroup, tc.groups, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= RETENCIÓN LEGAL =========
+//
+// Un admin puede poner una cuenta en retención legal (PUT
+// /admin/users/:id/legal-hold) mientras dure un litigio o una investigación.
+// Hasta que se levanta, nada borra sus datos: ni borrar la cuenta (admin,
+// SCIM, el borrado nocturno de demos), ni fusionarla en otra, ni que el propio
+// usuario borre tareas o hábitos, ni los trabajos que limpian lo viejo
+// (ficheros de importación, entradas de Mi día). Sí puede seguir entrando y
+// trabajando, y un admin puede desactivarla: eso no borra nada.
+//
+// Cada intento bloqueado deja un evento legal_hold.blocked en el registro de
+// la cuenta, con qué se intentó y quién; poner y levantar la retención dejan
+// legal_hold.set y legal_hold.lifted.
+
+var errLegalHold = errors.New("la cuenta está en retención legal: no se puede borrar nada")
+
+const legalHoldReasonMax = 500
+
+// heldUserIDs devuelve cuáles de ids están en retención legal.
+func heldUserIDs(db *gorm.DB, ids []uint) ([]uint, error) {
+	var held []uint
+	if len(ids) == 0 {
+		return held, nil
+	}
+	err := db.Model(&User{}).Where("id IN ? AND legal_hold_at IS NOT NULL", ids).Pluck("id", &held).Error
+	return held, err
+}
+
+// checkLegalHold comprueba ids antes de borrar algo suyo; si alguno está en
+// retención apunta el intento (action, actor) y devuelve errLegalHold. Hay que
+// llamarla fuera de la transacción del borrado: si no, el evento se iría con
+// el rollback.
+func checkLegalHold(db *gorm.DB, ids []uint, action string, actor uint) error {
+	held, err := heldUserIDs(db, ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range held {
+		recordEvent(db, id, "legal_hold.blocked", nil, gin.H{"action": action, "by": actor})
+	}
+	if len(held) > 0 {
+		return errLegalHold
+	}
+	return nil
+}
+
+// legalHoldBlocks responde 423 si la comprobación lo impide; true = ya se
+// respondió.
+func legalHoldBlocks(c *gin.Context, db *gorm.DB, ids []uint, action string) bool {
+	err := checkLegalHold(db, ids, action, c.GetUint("user_id"))
+	switch {
+	case errors.Is(err, errLegalHold):
+		c.JSON(423, gin.H{"error": err.Error()})
+		return true
+	case err != nil:
+		c.JSON(500, gin.H{"error": "db error"})
+		return true
+	}
+	return false
+}
+
+// adminPutLegalHoldHandler: PUT /admin/users/:id/legal-hold {"reason"}. Sobre
+// una cuenta ya retenida solo cambia el motivo.
+func adminPutLegalHoldHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		in.Reason = strings.TrimSpace(in.Reason)
+		if in.Reason == "" || len(in.Reason) > legalHoldReasonMax {
+			c.JSON(400, gin.H{"error": "reason: obligatorio, hasta 500 caracteres"})
+			return
+		}
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		updates := map[string]any{"legal_hold_reason": in.Reason}
+		if u.LegalHoldAt == nil {
+			now := time.Now()
+			updates["legal_hold_at"] = now
+			u.LegalHoldAt = &now
+		}
+		if err := db.Model(&u).Updates(updates).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		u.LegalHoldReason = in.Reason
+		recordEvent(db, u.ID, "legal_hold.set", nil, gin.H{"by": c.GetUint("user_id"), "reason": in.Reason})
+		c.JSON(200, u)
+	}
+}
+
+// adminDeleteLegalHoldHandler: DELETE /admin/users/:id/legal-hold
+func adminDeleteLegalHoldHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		if u.LegalHoldAt == nil {
+			c.JSON(409, gin.H{"error": "la cuenta no está en retención legal"})
+			return
+		}
+		if err := db.Model(&u).Updates(map[string]any{"legal_hold_at": nil, "legal_hold_reason": ""}).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		recordEvent(db, u.ID, "legal_hold.lifted", nil, gin.H{"by": c.GetUint("user_id"), "since": u.LegalHoldAt, "reason": u.LegalHoldReason})
+		u.LegalHoldAt, u.LegalHoldReason = nil, ""
+		c.JSON(200, u)
+	}
+}
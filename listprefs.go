@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========= PREFERENCIAS DE LISTA =========
+//
+// Cada usuario puede cambiar cómo sale GET /api/tasks cuando no se pasan
+// parámetros: orden, si se enseñan las hechas y cuántas por página. Se
+// guardan en users.list_prefs y se cambian con PATCH /api/me {"list_prefs"}.
+// Lo explícito manda: parámetros de la petición > preset de vista >
+// preferencias > id desc, todas, sin paginar.
+
+const maxTasksPerPage = 500
+
+type ListPrefs struct {
+	Sort          string `json:"sort,omitempty"`
+	Order         string `json:"order,omitempty"`
+	ShowCompleted *bool  `json:"show_completed,omitempty"` // nil = true
+	TasksPerPage  int    `json:"tasks_per_page,omitempty"` // 0 = sin paginar
+}
+
+func (p ListPrefs) validate() error {
+	if p.Sort != "" && !taskSortColumns[p.Sort] {
+		return errors.New("list_prefs.sort debe ser id, created_at, updated_at o due_at")
+	}
+	if p.Order != "" && p.Order != "asc" && p.Order != "desc" {
+		return errors.New("list_prefs.order debe ser asc o desc")
+	}
+	if p.TasksPerPage < 0 || p.TasksPerPage > maxTasksPerPage {
+		return errors.New("list_prefs.tasks_per_page debe estar entre 0 y 500")
+	}
+	return nil
+}
+
+// patch aplica sobre p los campos presentes en in; el resto se conserva y
+// null vuelve al valor por defecto.
+func (p ListPrefs) patch(in map[string]json.RawMessage) (ListPrefs, error) {
+	for k, raw := range in {
+		var err error
+		switch k {
+		case "sort":
+			p.Sort = ""
+			err = json.Unmarshal(raw, &p.Sort)
+		case "order":
+			p.Order = ""
+			err = json.Unmarshal(raw, &p.Order)
+		case "show_completed":
+			p.ShowCompleted = nil
+			err = json.Unmarshal(raw, &p.ShowCompleted)
+		case "tasks_per_page":
+			p.TasksPerPage = 0
+			err = json.Unmarshal(raw, &p.TasksPerPage)
+		default:
+			return p, errors.New("list_prefs: campo desconocido " + k)
+		}
+		if err != nil {
+			return p, errors.New("list_prefs." + k + ": valor inválido")
+		}
+	}
+	return p, p.validate()
+}
+
+type taskListOptions struct {
+	Sort, Order   string
+	ShowCompleted bool
+	PerPage, Page int
+}
+
+// resolveListOptions junta preferencias, preset y parámetros de la petición.
+func resolveListOptions(c *gin.Context, prefs ListPrefs, preset *ViewPreset) (taskListOptions, error) {
+	o := taskListOptions{Sort: "id", Order: "desc", ShowCompleted: true, PerPage: prefs.TasksPerPage, Page: 1}
+	if prefs.Sort != "" {
+		o.Sort = prefs.Sort
+	}
+	if prefs.Order != "" {
+		o.Order = prefs.Order
+	}
+	if prefs.ShowCompleted != nil {
+		o.ShowCompleted = *prefs.ShowCompleted
+	}
+	if preset != nil {
+		o.Sort, o.Order = preset.Sort, preset.Order
+	}
+	o.Sort = c.DefaultQuery("sort", o.Sort)
+	if !taskSortColumns[o.Sort] {
+		return o, errors.New("sort debe ser id, created_at, updated_at o due_at")
+	}
+	o.Order = c.DefaultQuery("order", o.Order)
+	if o.Order != "asc" && o.Order != "desc" {
+		return o, errors.New("order debe ser asc o desc")
+	}
+	if v := c.Query("show_completed"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return o, errors.New("show_completed debe ser true o false")
+		}
+		o.ShowCompleted = b
+	}
+	if v := c.Query("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxTasksPerPage {
+			return o, errors.New("per_page debe estar entre 0 y 500")
+		}
+		o.PerPage = n
+	}
+	if v := c.Query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return o, errors.New("page debe ser 1 o mayor")
+		}
+		o.Page = n
+	}
+	return o, nil
+}
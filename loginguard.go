@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ========= LOGIN GUARD =========
+
+// dummyHash se compara cuando el usuario no existe (o no tiene contraseña)
+// para que ese camino tarde lo mismo que una contraseña incorrecta y no
+// delate qué emails están registrados.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("taskflow-dummy-password"), bcrypt.DefaultCost)
+
+// checkPassword compara siempre contra un hash bcrypt, exista el usuario o no.
+func checkPassword(u *User, password string) bool {
+	hash := dummyHash
+	if u != nil && u.PasswordHash != "" {
+		hash = []byte(u.PasswordHash)
+	}
+	ok := bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+	return ok && u != nil && u.PasswordHash != ""
+}
+
+// loginLimiter bloquea temporalmente un email tras varios fallos seguidos,
+// duplicando la espera con cada fallo extra (LOGIN_BACKOFF=true). Hay una
+// implementación en memoria (loginBackoff) y otra en Postgres
+// (pgLoginBackoff, ver cluster.go).
+type loginLimiter interface {
+	// blockedFor devuelve cuánto falta para poder reintentar (0 si ya se puede).
+	blockedFor(email string) time.Duration
+	fail(email string)
+	succeed(email string)
+}
+
+// noLoginLimit se usa con LOGIN_BACKOFF desactivado.
+type noLoginLimit struct{}
+
+func (noLoginLimit) blockedFor(string) time.Duration { return 0 }
+func (noLoginLimit) fail(string)                     {}
+func (noLoginLimit) succeed(string)                  {}
+
+type loginBackoff struct {
+	mu       sync.Mutex
+	free     int           // fallos permitidos antes de empezar a bloquear
+	base     time.Duration // primera espera
+	max      time.Duration
+	failures map[string]*backoffEntry
+}
+
+type backoffEntry struct {
+	count int
+	until time.Time
+}
+
+var loginGuard loginLimiter = noLoginLimit{}
+
+func newLoginBackoff(db *gorm.DB, backend string) loginLimiter {
+	if getEnv("LOGIN_BACKOFF", "false") != "true" {
+		return noLoginLimit{}
+	}
+	free := getEnvInt("LOGIN_BACKOFF_FREE_ATTEMPTS", 3)
+	if backend == StatePostgres {
+		return &pgLoginBackoff{db: db, free: free, base: time.Second, max: 15 * time.Minute}
+	}
+	return &loginBackoff{
+		free:     free,
+		base:     time.Second,
+		max:      15 * time.Minute,
+		failures: map[string]*backoffEntry{},
+	}
+}
+
+// backoffWait: sin espera durante los primeros free fallos, luego base, 2*base,
+// 4*base... hasta max.
+func backoffWait(count, free int, base, max time.Duration) time.Duration {
+	over := count - free
+	if over <= 0 {
+		return 0
+	}
+	wait := time.Duration(float64(base) * math.Pow(2, float64(over-1)))
+	if wait > max || wait <= 0 {
+		wait = max
+	}
+	return wait
+}
+
+func (b *loginBackoff) blockedFor(email string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.failures[email]
+	if !ok {
+		return 0
+	}
+	if d := time.Until(e.until); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (b *loginBackoff) fail(email string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.failures) > 10000 {
+		b.prune()
+	}
+	e, ok := b.failures[email]
+	if !ok {
+		e = &backoffEntry{}
+		b.failures[email] = e
+	}
+	e.count++
+	if wait := backoffWait(e.count, b.free, b.base, b.max); wait > 0 {
+		e.until = time.Now().Add(wait)
+	}
+}
+
+// prune olvida los emails cuyo bloqueo ya pasó, para acotar la memoria
+// durante un ataque con muchos emails distintos.
+func (b *loginBackoff) prune() {
+	now := time.Now()
+	for k, e := range b.failures {
+		if now.After(e.until) {
+			delete(b.failures, k)
+		}
+	}
+}
+
+func (b *loginBackoff) succeed(email string) {
+	b.mu.Lock()
+	delete(b.failures, email)
+	b.mu.Unlock()
+}
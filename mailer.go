@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= MAIL =========
+//
+// Todos los correos pasan por la cola de trabajos (kind "email"), así un fallo
+// del proveedor se reintenta sin bloquear la petición. MAILER elige el
+// proveedor: log (por defecto), smtp, ses o sendgrid.
+
+type Email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+type Mailer interface {
+	Send(ctx context.Context, e Email) error
+}
+
+var (
+	mailer   Mailer
+	mailFrom = getEnv("MAIL_FROM", "TaskFlow <no-reply@taskflow.local>")
+	appEnv   = getEnv("APP_ENV", "production")
+)
+
+func newMailer() (Mailer, error) {
+	switch kind := getEnv("MAILER", "log"); kind {
+	case "log":
+		return logMailer{}, nil
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, errors.New("MAILER=smtp requiere SMTP_HOST")
+		}
+		return &smtpMailer{
+			addr: host + ":" + getEnv("SMTP_PORT", "587"),
+			host: host,
+			user: os.Getenv("SMTP_USER"),
+			pass: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	case "ses":
+		m := &sesMailer{signer: awsSigner{
+			accessKey: os.Getenv("SES_ACCESS_KEY"),
+			secretKey: os.Getenv("SES_SECRET_KEY"),
+			region:    getEnv("SES_REGION", "eu-west-1"),
+			service:   "ses",
+		}}
+		if m.signer.accessKey == "" || m.signer.secretKey == "" {
+			return nil, errors.New("MAILER=ses requiere SES_ACCESS_KEY y SES_SECRET_KEY")
+		}
+		return m, nil
+	case "sendgrid":
+		key := os.Getenv("SENDGRID_API_KEY")
+		if key == "" {
+			return nil, errors.New("MAILER=sendgrid requiere SENDGRID_API_KEY")
+		}
+		return &sendgridMailer{apiKey: key}, nil
+	default:
+		return nil, fmt.Errorf("MAILER desconocido: %s", kind)
+	}
+}
+
+type logMailer struct{}
+
+func (logMailer) Send(_ context.Context, e Email) error {
+	log.Printf("[MAIL] a %s: %s\n%s", e.To, e.Subject, e.Text)
+	return nil
+}
+
+type smtpMailer struct {
+	addr, host, user, pass string
+}
+
+// Send usa net/smtp, que negocia STARTTLS si el servidor lo ofrece.
+func (m *smtpMailer) Send(_ context.Context, e Email) error {
+	var auth smtp.Auth
+	if m.user != "" {
+		auth = smtp.PlainAuth("", m.user, m.pass, m.host)
+	}
+	return smtp.SendMail(m.addr, auth, bareAddress(mailFrom), []string{e.To}, buildMIME(e))
+}
+
+// bareAddress extrae "a@b.com" de "Nombre <a@b.com>".
+func bareAddress(s string) string {
+	if i := strings.LastIndex(s, "<"); i >= 0 {
+		return strings.TrimSuffix(s[i+1:], ">")
+	}
+	return s
+}
+
+// headerValue prepara un valor de cabecera: sin CR/LF, que partirían la
+// cabecera en dos, y en RFC 2047 si no es ASCII (tildes en el asunto).
+func headerValue(s string) string {
+	s = strings.NewReplacer("\r", "", "\n", "").Replace(s)
+	return mime.QEncoding.Encode("utf-8", s)
+}
+
+func buildMIME(e Email) []byte {
+	var b bytes.Buffer
+	boundary := "taskflow-" + randomHex(8)
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\n",
+		mailFrom, headerValue(e.To), headerValue(e.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if e.HTML == "" {
+		fmt.Fprintf(&b, "Content-Type: text/plain; charset=UTF-8\r\n\r\n%s", e.Text)
+		return b.Bytes()
+	}
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", boundary, e.Text)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n", boundary, e.HTML)
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes()
+}
+
+type sesMailer struct {
+	signer awsSigner
+}
+
+// Send usa el API v2 de SES (SendEmail con contenido simple).
+func (m *sesMailer) Send(ctx context.Context, e Email) error {
+	body := map[string]any{
+		"FromEmailAddress": mailFrom,
+		"Destination":      map[string]any{"ToAddresses": []string{e.To}},
+		"Content": map[string]any{"Simple": map[string]any{
+			"Subject": map[string]string{"Data": e.Subject, "Charset": "UTF-8"},
+			"Body": map[string]any{
+				"Text": map[string]string{"Data": e.Text, "Charset": "UTF-8"},
+				"Html": map[string]string{"Data": e.HTML, "Charset": "UTF-8"},
+			},
+		}},
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("https://email.%s.amazonaws.com/v2/email/outbound-emails", m.signer.region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	m.signer.sign(req, sha256Hex(raw), time.Now().UTC())
+	return checkMailResponse(notifyClient.Do(req))
+}
+
+type sendgridMailer struct {
+	apiKey string
+}
+
+func (m *sendgridMailer) Send(ctx context.Context, e Email) error {
+	content := []map[string]string{{"type": "text/plain", "value": e.Text}}
+	if e.HTML != "" {
+		content = append(content, map[string]string{"type": "text/html", "value": e.HTML})
+	}
+	body := map[string]any{
+		"personalizations": []any{map[string]any{"to": []any{map[string]string{"email": e.To}}}},
+		"from":             map[string]string{"email": bareAddress(mailFrom)},
+		"subject":          e.Subject,
+		"content":          content,
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.sendgrid.com/v3/mail/send", bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	return checkMailResponse(notifyClient.Do(req))
+}
+
+// checkMailResponse trata los 4xx como permanentes (no se arreglan reintentando).
+func checkMailResponse(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("proveedor de correo respondió %d", resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("%w: proveedor de correo respondió %d", errPermanent, resp.StatusCode)
+	}
+	return nil
+}
+
+// --- plantillas ---
+
+//go:embed templates/email
+var emailTemplatesFS embed.FS
+
+// emailSamples son los datos de ejemplo de la vista previa en desarrollo.
+var emailSamples = map[string]map[string]any{
+	"welcome":  {"Email": "ana@example.com"},
+	"reminder": {"Email": "ana@example.com", "Title": "Recordatorio", "Body": `"Enviar factura" vence ahora`},
+	"invite":   {"Email": "ana@example.com", "Link": "http://localhost:8080/register?invite=abc123", "ExpiresAt": "08/10/2026"},
+}
+
+// renderEmail rellena templates/email/<name>.txt (bloques "subject" y "text")
+// y, si existe, <name>.html. Si data no trae "Brand" se usa la marca por
+// defecto.
+func renderEmail(name string, data map[string]any) (Email, error) {
+	var e Email
+	if _, ok := data["Brand"]; !ok {
+		withBrand := map[string]any{"Brand": defaultBranding()}
+		for k, v := range data {
+			withBrand[k] = v
+		}
+		data = withBrand
+	}
+	txt, err := template.ParseFS(emailTemplatesFS, "templates/email/"+name+".txt")
+	if err != nil {
+		return e, fmt.Errorf("plantilla %q: %w", name, err)
+	}
+	var subject, text bytes.Buffer
+	if err := txt.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return e, err
+	}
+	if err := txt.ExecuteTemplate(&text, "text", data); err != nil {
+		return e, err
+	}
+	e.Subject, e.Text = strings.TrimSpace(subject.String()), text.String()
+	if html, err := htmltemplate.ParseFS(emailTemplatesFS, "templates/email/"+name+".html"); err == nil {
+		var b bytes.Buffer
+		if err := html.Execute(&b, data); err != nil {
+			return e, err
+		}
+		e.HTML = b.String()
+	}
+	return e, nil
+}
+
+// queueEmail renderiza la plantilla para el usuario y la encola. Las cuentas
+// demo nunca reciben correo.
+func queueEmail(db *gorm.DB, userID uint, name string, data map[string]any) error {
+	var u User
+	if err := db.First(&u, userID).Error; err != nil {
+		return err
+	}
+	if u.IsDemo || u.EmailUndeliverableAt != nil {
+		return nil
+	}
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["Email"] = u.Email
+	data["Brand"] = loadBranding(db)
+	e, err := renderEmail(name, data)
+	if err != nil {
+		return err
+	}
+	e.To = u.Email
+	_, err = enqueueJob(db, "email", e)
+	return err
+}
+
+func sendEmailJob(ctx context.Context, db *gorm.DB, j Job) error {
+	var e Email
+	if err := json.Unmarshal([]byte(j.Payload), &e); err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	// La dirección pudo suprimirse mientras el trabajo esperaba en la cola.
+	if emailSuppressed(db, e.To) {
+		log.Printf("[MAIL] %s suprimido, descarto %q", e.To, e.Subject)
+		return nil
+	}
+	return mailer.Send(ctx, e)
+}
+
+// emailNotifier entrega notificaciones por correo al email de la cuenta.
+type emailNotifier struct {
+	db *gorm.DB
+}
+
+func (m *emailNotifier) Send(_ context.Context, n Notification) error {
+	return queueEmail(m.db, n.UserID, "reminder", map[string]any{"Title": n.Title, "Body": n.Body})
+}
+
+// --- vista previa (solo APP_ENV=dev) ---
+
+func previewEmailHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		sample, ok := emailSamples[name]
+		if !ok {
+			c.JSON(404, gin.H{"error": "plantilla no encontrada"})
+			return
+		}
+		data := map[string]any{"Brand": loadBranding(db)}
+		for k, v := range sample {
+			data[k] = v
+		}
+		e, err := renderEmail(name, data)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if c.Query("format") == "text" || e.HTML == "" {
+			c.String(200, "Subject: %s\n\n%s", e.Subject, e.Text)
+			return
+		}
+		c.Data(200, "text/html; charset=utf-8", []byte(e.HTML))
+	}
+}
+
+func listEmailPreviewsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		names := make([]string, 0, len(emailSamples))
+		for n := range emailSamples {
+			names = append(names, n)
+		}
+		c.JSON(200, names)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildMIMEHeadersStayOnOneLine(t *testing.T) {
+	msg := string(buildMIME(Email{
+		To:      "ana@example.com\r\nBcc: otro@example.com",
+		Subject: "Medicación\r\nBcc: otro@example.com",
+		Text:    "hola",
+	}))
+	headers, _, _ := strings.Cut(msg, "\r\n\r\n")
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Fatalf("cabecera inyectada:\n%s", headers)
+		}
+	}
+	if !strings.Contains(headers, "Subject: =?utf-8?q?Medicaci=C3=B3nBcc:_otro@example.com?=") {
+		t.Errorf("asunto sin codificar:\n%s", headers)
+	}
+}
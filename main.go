@@ -1,17 +1,19 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
@@ -20,6 +22,41 @@ type User struct {
 	Email        string    `gorm:"uniqueIndex;not null" json:"email"`
 	PasswordHash string    `json:"-"`
 	CreatedAt    time.Time `json:"created_at"`
+	IsDemo       bool      `json:"is_demo,omitempty"`
+	Role         string    `gorm:"not null;default:'user'" json:"role"`
+	// Identificador del usuario en el proveedor OIDC ("sub").
+	OIDCSubject string `gorm:"column:oidc_subject;index" json:"-"`
+	// Usuario desactivado: no puede entrar, pero sus datos se conservan.
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+	DeactivatedBy string     `json:"deactivated_by,omitempty"` // self | admin | scim
+	// Retención legal: mientras no se levante, no se borra nada suyo (ver legalhold.go).
+	LegalHoldAt     *time.Time `json:"legal_hold_at,omitempty"`
+	LegalHoldReason string     `json:"legal_hold_reason,omitempty"`
+
+	// Teléfono para el canal SMS (E.164). Solo se usa si PhoneVerified.
+	Phone              string     `json:"phone,omitempty"`
+	PhoneVerified      bool       `json:"phone_verified"`
+	PhoneCodeHash      string     `json:"-"`
+	PhoneCodeExpiresAt *time.Time `json:"-"`
+	PhoneCodeAttempts  int        `json:"-"`
+	// Diccionario de Postgres para la búsqueda (spanish, english, simple...).
+	SearchLanguage string `gorm:"not null;default:'simple'" json:"search_language"`
+	// Zona horaria IANA para las fechas que llegan sin zona (ver timestamps.go).
+	Timezone string `gorm:"not null;default:'UTC'" json:"timezone"`
+	// Imagen subida en el blob store; sin ella, Gravatar (ver avatar.go).
+	AvatarKey string `json:"-"`
+	AvatarURL string `gorm:"-" json:"avatar_url,omitempty"`
+	// Slug del perfil público (ver profile.go); nil = no publicado.
+	PublicSlug *string `gorm:"uniqueIndex" json:"public_slug,omitempty"`
+	// Cómo sale GET /api/tasks sin parámetros (ver listprefs.go).
+	ListPrefs ListPrefs `gorm:"serializer:json;type:jsonb;not null;default:'{}'" json:"list_prefs"`
+	// El proveedor de correo avisó de un rebote o queja: no se envían más correos.
+	EmailUndeliverableAt   *time.Time `json:"email_undeliverable_at,omitempty"`
+	EmailSuppressionReason string     `json:"email_suppression_reason,omitempty"`
+
+	// Contador de SMS del mes en curso (SMSPeriod = "2006-01").
+	SMSPeriod string `json:"-"`
+	SMSSent   int    `json:"-"`
 }
 
 type Task struct {
@@ -27,14 +64,22 @@ type Task struct {
 	UserID    uint       `gorm:"index;not null" json:"user_id"`
 	Title     string     `gorm:"not null" json:"title"`
 	Done      bool       `json:"done"`
+	Priority  string     `gorm:"not null;default:'normal'" json:"priority"`
 	DueAt     *time.Time `json:"due_at,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	// Momento en que se marcó como hecha (para las estadísticas).
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// Etiqueta, categoría y sonido del aviso (ver remindermeta.go).
+	Reminder *ReminderMeta `gorm:"serializer:json;type:jsonb" json:"reminder,omitempty"`
 }
 
-var (
-	jwtSecret   = []byte(getEnv("JWT_SECRET", "dev-secret-change-me"))
-	remindersCh chan uint
-)
+var validPriorities = map[string]bool{"low": true, "normal": true, "high": true}
+
+// Columnas por las que se puede ordenar GET /api/tasks (?sort=...&order=asc|desc).
+var taskSortColumns = map[string]bool{"id": true, "created_at": true, "updated_at": true, "due_at": true}
+
+var jwtSecret = []byte(getEnv("JWT_SECRET", "dev-secret-change-me"))
 
 func getEnv(k, def string) string {
 	if v := os.Getenv(k); v != "" {
@@ -46,75 +91,397 @@ func getEnv(k, def string) string {
 func main() {
 	// --- DB ---
 	dsn := getEnv("POSTGRES_DSN", "host=localhost user=postgres password=postgres dbname=taskflow port=5432 sslmode=disable TimeZone=UTC")
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := openDB(dsn)
 	if err != nil {
 		log.Fatal("no puedo abrir Postgres:", err)
 	}
+	if err := db.Use(newQueryMetrics()); err != nil {
+		log.Fatal("no puedo instrumentar GORM:", err)
+	}
 
 	// Migraciones (forzamos y verificamos)
 	log.Println("aplicando migraciones...")
-	if err := db.AutoMigrate(&User{}, &Task{}); err != nil {
+	if err := runMigrations(db); err != nil {
 		log.Fatal("no puedo migrar:", err)
 	}
-	if !db.Migrator().HasTable(&User{}) || !db.Migrator().HasTable(&Task{}) {
-		log.Fatal("migración NO creó tablas users/tasks (revisar DSN o permisos)")
-	}
 	log.Println("migraciones listas")
+	if err := checkTimestamps(db); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadSetupState(db); err != nil {
+		log.Fatal("no puedo leer el estado del asistente:", err)
+	}
+	if setupNeeded(db) {
+		log.Println("instancia sin configurar: crea el primer admin en POST /setup")
+	}
+
+	blobStore, err = newBlobStore()
+	if err != nil {
+		log.Fatal("no puedo preparar el almacenamiento:", err)
+	}
+	if err := checkClusterSafe(); err != nil {
+		log.Fatal(err)
+	}
+	smsProvider = newSMSProvider()
+	mailer, err = newMailer()
+	if err != nil {
+		log.Fatal("no puedo configurar el correo:", err)
+	}
+	registerJobHandler("email", sendEmailJob)
+	registerJobHandler("stats.refresh", refreshStatsJob)
+	registerJobHandler("import.tasks", runImportJob)
+	registerJobFailHook("import.tasks", importJobFailed)
+	registerJobHandler("migrate.background", backgroundMigrationsJob)
+	registerJobHandler("notify.digest", digestJob)
+	cdn, err = newCDNPurger()
+	if err != nil {
+		log.Fatal(err)
+	}
+	registerJobHandler("cdn.purge", cdnPurgeJob)
+	if err := checkTelemetry(); err != nil {
+		log.Fatal(err)
+	}
+	registerJobHandler("telemetry.report", telemetryJob)
+	registerJobHandler("quota.warning", quotaWarningJob)
+	registerJobHandler("search.reindex", reindexSearchJob)
+	registerJobHandler("consistency.check", consistencyJob)
+	registerJobHandler("blobs.cleanup", blobCleanupJob)
+	registerJobHandler("focus.morning", focusMorningJob)
+	if err := setupNotifiers(db); err != nil {
+		log.Fatal(err)
+	}
+	registerPlugin(&activityPlugin{db: db})
+	registerPlugin(&cdnPlugin{db: db})
+	if gamificationEnabled {
+		registerPlugin(&gamificationPlugin{db: db})
+		registerJobHandler("gamification.notify", gameNotifyJob)
+	}
+	ldapAuth = newLDAPBackend()
+	loginGuard = newLoginBackoff(db, stateBackend)
+	demoLimiter = newDemoLimiter(db, stateBackend)
+	notifyBudget = newNotifyBudget(db, stateBackend)
+	if dir := os.Getenv("SCRIPTS_DIR"); dir != "" {
+		if err := loadScripts(dir); err != nil {
+			log.Fatal("no puedo cargar scripts:", err)
+		}
+	}
 
 	// --- worker de recordatorios ---
-	remindersCh = make(chan uint, 100)
-	go startReminderWorker(db, remindersCh)
+	reminders = newReminderScheduler(db, stateBackend)
+	registerJobHandler("task.reminder", reminderJob)
+	go startViewFlusher(db, 5*time.Second)
+	startJobWorkers(db)
+	go startStatsScheduler(db, time.Duration(getEnvInt("STATS_REFRESH_MINUTES", 10))*time.Minute)
+	if hours := getEnvInt("CONSISTENCY_CHECK_HOURS", 24); hours > 0 {
+		go startConsistencyScheduler(db, time.Duration(hours)*time.Hour)
+	}
+	if hours := getEnvInt("BLOB_CLEANUP_HOURS", 24); hours > 0 {
+		go startBlobCleanupScheduler(db, time.Duration(hours)*time.Hour)
+	}
+	if focusMorningHour >= 0 {
+		go startFocusScheduler(db, 15*time.Minute)
+	}
+	if telemetryEnabled {
+		go startTelemetry(db)
+	}
+	if demoMode {
+		log.Println("DEMO_MODE activo: cuentas desechables en POST /auth/demo")
+		go startDemoWiper(db)
+	}
 
 	// --- server ---
-	r := gin.Default()
+	r := gin.New()
+	r.Use(RequestID(), requestLogger(), gin.Recovery())
+	// Sin TRUSTED_PROXIES no se confía en X-Forwarded-For: ClientIP es la IP real.
+	if err := r.SetTrustedProxies(splitList(os.Getenv("TRUSTED_PROXIES"))); err != nil {
+		log.Fatal("TRUSTED_PROXIES inválido:", err)
+	}
+	opsGuard, err := newOpsGuardConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	chaos, err := setupChaos(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if chaos != nil {
+		r.Use(chaos)
+	}
+	rec, err := newRecorder()
+	if err != nil {
+		log.Fatal("REQUEST_RECORD_FILE:", err)
+	}
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
+	r.GET("/metrics", OpsGuard(opsGuard), gin.WrapH(promhttp.Handler()))
+	r.GET("/openapi.yaml", openapiHandler())
+	r.GET("/version", versionHandler())
+	r.GET("/branding", brandingHandler(db))
+	r.GET("/avatars/:id", avatarRedirectHandler(db))
+	r.GET("/profiles/:slug", publicProfileHandler(db))
+
+	// Vista previa de correos en desarrollo
+	if appEnv == "dev" {
+		r.GET("/dev/emails", listEmailPreviewsHandler())
+		r.GET("/dev/emails/:name", previewEmailHandler(db))
+	}
+
+	// Descargas firmadas del almacenamiento local
+	if local, ok := blobStore.(*localBlobStore); ok {
+		r.GET("/blobs/*key", local.serveHandler())
+	}
 
 	// Auth
 	auth := r.Group("/auth")
 	{
+		if os.Getenv("OIDC_ISSUER") != "" {
+			oc, err := setupOIDC(context.Background())
+			if err != nil {
+				log.Fatal("no puedo configurar OIDC:", err)
+			}
+			auth.GET("/oidc/login", oc.loginHandler())
+			auth.GET("/oidc/callback", oc.callbackHandler(db))
+		}
 		auth.POST("/register", registerHandler(db))
 		auth.POST("/login", loginHandler(db))
+		if demoMode {
+			auth.POST("/demo", demoAccountHandler(db))
+		}
+	}
+
+	// Asistente de primer arranque (410 una vez completado)
+	setup := r.Group("/setup", SetupGuard(db))
+	{
+		setup.GET("", setupStatusHandler())
+		setup.POST("/check", setupCheckHandler(db))
+		setup.POST("", setupCompleteHandler(db))
+	}
+
+	// OAuth2 para apps de terceros (autenticadas con client_id/secret)
+	oauth := r.Group("/oauth")
+	{
+		oauth.POST("/token", oauthTokenHandler(db))
+		oauth.POST("/introspect", oauthIntrospectHandler(db))
+		oauth.POST("/revoke", oauthRevokeHandler(db))
 	}
 
 	// API protegida
 	api := r.Group("/api")
-	api.Use(AuthMiddleware())
+	api.Use(NoStore(), AuthMiddleware(db), OAuthScopeGuard())
+	if rec != nil {
+		api.Use(rec.Middleware())
+	}
+	registerAPIRoutes(api, db)
+
+	// Administración de la instancia
+	admin := r.Group("/admin")
+	admin.Use(adminMiddleware(db, opsGuard)...)
 	{
-		api.GET("/tasks", listTasksHandler(db))
-		api.POST("/tasks", createTaskHandler(db))
-		api.PATCH("/tasks/:id", updateTaskHandler(db))
-		api.DELETE("/tasks/:id", deleteTaskHandler(db))
+		admin.GET("/users", adminListUsersHandler(db))
+		admin.PATCH("/users/:id", adminUpdateUserHandler(db))
+		admin.DELETE("/users/:id", adminDeleteUserHandler(db))
+		admin.POST("/users/:id/merge", adminMergeUserHandler(db))
+		admin.POST("/users/:id/deactivate", adminDeactivateUserHandler(db))
+		admin.POST("/users/:id/reactivate", adminReactivateUserHandler(db))
+		admin.PUT("/users/:id/legal-hold", adminPutLegalHoldHandler(db))
+		admin.DELETE("/users/:id/legal-hold", adminDeleteLegalHoldHandler(db))
+		admin.POST("/maintenance/wipe-demo", adminWipeDemoHandler(db))
+		admin.POST("/maintenance/reindex-search", adminReindexSearchHandler(db))
+		admin.GET("/consistency", adminConsistencyReportHandler(db))
+		admin.POST("/consistency/check", adminConsistencyCheckHandler(db))
+		admin.POST("/maintenance/blob-cleanup", adminBlobCleanupHandler(db))
+		admin.GET("/jobs", adminListJobsHandler(db))
+		admin.POST("/jobs/requeue", adminRequeueJobsHandler(db))
+		admin.GET("/jobs/:id", adminGetJobHandler(db))
+		admin.POST("/jobs/:id/cancel", adminCancelJobHandler(db))
+		admin.POST("/users/:id/reminders/reconcile", adminReconcileRemindersHandler(db))
+		admin.GET("/export/events.ndjson", adminExportEventsHandler(db))
+		admin.GET("/export/events.csv", adminExportEventsCSVHandler(db))
+		admin.GET("/stats", adminStatsHandler(db))
+		admin.GET("/telemetry", adminTelemetryHandler(db))
+		admin.GET("/settings/registration", adminGetRegistrationHandler(db))
+		admin.PUT("/settings/registration", adminPutRegistrationHandler(db))
+		admin.GET("/invites", adminListInvitesHandler(db))
+		admin.POST("/invites", adminCreateInviteHandler(db))
+		admin.DELETE("/invites/:id", adminDeleteInviteHandler(db))
+		admin.GET("/settings/branding", brandingHandler(db))
+		admin.GET("/timestamps", adminTimestampsHandler(db))
+		admin.POST("/maintenance/shift-due-dates", adminShiftDueDatesHandler(db))
+		admin.PUT("/settings/branding", adminPutBrandingHandler(db))
+		admin.GET("/settings/beta", adminBetaHandler(db))
+		admin.PUT("/settings/beta", adminPutBetaHandler(db))
+	}
+
+	// SCIM 2.0 para el IdP
+	if token := os.Getenv("SCIM_TOKEN"); token != "" {
+		scim := r.Group("/scim/v2")
+		scim.Use(scimAuth(token))
+		{
+			scim.GET("/Users", scimListUsersHandler(db))
+			scim.POST("/Users", scimCreateUserHandler(db))
+			scim.GET("/Users/:id", scimGetUserHandler(db))
+			scim.PUT("/Users/:id", scimReplaceUserHandler(db))
+			scim.PATCH("/Users/:id", scimPatchUserHandler(db))
+			scim.DELETE("/Users/:id", scimDeleteUserHandler(db))
+		}
+		if scimAdminGroup != "" {
+			scim.GET("/Groups", scimListGroupsHandler(db))
+			scim.POST("/Groups", scimCreateGroupHandler(db))
+			scim.GET("/Groups/:id", scimGetGroupHandler(db))
+			scim.PUT("/Groups/:id", scimReplaceGroupHandler(db))
+			scim.PATCH("/Groups/:id", scimPatchGroupHandler(db))
+		}
 	}
 
+	// Rebotes y quejas de los proveedores de correo
+	if token := os.Getenv("EMAIL_WEBHOOK_TOKEN"); token != "" {
+		hooks := r.Group("/webhooks/email", emailWebhookAuth(token))
+		hooks.POST("/sendgrid", sendgridEventsHandler(db))
+		hooks.POST("/ses", sesEventsHandler(db))
+	}
+
+	registerPluginRoutes(db, r, api)
+
+	srv, useTLS, err := newHTTPServer(":8080", r)
+	if err != nil {
+		log.Fatal("no puedo configurar TLS:", err)
+	}
 	log.Println("listening on :8080")
-	if err := r.Run(":8080"); err != nil {
+	if useTLS {
+		err = srv.ListenAndServeTLS(os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"))
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// registerAPIRoutes monta la API de usuario (/api). Es lo que describe
+// openapi/openapi.yaml; contract_test.go comprueba que no se separen.
+func registerAPIRoutes(api gin.IRoutes, db *gorm.DB) {
+	api.GET("/tasks", listTasksHandler(db))
+	api.GET("/tasks/search", searchTasksHandler(db))
+	api.GET("/tasks/recent", recentTasksHandler(db))
+	api.GET("/tasks/export", exportTasksHandler(db))
+	api.POST("/tasks/import", importTasksHandler(db))
+	api.GET("/imports/:id", getImportHandler(db))
+	api.POST("/imports/:id/cancel", cancelImportHandler(db))
+	api.GET("/tasks/:id", getTaskHandler(db))
+	api.GET("/tasks/:id/reminders/preview", reminderPreviewHandler(db))
+	api.POST("/tasks", createTaskHandler(db))
+	api.PATCH("/tasks/:id", updateTaskHandler(db))
+	api.DELETE("/tasks/:id", deleteTaskHandler(db))
+
+	api.GET("/suggest", suggestHandler(db))
+	api.GET("/searches", listSavedSearchesHandler(db))
+	api.POST("/searches", createSavedSearchHandler(db))
+	api.DELETE("/searches/:id", deleteSavedSearchHandler(db))
+	api.GET("/view-presets", listViewPresetsHandler(db))
+	api.POST("/view-presets", createViewPresetHandler(db))
+	api.GET("/view-presets/:id", getViewPresetHandler(db))
+	api.PATCH("/view-presets/:id", updateViewPresetHandler(db))
+	api.DELETE("/view-presets/:id", deleteViewPresetHandler(db))
+	api.GET("/habits", listHabitsHandler(db))
+	api.POST("/habits", createHabitHandler(db))
+	api.PATCH("/habits/:id", updateHabitHandler(db))
+	api.DELETE("/habits/:id", deleteHabitHandler(db))
+	api.POST("/habits/:id/checkins", checkinHabitHandler(db))
+	api.DELETE("/habits/:id/checkins/:day", uncheckHabitHandler(db))
+	api.GET("/today", todayHandler(db))
+	api.GET("/focus", listFocusHandler(db))
+	api.POST("/focus", addFocusHandler(db))
+	api.DELETE("/focus/:task_id", removeFocusHandler(db))
+
+	api.GET("/export/events.ndjson", exportEventsHandler(db))
+	api.GET("/stats", statsHandler(db))
+
+	api.GET("/me", meHandler(db))
+	api.PATCH("/me", updateMeHandler(db))
+	api.PUT("/me/avatar", uploadAvatarHandler(db))
+	api.DELETE("/me/avatar", deleteAvatarHandler(db))
+	api.POST("/me/password", changePasswordHandler(db))
+	api.POST("/me/phone", startPhoneVerificationHandler(db))
+	api.POST("/me/phone/verify", verifyPhoneHandler(db))
+	api.GET("/me/integrations", listIntegrationsHandler(db))
+	api.GET("/me/usage", usageHandler(db))
+	api.POST("/me/integrations/:id/reconnect", reconnectIntegrationHandler(db))
+	api.POST("/me/merge", mergeMeHandler(db))
+	api.POST("/me/deactivate", deactivateMeHandler(db))
+	api.GET("/me/authorizations", listAuthorizationsHandler(db))
+	api.DELETE("/me/authorizations/:app_id", revokeAuthorizationHandler(db))
+
+	api.GET("/oauth/apps", listOAuthAppsHandler(db))
+	api.POST("/oauth/apps", createOAuthAppHandler(db))
+	api.DELETE("/oauth/apps/:id", deleteOAuthAppHandler(db))
+	api.GET("/oauth/authorize", authorizeInfoHandler(db))
+	api.POST("/oauth/authorize", authorizeDecisionHandler(db))
+
+	api.GET("/notifications/channels", listChannelsHandler(db))
+	api.POST("/notifications/channels", createChannelHandler(db))
+	api.PATCH("/notifications/channels/:id", updateChannelHandler(db))
+	api.DELETE("/notifications/channels/:id", deleteChannelHandler(db))
+	api.POST("/notifications/channels/:id/test", testChannelHandler(db))
+}
+
 // ========= AUTH =========
 
 func registerHandler(db *gorm.DB) gin.HandlerFunc {
 	type inT struct {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required,min=6"`
+		// InviteCode permite registrarse aunque el modo de registro no lo deje.
+		InviteCode string `json:"invite_code"`
 	}
 	return func(c *gin.Context) {
+		if passwordLoginDisabled {
+			c.JSON(403, gin.H{"error": "registro con contraseña desactivado, usa SSO"})
+			return
+		}
+		if setupNeeded(db) {
+			c.JSON(403, gin.H{"error": errSetupPending.Error()})
+			return
+		}
 		var in inT
 		if err := c.ShouldBindJSON(&in); err != nil {
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
+		invite, err := checkRegistration(db, in.Email, in.InviteCode)
+		if err != nil {
+			c.JSON(403, gin.H{"error": err.Error()})
+			return
+		}
+		rejected, warning := checkBreachedPassword(c.Request.Context(), in.Password)
+		if rejected {
+			c.JSON(400, gin.H{"error": breachedPasswordMsg})
+			return
+		}
 		hash, _ := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
 		u := User{Email: strings.ToLower(in.Email), PasswordHash: string(hash)}
-		if err := db.Create(&u).Error; err != nil {
-			c.JSON(409, gin.H{"error": "email ya registrado"})
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&u).Error; err != nil {
+				return err
+			}
+			if invite != nil {
+				return consumeInvite(tx, invite, u.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(409, gin.H{"error": "email ya registrado o invitación ya usada"})
 			return
 		}
-		c.JSON(201, gin.H{"id": u.ID, "email": u.Email})
+		if err := queueEmail(requestDB(db, c.Request.Context()), u.ID, "welcome", nil); err != nil {
+			log.Printf("[MAIL] no pude encolar la bienvenida de %s: %v", u.Email, err)
+		}
+		resp := gin.H{"id": u.ID, "email": u.Email}
+		if warning != "" {
+			resp["warning"] = warning
+		}
+		c.JSON(201, resp)
 	}
 }
 
@@ -122,29 +489,75 @@ func loginHandler(db *gorm.DB) gin.HandlerFunc {
 	type inT struct {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required"`
+		// Reactivate reactiva una cuenta que desactivó su propio dueño.
+		Reactivate bool `json:"reactivate"`
 	}
 	return func(c *gin.Context) {
+		if passwordLoginDisabled {
+			c.JSON(403, gin.H{"error": "login con contraseña desactivado, usa SSO"})
+			return
+		}
 		var in inT
 		if err := c.ShouldBindJSON(&in); err != nil {
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
-		var u User
-		if err := db.Where("email = ?", strings.ToLower(in.Email)).First(&u).Error; err != nil {
-			c.JSON(401, gin.H{"error": "credenciales inválidas"})
+		email := strings.ToLower(in.Email)
+		if wait := loginGuard.blockedFor(email); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(429, gin.H{"error": "demasiados intentos, espera antes de reintentar"})
 			return
 		}
-		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(in.Password)) != nil {
-			c.JSON(401, gin.H{"error": "credenciales inválidas"})
-			return
+		var u User
+		ldapOK := false
+		if ldapAuth != nil {
+			var err error
+			u, err = ldapAuth.authenticate(db, email, in.Password)
+			switch {
+			case err == nil:
+				ldapOK = true
+			case errors.Is(err, errLDAPNoSuchUser) && ldapAuth.fallbackLocal:
+			case errors.Is(err, errSetupPending):
+				c.JSON(403, gin.H{"error": err.Error()})
+				return
+			case errors.Is(err, errBadCredentials), errors.Is(err, errLDAPNoSuchUser):
+				loginGuard.fail(email)
+				c.JSON(401, gin.H{"error": "credenciales inválidas"})
+				return
+			default:
+				log.Printf("[LDAP] login de %s falló: %v", in.Email, err)
+				c.JSON(503, gin.H{"error": "directorio no disponible"})
+				return
+			}
 		}
-		// JWT 24h
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"sub": u.ID,
-			"exp": time.Now().Add(24 * time.Hour).Unix(),
-			"iat": time.Now().Unix(),
-		})
-		tokStr, err := token.SignedString(jwtSecret)
+		if !ldapOK {
+			// Mismo camino (y mismo coste bcrypt) exista o no el usuario.
+			var found *User
+			if err := db.Where("email = ?", email).First(&u).Error; err == nil {
+				found = &u
+			}
+			if !checkPassword(found, in.Password) {
+				loginGuard.fail(email)
+				c.JSON(401, gin.H{"error": "credenciales inválidas"})
+				return
+			}
+		}
+		loginGuard.succeed(email)
+		if u.DeactivatedAt != nil {
+			if u.DeactivatedBy != DeactivatedBySelf {
+				c.JSON(403, gin.H{"error": "cuenta desactivada"})
+				return
+			}
+			if !in.Reactivate {
+				c.JSON(403, gin.H{"error": "cuenta desactivada; repite el login con \"reactivate\": true para reactivarla"})
+				return
+			}
+			if err := reactivateUser(db, &u, u.ID); err != nil {
+				c.JSON(500, gin.H{"error": "db error"})
+				return
+			}
+		}
+		tokStr, err := issueToken(u)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "no se pudo firmar token"})
 			return
@@ -153,7 +566,17 @@ func loginHandler(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+// issueToken firma un JWT de 24h para u.
+func issueToken(u User) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": u.ID,
+		"exp": time.Now().Add(24 * time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	})
+	return token.SignedString(jwtSecret)
+}
+
+func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		h := c.GetHeader("Authorization")
 		if !strings.HasPrefix(h, "Bearer ") {
@@ -161,32 +584,60 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 		tok := strings.TrimPrefix(h, "Bearer ")
-		parsed, err := jwt.Parse(tok, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("alg inválido")
+		var uid uint64
+		if strings.HasPrefix(tok, oauthAccessPrefix) {
+			// Token de una app de terceros: OAuthScopeGuard limita qué rutas alcanza.
+			t, ok := lookupOAuthAccess(db, tok)
+			if !ok {
+				c.AbortWithStatusJSON(401, gin.H{"error": "token inválido"})
+				return
+			}
+			uid = uint64(t.UserID)
+			c.Set("oauth_scope", t.Scope)
+		} else {
+			var err error
+			if uid, err = parseSessionToken(tok); err != nil {
+				c.AbortWithStatusJSON(401, gin.H{"error": err.Error()})
+				return
 			}
-			return jwtSecret, nil
-		})
-		if err != nil || !parsed.Valid {
-			c.AbortWithStatusJSON(401, gin.H{"error": "token inválido"})
-			return
-		}
-		claims, ok := parsed.Claims.(jwt.MapClaims)
-		if !ok {
-			c.AbortWithStatusJSON(401, gin.H{"error": "claims inválidos"})
-			return
 		}
-		uidF := claims["sub"]
-		uid, ok := toUint(uidF)
-		if !ok {
-			c.AbortWithStatusJSON(401, gin.H{"error": "sub inválido"})
+		// Un usuario desactivado pierde el acceso aunque su token siga vigente.
+		var active struct{ Timezone string }
+		res := db.Model(&User{}).Select("timezone").Where("id = ? AND deactivated_at IS NULL", uid).Limit(1).Scan(&active)
+		if res.Error != nil || res.RowsAffected == 0 {
+			c.AbortWithStatusJSON(401, gin.H{"error": "usuario inactivo"})
 			return
 		}
 		c.Set("user_id", uint(uid))
+		c.Set("timezone", active.Timezone)
+		c.Header("X-Timezone", active.Timezone)
 		c.Next()
 	}
 }
 
+// parseSessionToken valida un JWT emitido por issueToken y devuelve el id del
+// usuario. No mira si la cuenta sigue activa.
+func parseSessionToken(tok string) (uint64, error) {
+	parsed, err := jwt.Parse(tok, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("alg inválido")
+		}
+		return jwtSecret, nil
+	})
+	if err != nil || !parsed.Valid {
+		return 0, errors.New("token inválido")
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, errors.New("claims inválidos")
+	}
+	uid, ok := toUint(claims["sub"])
+	if !ok {
+		return 0, errors.New("sub inválido")
+	}
+	return uid, nil
+}
+
 func toUint(v any) (uint64, bool) {
 	switch t := v.(type) {
 	case float64:
@@ -207,8 +658,46 @@ func toUint(v any) (uint64, bool) {
 func listTasksHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		uid := c.GetUint("user_id")
+		var u User
+		if err := db.Select("id", "list_prefs").First(&u, uid).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		var preset *ViewPreset
+		if id := c.Query("preset"); id != "" {
+			var p ViewPreset
+			q := db.Where("user_id = ?", uid)
+			if id == "default" {
+				q = q.Where("is_default")
+			} else {
+				q = q.Where("id = ?", id)
+			}
+			if err := q.First(&p).Error; err != nil {
+				c.JSON(404, gin.H{"error": "preset no encontrado"})
+				return
+			}
+			preset = &p
+		}
+		opt, err := resolveListOptions(c, u.ListPrefs, preset)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		q := db.Model(&Task{}).Where("user_id = ?", uid)
+		if !opt.ShowCompleted {
+			q = q.Where("NOT done")
+		}
+		if opt.PerPage > 0 {
+			var total int64
+			if err := q.Count(&total).Error; err != nil {
+				c.JSON(500, gin.H{"error": "db error"})
+				return
+			}
+			c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+			q = q.Limit(opt.PerPage).Offset((opt.Page - 1) * opt.PerPage)
+		}
 		var tasks []Task
-		if err := db.Where("user_id = ?", uid).Order("id desc").Find(&tasks).Error; err != nil {
+		if err := q.Order(opt.Sort + " " + opt.Order + " NULLS LAST, id desc").Find(&tasks).Error; err != nil {
 			c.JSON(500, gin.H{"error": "db error"})
 			return
 		}
@@ -218,8 +707,10 @@ func listTasksHandler(db *gorm.DB) gin.HandlerFunc {
 
 func createTaskHandler(db *gorm.DB) gin.HandlerFunc {
 	type inT struct {
-		Title string  `json:"title" binding:"required"`
-		DueAt *string `json:"due_at"` 
+		Title    string        `json:"title" binding:"required"`
+		Priority string        `json:"priority"`
+		DueAt    *string       `json:"due_at"`
+		Reminder *ReminderMeta `json:"reminder"`
 	}
 	return func(c *gin.Context) {
 		uid := c.GetUint("user_id")
@@ -228,19 +719,49 @@ func createTaskHandler(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
+		if in.Priority == "" {
+			in.Priority = "normal"
+		}
+		if !validPriorities[in.Priority] {
+			c.JSON(400, gin.H{"error": "priority debe ser low, normal o high"})
+			return
+		}
+		meta, err := in.Reminder.normalize()
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
 		var due *time.Time
 		if in.DueAt != nil && *in.DueAt != "" {
-			if t, err := time.Parse(time.RFC3339, *in.DueAt); err == nil {
+			t, err := parseAPITime(*in.DueAt, c.GetString("timezone"))
+			if err != nil && timestampsStrict {
+				c.JSON(400, gin.H{"error": "due_at: " + err.Error()})
+				return
+			}
+			if err == nil {
 				due = &t
 			}
 		}
-		t := Task{UserID: uid, Title: in.Title, DueAt: due}
+		if left, err := taskQuotaHeadroom(db, uid); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		} else if left == 0 {
+			c.JSON(403, gin.H{"error": "has llegado al límite de tareas", "limit": quotaTasks})
+			return
+		}
+		t := Task{UserID: uid, Title: in.Title, Priority: in.Priority, DueAt: due, Reminder: meta}
+		if err := runBeforeTaskSave(c.Request.Context(), &t); err != nil {
+			c.JSON(422, gin.H{"error": err.Error()})
+			return
+		}
 		if err := db.Create(&t).Error; err != nil {
 			c.JSON(500, gin.H{"error": "db error"})
 			return
 		}
+		checkTaskQuota(requestDB(db, c.Request.Context()), uid)
+		emitTaskEvent(c.Request.Context(), TaskCreated, t)
 		if t.DueAt != nil {
-			remindersCh <- t.ID
+			reminders.Schedule(t)
 		}
 		c.JSON(201, t)
 	}
@@ -248,9 +769,11 @@ func createTaskHandler(db *gorm.DB) gin.HandlerFunc {
 
 func updateTaskHandler(db *gorm.DB) gin.HandlerFunc {
 	type inT struct {
-		Title *string `json:"title"`
-		Done  *bool   `json:"done"`
-		DueAt *string `json:"due_at"`
+		Title    *string       `json:"title"`
+		Done     *bool         `json:"done"`
+		Priority *string       `json:"priority"`
+		DueAt    *string       `json:"due_at"`
+		Reminder *ReminderMeta `json:"reminder"` // {} los quita
 	}
 	return func(c *gin.Context) {
 		uid := c.GetUint("user_id")
@@ -267,22 +790,51 @@ func updateTaskHandler(db *gorm.DB) gin.HandlerFunc {
 		if in.Title != nil {
 			t.Title = *in.Title
 		}
-		if in.Done != nil {
+		if in.Done != nil && *in.Done != t.Done {
 			t.Done = *in.Done
+			if t.Done {
+				now := time.Now()
+				t.CompletedAt = &now
+			} else {
+				t.CompletedAt = nil
+			}
+		}
+		if in.Priority != nil {
+			if !validPriorities[*in.Priority] {
+				c.JSON(400, gin.H{"error": "priority debe ser low, normal o high"})
+				return
+			}
+			t.Priority = *in.Priority
+		}
+		if in.Reminder != nil {
+			meta, err := in.Reminder.normalize()
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			t.Reminder = meta
 		}
 		if in.DueAt != nil {
 			if *in.DueAt == "" {
 				t.DueAt = nil
-			} else if parsed, err := time.Parse(time.RFC3339, *in.DueAt); err == nil {
+			} else if parsed, err := parseAPITime(*in.DueAt, c.GetString("timezone")); err == nil {
 				t.DueAt = &parsed
+			} else if timestampsStrict {
+				c.JSON(400, gin.H{"error": "due_at: " + err.Error()})
+				return
 			}
 		}
+		if err := runBeforeTaskSave(c.Request.Context(), &t); err != nil {
+			c.JSON(422, gin.H{"error": err.Error()})
+			return
+		}
 		if err := db.Save(&t).Error; err != nil {
 			c.JSON(500, gin.H{"error": "db error"})
 			return
 		}
+		emitTaskEvent(c.Request.Context(), TaskUpdated, t)
 		if t.DueAt != nil && !t.Done {
-			remindersCh <- t.ID
+			reminders.Schedule(t)
 		}
 		c.JSON(200, t)
 	}
@@ -291,39 +843,21 @@ func updateTaskHandler(db *gorm.DB) gin.HandlerFunc {
 func deleteTaskHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		uid := c.GetUint("user_id")
-		res := db.Where("user_id = ? AND id = ?", uid, c.Param("id")).Delete(&Task{})
-		if res.Error != nil {
-			c.JSON(500, gin.H{"error": "db error"})
+		var t Task
+		if err := db.Where("user_id = ? AND id = ?", uid, c.Param("id")).First(&t).Error; err != nil {
+			c.JSON(404, gin.H{"error": "task no encontrada"})
 			return
 		}
-		if res.RowsAffected == 0 {
-			c.JSON(404, gin.H{"error": "task no encontrada"})
+		if legalHoldBlocks(c, db, []uint{uid}, "task.delete") {
 			return
 		}
+		if err := db.Delete(&t).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		db.Where("task_id = ?", t.ID).Delete(&TaskView{})
+		checkTaskQuota(requestDB(db, c.Request.Context()), uid)
+		emitTaskEvent(c.Request.Context(), TaskDeleted, t)
 		c.JSON(200, gin.H{"deleted": c.Param("id")})
 	}
 }
-
-
-// ========= REMINDERS =========
-
-func startReminderWorker(db *gorm.DB, ch <-chan uint) {
-	for id := range ch {
-		go func(taskID uint) {
-			var t Task
-			if err := db.First(&t, taskID).Error; err != nil {
-				return
-			}
-			if t.DueAt == nil || t.Done {
-				return
-			}
-			delay := time.Until(*t.DueAt)
-			if delay < 0 {
-				delay = 0
-			}
-			time.AfterFunc(delay, func() {
-				log.Printf("[REMINDER] Task #%d (user %d): %q vence ahora", t.ID, t.UserID, t.Title)
-			})
-		}(id)
-	}
-}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Los benchmarks de listar y crear tareas miden el camino completo del
+// handler contra Postgres, con y sin la caché de sentencias de GORM
+// (DB_PREPARE_STMT). Para comparar modos de pgx, lanzarlos con
+// DB_QUERY_EXEC_MODE=... :
+//
+//	TASKFLOW_BENCH_DSN=postgres://... go test -run '^$' -bench 'ListTasks|CreateTask' -benchmem
+
+func BenchmarkListTasks(b *testing.B) {
+	for _, prepare := range []bool{true, false} {
+		b.Run(prepareName(prepare), func(b *testing.B) {
+			db := benchDB(b, prepare)
+			u := benchUser(b, db, 500)
+			r := gin.New()
+			r.GET("/api/tasks", asUser(u), listTasksHandler(db))
+			for b.Loop() {
+				if w := doRequest(r, "GET", "/api/tasks?per_page=50", ""); w.Code != 200 {
+					b.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCreateTask(b *testing.B) {
+	for _, prepare := range []bool{true, false} {
+		b.Run(prepareName(prepare), func(b *testing.B) {
+			db := benchDB(b, prepare)
+			u := benchUser(b, db, 0)
+			r := gin.New()
+			r.POST("/api/tasks", asUser(u), createTaskHandler(db))
+			for b.Loop() {
+				req := httptest.NewRequest("POST", "/api/tasks", strings.NewReader(`{"title":"bench","priority":"high"}`))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != 201 {
+					b.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+			}
+		})
+	}
+}
+
+func prepareName(prepare bool) string {
+	if prepare {
+		return "prepare"
+	}
+	return "noprepare"
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= FUSIÓN DE CUENTAS =========
+//
+// Quien se registró dos veces (con contraseña y con SSO) junta las cuentas en
+// una: todo lo de la cuenta origen pasa a la destino, en una transacción, y la
+// origen se borra. El vínculo SSO y el teléfono verificado se conservan si la
+// destino no los tiene, para que el login con Google siga llevando a la misma
+// cuenta. Queda un evento "account.merged" en el registro de la destino.
+
+// mergeModels son las tablas con user_id que se re-asignan.
+var mergeModels = map[string]any{
+	"tasks":          &Task{},
+	"task_views":     &TaskView{},
+	"channels":       &NotificationChannel{},
+	"searches":       &SavedSearch{},
+	"events":         &Event{},
+	"imports":        &Import{},
+	"digest_items":   &DigestItem{},
+	"oauth_apps":     &OAuthApp{},
+	"oauth_codes":    &OAuthCode{},
+	"oauth_tokens":   &OAuthToken{},
+	"view_presets":   &ViewPreset{},
+	"point_awards":   &PointAward{},
+	"achievements":   &Achievement{},
+	"habits":         &Habit{},
+	"habit_checkins": &HabitCheckin{},
+	"focus_items":    &FocusItem{},
+}
+
+var errMergeSelf = errors.New("no se puede fusionar una cuenta consigo misma")
+
+// mergeUsers mueve todo de src a dst y borra src; by es quien lo pidió (el
+// propio usuario o un admin). Devuelve cuántas filas se movieron por tabla.
+// El avatar de src pasa a dst si dst no tiene; si no, se borra del blob store
+// después de confirmar.
+func mergeUsers(db *gorm.DB, src, dst User, by uint) (map[string]int64, error) {
+	if src.ID == dst.ID {
+		return nil, errMergeSelf
+	}
+	moved := map[string]int64{}
+	orphanAvatar := ""
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if held, err := heldUserIDs(tx, []uint{src.ID}); err != nil {
+			return err
+		} else if len(held) > 0 {
+			return errLegalHold
+		}
+		// Los presets de vista tienen nombre único por usuario y un solo
+		// predeterminado: los de src que choquen se renombran y manda el de dst.
+		if err := tx.Exec(`UPDATE view_presets SET name = name || ' (' || ? || ')' WHERE user_id = ? AND name IN (SELECT name FROM view_presets WHERE user_id = ?)`,
+			src.Email, src.ID, dst.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE view_presets SET is_default = false WHERE user_id = ? AND EXISTS (SELECT 1 FROM view_presets WHERE user_id = ? AND is_default)`,
+			src.ID, dst.ID).Error; err != nil {
+			return err
+		}
+		// Un logro que ya tiene dst no se duplica.
+		if err := tx.Exec(`DELETE FROM achievements WHERE user_id = ? AND code IN (SELECT code FROM achievements WHERE user_id = ?)`,
+			src.ID, dst.ID).Error; err != nil {
+			return err
+		}
+		for name, model := range mergeModels {
+			res := tx.Model(model).Where("user_id = ?", src.ID).Update("user_id", dst.ID)
+			if res.Error != nil {
+				return res.Error
+			}
+			moved[name] = res.RowsAffected
+		}
+		updates := map[string]any{}
+		if dst.OIDCSubject == "" && src.OIDCSubject != "" {
+			updates["oidc_subject"] = src.OIDCSubject
+		}
+		if !dst.PhoneVerified && src.PhoneVerified {
+			updates["phone"], updates["phone_verified"] = src.Phone, true
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", dst.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if src.AvatarKey != "" {
+			res := tx.Model(&User{}).Where("id = ? AND avatar_key = ''", dst.ID).Update("avatar_key", src.AvatarKey)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				orphanAvatar = src.AvatarKey
+			}
+		}
+		if err := tx.Where("user_id = ?", src.ID).Delete(&QuotaWarning{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&User{}, src.ID).Error; err != nil {
+			return err
+		}
+		recordEvent(tx, dst.ID, "account.merged", nil, gin.H{"from_user_id": src.ID, "from_email": src.Email, "by": by, "moved": moved})
+		return nil
+	})
+	if err == nil && orphanAvatar != "" {
+		deleteBlobs([]string{orphanAvatar})
+	}
+	return moved, err
+}
+
+// mergeMeHandler fusiona en la cuenta actual otra de la que el usuario tiene
+// sesión: presenta su JWT (vale tanto para cuentas con contraseña como SSO).
+func mergeMeHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		SourceToken string `json:"source_token" binding:"required"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		srcID, err := parseSessionToken(in.SourceToken)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "source_token: " + err.Error()})
+			return
+		}
+		var src, dst User
+		if err := db.First(&dst, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		if err := db.Where("deactivated_at IS NULL").First(&src, srcID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "la cuenta origen no existe o está desactivada"})
+			return
+		}
+		switch {
+		case src.IsDemo || dst.IsDemo:
+			c.JSON(403, gin.H{"error": "las cuentas demo no se fusionan"})
+			return
+		case src.Role == RoleAdmin:
+			c.JSON(403, gin.H{"error": "una cuenta admin solo la puede fusionar otro admin"})
+			return
+		}
+		if legalHoldBlocks(c, db, []uint{src.ID}, "account.merge") {
+			return
+		}
+		moved, err := mergeUsers(db, src, dst, dst.ID)
+		if errors.Is(err, errMergeSelf) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errLegalHold) {
+			c.JSON(423, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"merged_into": dst.ID, "moved": moved})
+	}
+}
+
+// adminMergeUserHandler fusiona :id en la cuenta "into".
+func adminMergeUserHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Into uint `json:"into" binding:"required"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var src, dst User
+		if err := db.First(&src, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		if err := db.First(&dst, in.Into).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario destino no encontrado"})
+			return
+		}
+		if src.Role == RoleAdmin && dst.Role != RoleAdmin && !otherAdminsExist(db, src.ID) {
+			c.JSON(409, gin.H{"error": "no se puede fusionar el último admin en una cuenta sin rol admin"})
+			return
+		}
+		if legalHoldBlocks(c, db, []uint{src.ID}, "account.merge") {
+			return
+		}
+		moved, err := mergeUsers(db, src, dst, c.GetUint("user_id"))
+		if errors.Is(err, errMergeSelf) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errLegalHold) {
+			c.JSON(423, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"merged_into": dst.ID, "moved": moved})
+	}
+}
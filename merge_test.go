@@ -0,0 +1,59 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectMerge son las consultas de mergeUsers hasta el avatar; avatarMoved
+// es lo que devuelve el UPDATE que se lo pasa a dst (1 si dst no tenía).
+func expectMerge(mock sqlmock.Sqlmock, avatarMoved int64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`legal_hold_at IS NOT NULL`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	for range 3 { // presets renombrados, predeterminado y logros repetidos
+		mock.ExpectExec(`.`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	for range mergeModels {
+		mock.ExpectExec(`UPDATE "[a-z_]+" SET "user_id"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec(`UPDATE "users" SET "avatar_key"=.* avatar_key = ''`).
+		WillReturnResult(sqlmock.NewResult(0, avatarMoved))
+	mock.ExpectExec(`DELETE FROM "quota_warnings"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "users"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "events"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+}
+
+func TestMergeMovesAvatarToTargetWithout(t *testing.T) {
+	blobs := withRecordingBlobStore(t)
+	db, mock := newMockDB(t)
+	expectMerge(mock, 1)
+	src := User{ID: 5, Email: "old@example.com", AvatarKey: "avatars/5/abc.png"}
+	if _, err := mergeUsers(db, src, User{ID: 6}, 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs.deleted) > 0 {
+		t.Fatalf("borró %v, que ahora es el avatar de dst", blobs.deleted)
+	}
+}
+
+func TestMergeDeletesAvatarWhenTargetHasOne(t *testing.T) {
+	blobs := withRecordingBlobStore(t)
+	db, mock := newMockDB(t)
+	expectMerge(mock, 0)
+	src := User{ID: 5, Email: "old@example.com", AvatarKey: "avatars/5/abc.png"}
+	if _, err := mergeUsers(db, src, User{ID: 6, AvatarKey: "avatars/6/def.png"}, 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"avatars/5/abc.png"}; !slices.Equal(blobs.deleted, want) {
+		t.Fatalf("borrados %v, quería %v", blobs.deleted, want)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+// ========= METRICS =========
+//
+// queryMetrics es un plugin de GORM que mide cada consulta. La etiqueta por
+// defecto es "<operación> <tabla>"; una consulta concreta puede ponerle
+// nombre propio con db.Set(queryLabelKey, "stats.per_day").
+//
+// Las consultas que tardan más de SLOW_QUERY_MS (200 por defecto) se loguean
+// con el SQL tal cual lo preparó GORM: los valores van como $1, $2... y nunca
+// se imprimen, así que emails o contraseñas no acaban en el log.
+
+const queryLabelKey = "metrics:label"
+
+var dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "taskflow_db_query_duration_seconds",
+	Help:    "Duración de las consultas a Postgres por etiqueta.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+}, []string{"label", "error"})
+
+type queryMetrics struct {
+	slow time.Duration
+}
+
+func newQueryMetrics() *queryMetrics {
+	return &queryMetrics{slow: time.Duration(getEnvInt("SLOW_QUERY_MS", 200)) * time.Millisecond}
+}
+
+func (*queryMetrics) Name() string { return "taskflow:query-metrics" }
+
+func (m *queryMetrics) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		op     string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, h := range hooks {
+		if err := h.before("metrics:before_"+h.op, m.start); err != nil {
+			return err
+		}
+		if err := h.after("metrics:after_"+h.op, m.finish(h.op)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*queryMetrics) start(db *gorm.DB) {
+	db.InstanceSet("metrics:start", time.Now())
+}
+
+func (m *queryMetrics) finish(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet("metrics:start")
+		if !ok {
+			return
+		}
+		elapsed := time.Since(v.(time.Time))
+		label := op + " " + db.Statement.Table
+		if l, ok := db.Get(queryLabelKey); ok {
+			label = l.(string)
+		}
+		failed := "false"
+		if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+			failed = "true"
+		}
+		dbQueryDuration.WithLabelValues(label, failed).Observe(elapsed.Seconds())
+		if m.slow > 0 && elapsed >= m.slow {
+			log.Printf("[SLOW SQL] %s %v (%d parámetros omitidos): %s",
+				label, elapsed.Round(time.Millisecond), len(db.Statement.Vars), db.Statement.SQL.String())
+		}
+	}
+}
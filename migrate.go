@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ========= MIGRATIONS =========
+//
+// Despliegue sin cortes: la versión nueva y la vieja conviven unos minutos
+// contra la misma base de datos, así que las migraciones solo pueden añadir
+// (tablas, columnas con default o NULL, índices CONCURRENTLY). checkMigrations
+// rechaza al arrancar cualquier SQL que rompa la versión anterior; si de
+// verdad hace falta (en una release con parada), el SQL debe empezar por
+// "-- breaking:" con el motivo.
+//
+// Todo corre bajo un advisory lock de Postgres: si arrancan varias réplicas a
+// la vez, una migra y las demás esperan.
+//
+// MIGRATIONS_MODE=background aplica en el arranque solo lo rápido
+// (AutoMigrate) y deja los rellenos e índices al trabajo "migrate.background";
+// el servidor atiende mientras tanto (búsqueda, sugerencias y estadísticas
+// pueden fallar hasta que termine).
+
+const migrationLockID = 727_001_749
+
+type migration struct {
+	name  string
+	stmts []string
+}
+
+// sqlMigrations en orden: suggest usa f_unaccent, que crea search.
+var sqlMigrations = []migration{
+	{"recent", recentMigrations},
+	{"search", searchMigrations},
+	{"stats", statsMigrations},
+	{"suggest", suggestMigrations},
+	{"timestamps", timestampMigrations},
+}
+
+// breakingSQL: una regla salta si el SQL encaja con re y no contiene unless.
+var breakingSQL = []struct {
+	re     *regexp.Regexp
+	unless string
+	reason string
+}{
+	{regexp.MustCompile(`(?i)\bDROP\s+(TABLE|COLUMN)\b`), "", "borra datos que la versión anterior aún lee"},
+	{regexp.MustCompile(`(?i)\bRENAME\b`), "", "la versión anterior sigue usando el nombre viejo"},
+	{regexp.MustCompile(`(?i)\bALTER\s+COLUMN\s+\S+\s+(SET\s+DATA\s+)?TYPE\b`), "", "cambiar el tipo reescribe la tabla y bloquea"},
+	{regexp.MustCompile(`(?i)\bSET\s+NOT\s+NULL\b`), "", "la versión anterior puede seguir insertando NULL"},
+	{regexp.MustCompile(`(?i)\bCREATE\s+(UNIQUE\s+)?INDEX\b`), "CONCURRENTLY", "CREATE INDEX sin CONCURRENTLY bloquea las escrituras"},
+}
+
+// checkMigrations devuelve todas las infracciones, no solo la primera.
+func checkMigrations(ms []migration) error {
+	var problems []string
+	for _, m := range ms {
+		for i, stmt := range m.stmts {
+			if strings.HasPrefix(strings.TrimSpace(stmt), "-- breaking:") {
+				continue
+			}
+			for _, rule := range breakingSQL {
+				if rule.re.MatchString(stmt) && (rule.unless == "" || !strings.Contains(strings.ToUpper(stmt), rule.unless)) {
+					problems = append(problems, fmt.Sprintf("%s[%d]: %s", m.name, i, rule.reason))
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("migraciones no compatibles con la versión anterior:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// withMigrationLock ejecuta fn en una conexión que tiene el advisory lock. El
+// lock es de sesión, así que todo debe ir por esa misma conexión.
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+			return err
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockID)
+		return fn(conn)
+	})
+}
+
+func runSQLMigrations(conn *gorm.DB) error {
+	for _, m := range sqlMigrations {
+		for _, stmt := range m.stmts {
+			if err := conn.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("migración %s: %w", m.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// runMigrations se llama al arrancar, antes de servir tráfico.
+func runMigrations(db *gorm.DB) error {
+	if err := checkMigrations(sqlMigrations); err != nil {
+		return err
+	}
+	background := getEnv("MIGRATIONS_MODE", "foreground") == "background"
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		if err := conn.AutoMigrate(&User{}, &Task{}, &NotificationChannel{}, &TaskView{}, &SavedSearch{}, &Job{}, &Event{}, &Import{}, &LoginFailure{}, &RateWindow{}, &DigestItem{}, &OAuthApp{}, &OAuthCode{}, &OAuthToken{}, &Setting{}, &Invite{}, &QuotaWarning{}, &ViewPreset{}, &PointAward{}, &Achievement{}, &Habit{}, &HabitCheckin{}, &FocusItem{}); err != nil {
+			return err
+		}
+		if !conn.Migrator().HasTable(&User{}) || !conn.Migrator().HasTable(&Task{}) {
+			return fmt.Errorf("migración NO creó tablas users/tasks (revisar DSN o permisos)")
+		}
+		if err := promoteAdmins(conn); err != nil {
+			return fmt.Errorf("no puedo aplicar ADMIN_EMAILS: %w", err)
+		}
+		if background {
+			var n int64
+			conn.Model(&Job{}).Where("kind = ? AND status IN ?", "migrate.background", []string{JobPending, JobRunning}).Count(&n)
+			if n == 0 {
+				if _, err := enqueueJob(conn, "migrate.background", nil); err != nil {
+					return err
+				}
+			}
+			log.Println("MIGRATIONS_MODE=background: rellenos e índices quedan en la cola de trabajos")
+			return nil
+		}
+		return runSQLMigrations(conn)
+	})
+}
+
+func backgroundMigrationsJob(_ context.Context, db *gorm.DB, _ Job) error {
+	if err := withMigrationLock(db, runSQLMigrations); err != nil {
+		return err
+	}
+	log.Println("migraciones en segundo plano listas")
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ========= DESTINOS DE LOS CANALES =========
+//
+// Las URLs de los canales (webhook de Discord, servidor de Matrix, ntfy o
+// Gotify) las pone el usuario, y quien las llama es el servidor: sin freno,
+// un canal apuntando a 10.0.0.5:6379 y POST .../test sirven para explorar la
+// red interna. Por eso channelClient no conecta con direcciones de loopback,
+// privadas, link-local ni sin especificar. Se mira la IP a la que de verdad
+// se conecta, después de resolver el nombre: un DNS que cambia de respuesta
+// no se la salta. Al crear el canal se rechazan ya las IPs y "localhost"
+// escritos tal cual.
+//
+// Un ntfy o Gotify propio dentro de la red se permite por nombre (o IP) con
+// NOTIFY_PRIVATE_HOSTS=ntfy.lan,10.0.0.7.
+
+var (
+	notifyPrivateHosts = splitList(strings.ToLower(os.Getenv("NOTIFY_PRIVATE_HOSTS")))
+	errPrivateHost     = errors.New("el destino está en una red interna (ver NOTIFY_PRIVATE_HOSTS)")
+)
+
+// blockedIP indica si ip es de las que channelClient no llama.
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+func privateHostAllowed(host string) bool {
+	return containsString(notifyPrivateHosts, strings.ToLower(host))
+}
+
+// checkPublicURL rechaza las URLs que ya se sabe que van a la red interna sin
+// resolver nada. Los nombres que resuelven dentro los para el dial.
+func checkPublicURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(u.Hostname())
+	if privateHostAllowed(host) {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errPrivateHost
+	}
+	if ip := net.ParseIP(host); ip != nil && blockedIP(ip) {
+		return errPrivateHost
+	}
+	return nil
+}
+
+// publicOnlyTransport es el transporte por defecto con un dial que comprueba
+// la IP final (ver arriba); los hosts de NOTIFY_PRIVATE_HOSTS van sin control.
+func publicOnlyTransport() *http.Transport {
+	open := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	guarded := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return errPrivateHost
+			}
+			return nil
+		}}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err == nil && privateHostAllowed(host) {
+			return open.DialContext(ctx, network, addr)
+		}
+		return guarded.DialContext(ctx, network, addr)
+	}
+	return t
+}
+
+// notifyStatusError es una respuesta no 2xx del proveedor.
+type notifyStatusError struct {
+	Code int
+	Host string
+}
+
+func (e *notifyStatusError) Error() string {
+	return fmt.Sprintf("respuesta %d de %s", e.Code, e.Host)
+}
+
+// channelErrorSummary es lo que ve el usuario de un envío fallido (respuesta
+// de POST .../test, last_error, eventos channel.failed). Los fallos de red
+// quedan en un mensaje fijo: el texto de Go dice qué IP y puerto contestaron
+// y cómo, justo lo que busca quien explora. El detalle va solo al log.
+func channelErrorSummary(err error) string {
+	var status *notifyStatusError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errPrivateHost):
+		return errPrivateHost.Error()
+	case errors.As(err, &status):
+		return fmt.Sprintf("el proveedor respondió %d", status.Code)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "el proveedor no respondió a tiempo"
+	case errors.As(err, new(*url.Error)), errors.As(err, &netErr):
+		return "no se pudo conectar con el proveedor"
+	}
+	return err.Error()
+}
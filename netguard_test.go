@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestBlockedIP(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"127.0.0.1":       true,
+		"10.0.0.5":        true,
+		"172.16.3.4":      true,
+		"192.168.1.10":    true,
+		"169.254.169.254": true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"::ffff:10.0.0.1": true,
+		"8.8.8.8":         false,
+		"2606:4700::1111": false,
+	} {
+		if got := blockedIP(net.ParseIP(ip)); got != want {
+			t.Errorf("blockedIP(%s) = %v, quería %v", ip, got, want)
+		}
+	}
+}
+
+func TestValidateChannelRejectsInternalURLs(t *testing.T) {
+	setupTestNotifiers(t)
+	for _, ch := range []NotificationChannel{
+		{Kind: "discord", WebhookURL: "http://127.0.0.1:6379/"},
+		{Kind: "discord", WebhookURL: "http://localhost/api/webhooks/1"},
+		{Kind: "matrix", ServerURL: "http://169.254.169.254", RoomID: "!r:x", AccessToken: "t"},
+		{Kind: "matrix", ServerURL: "https://[::1]:8448", RoomID: "!r:x", AccessToken: "t"},
+		{Kind: "ntfy", ServerURL: "http://10.1.2.3", Topic: "x"},
+	} {
+		if err := validateChannel(&ch); !errors.Is(err, errPrivateHost) {
+			t.Errorf("%s %s%s: err = %v, quería errPrivateHost", ch.Kind, ch.WebhookURL, ch.ServerURL, err)
+		}
+	}
+	ok := NotificationChannel{Kind: "matrix", ServerURL: "https://matrix.example.com", RoomID: "!r:x", AccessToken: "t"}
+	if err := validateChannel(&ok); err != nil {
+		t.Errorf("un homeserver público no debería fallar: %v", err)
+	}
+}
+
+func TestValidateChannelAllowsListedPrivateHost(t *testing.T) {
+	setupTestNotifiers(t)
+	withPrivateHosts(t, "ntfy.lan", "10.0.0.7")
+	for _, ch := range []NotificationChannel{
+		{Kind: "ntfy", ServerURL: "http://ntfy.lan", Topic: "x"},
+		{Kind: "gotify", ServerURL: "http://10.0.0.7:8080", AccessToken: "t"},
+	} {
+		if err := validateChannel(&ch); err != nil {
+			t.Errorf("%s: %v", ch.ServerURL, err)
+		}
+	}
+}
+
+// El control va en el dial, sobre la IP ya resuelta: un nombre que resuelve a
+// loopback tampoco pasa.
+func TestChannelClientRefusesInternalAddresses(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits++ }))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	byName := "http://localhost:" + u.Port()
+
+	for _, target := range []string{srv.URL, byName} {
+		err := doJSON(context.Background(), http.MethodPost, target, "", map[string]string{})
+		if !errors.Is(err, errPrivateHost) {
+			t.Errorf("%s: err = %v, quería errPrivateHost", target, err)
+		}
+	}
+	if hits != 0 {
+		t.Fatalf("llegaron %d peticiones al servidor interno", hits)
+	}
+
+	withPrivateHosts(t, "127.0.0.1")
+	if err := doJSON(context.Background(), http.MethodPost, srv.URL, "", map[string]string{}); err != nil {
+		t.Fatalf("con NOTIFY_PRIVATE_HOSTS debería pasar: %v", err)
+	}
+}
+
+func TestChannelErrorSummaryHidesNetworkDetails(t *testing.T) {
+	dialErr := &url.Error{Op: "Post", URL: "http://10.0.0.5:6379", Err: &net.OpError{Op: "dial", Net: "tcp",
+		Err: fmt.Errorf("connect: connection refused")}}
+	for err, want := range map[error]string{
+		dialErr: "no se pudo conectar con el proveedor",
+		&url.Error{Op: "Post", URL: "http://10.0.0.5", Err: &net.OpError{Op: "dial", Err: errPrivateHost}}: errPrivateHost.Error(),
+		&notifyStatusError{Code: 401, Host: "matrix.example.com"}:                                          "el proveedor respondió 401",
+		fmt.Errorf("envío: %w", context.DeadlineExceeded):                                                  "el proveedor no respondió a tiempo",
+		errors.New("teléfono sin verificar"):                                                               "teléfono sin verificar",
+	} {
+		got := channelErrorSummary(err)
+		if got != want {
+			t.Errorf("channelErrorSummary(%v) = %q, quería %q", err, got, want)
+		}
+		if strings.Contains(got, "10.0.0.5") {
+			t.Errorf("el resumen deja ver la dirección: %q", got)
+		}
+	}
+}
+
+func setupTestNotifiers(t *testing.T) {
+	t.Helper()
+	if err := setupNotifiers(nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { notifiers = map[string]Notifier{} })
+}
+
+func withPrivateHosts(t *testing.T, hosts ...string) {
+	t.Helper()
+	prev := notifyPrivateHosts
+	notifyPrivateHosts = hosts
+	t.Cleanup(func() { notifyPrivateHosts = prev })
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= NOTIFICATIONS =========
+
+// NotificationChannel es un destino de notificaciones configurado por el usuario.
+// Los campos usados dependen de Kind:
+//   - discord: WebhookURL
+//   - matrix:  ServerURL (homeserver), RoomID, AccessToken
+//   - sms:     sin configuración; usa el teléfono verificado del usuario
+//   - ntfy:    ServerURL, Topic y AccessToken opcional
+//   - gotify:  ServerURL y AccessToken (token de aplicación)
+//   - email:   sin configuración; usa el email de la cuenta
+type NotificationChannel struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"index;not null" json:"user_id"`
+	Kind        string    `gorm:"not null" json:"kind"`
+	WebhookURL  string    `json:"webhook_url,omitempty"`
+	ServerURL   string    `json:"server_url,omitempty"`
+	RoomID      string    `json:"room_id,omitempty"`
+	Topic       string    `json:"topic,omitempty"`
+	AccessToken string    `json:"-"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Resultado del último envío (ver integrations.go).
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// Notification es el mensaje a entregar. Channel lo rellena el dispatcher con
+// el destino concreto antes de llamar al Notifier.
+type Notification struct {
+	UserID   uint
+	TaskID   uint
+	Priority string
+	Title    string
+	Body     string
+	Reminder *ReminderMeta // solo en recordatorios de tareas
+	Channel  NotificationChannel
+}
+
+// Notifier entrega una notificación a través de un proveedor concreto.
+type Notifier interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// errNotifySkipped lo devuelve un Notifier que, por norma, no envía esta
+// notificación (el SMS solo lleva prioridad alta). No es ni éxito ni fallo:
+// no se apunta en el canal.
+var errNotifySkipped = errors.New("el canal no envía esta notificación")
+
+// notifierFactories registra los proveedores disponibles por nombre. Para añadir
+// uno nuevo basta con registrarlo aquí (o desde un init en su propio fichero).
+var notifierFactories = map[string]func(db *gorm.DB) Notifier{
+	"discord": func(*gorm.DB) Notifier { return discordNotifier{} },
+	"matrix":  func(*gorm.DB) Notifier { return matrixNotifier{} },
+	"ntfy":    func(*gorm.DB) Notifier { return ntfyNotifier{} },
+	"gotify":  func(*gorm.DB) Notifier { return gotifyNotifier{} },
+	"sms":     func(db *gorm.DB) Notifier { return &smsNotifier{db: db, provider: smsProvider} },
+	"email":   func(db *gorm.DB) Notifier { return &emailNotifier{db: db} },
+	"log":     func(*gorm.DB) Notifier { return logNotifier{} },
+}
+
+func registerNotifier(name string, factory func(db *gorm.DB) Notifier) {
+	notifierFactories[name] = factory
+}
+
+// notifiers asocia cada tipo de canal con el Notifier que lo atiende.
+var notifiers = map[string]Notifier{}
+
+const defaultNotifiers = "discord,matrix,ntfy,gotify,sms,email"
+
+// setupNotifiers lee NOTIFIERS ("discord,matrix,sms=log,...") y construye el
+// mapa tipo de canal -> proveedor. "kind=proveedor" permite sustituir la
+// implementación de un tipo (p.ej. sms=log en desarrollo); los tipos que no
+// aparecen quedan desactivados.
+func setupNotifiers(db *gorm.DB) error {
+	notifiers = map[string]Notifier{}
+	for _, item := range strings.Split(getEnv("NOTIFIERS", defaultNotifiers), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kind, provider, found := strings.Cut(item, "=")
+		if !found {
+			provider = kind
+		}
+		factory, ok := notifierFactories[provider]
+		if !ok {
+			return fmt.Errorf("proveedor de notificaciones desconocido: %s", provider)
+		}
+		notifiers[kind] = factory(db)
+	}
+	return nil
+}
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// channelClient llama a las URLs que pone el usuario en sus canales: no sale
+// a la red interna (ver netguard.go). notifyClient queda para lo que configura
+// el operador (SMS, correo, CDN).
+var channelClient = &http.Client{Timeout: 10 * time.Second, Transport: publicOnlyTransport()}
+
+// dispatchNotification envía n a todos los canales activos del usuario.
+// Los errores de un canal se loguean y no impiden el envío al resto.
+func dispatchNotification(db *gorm.DB, n Notification) {
+	if isDemoUser(db, n.UserID) {
+		log.Printf("[NOTIFY] user %d es demo: %s: %s (no se envía)", n.UserID, n.Title, n.Body)
+		return
+	}
+	if !notifyBudget.allow(fmt.Sprint(n.UserID)) {
+		deferToDigest(db, n)
+		return
+	}
+	deliverNotification(db, n)
+}
+
+// deliverNotification envía a todos los canales activos, sin mirar el cupo.
+func deliverNotification(db *gorm.DB, n Notification) {
+	if !userActive(db, n.UserID) {
+		return
+	}
+	var chans []NotificationChannel
+	if err := db.Where("user_id = ? AND enabled = ?", n.UserID, true).Find(&chans).Error; err != nil {
+		log.Printf("[NOTIFY] no puedo leer canales del user %d: %v", n.UserID, err)
+		return
+	}
+	for _, ch := range chans {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		err := sendToChannel(ctx, ch, n)
+		cancel()
+		if errors.Is(err, errNotifySkipped) {
+			continue
+		}
+		if err != nil {
+			log.Printf("[NOTIFY] canal #%d (%s) falló: %v", ch.ID, ch.Kind, err)
+		}
+		recordChannelResult(db, ch, err)
+	}
+}
+
+func sendToChannel(ctx context.Context, ch NotificationChannel, n Notification) error {
+	notifier, ok := notifiers[ch.Kind]
+	if !ok {
+		return fmt.Errorf("tipo de canal desactivado: %s", ch.Kind)
+	}
+	n.Channel = ch
+	return notifier.Send(ctx, n)
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Send(_ context.Context, n Notification) error {
+	log.Printf("[NOTIFY] %s -> user %d: %s: %s", n.Channel.Kind, n.UserID, n.Title, n.Body)
+	return nil
+}
+
+type discordNotifier struct{}
+
+func (discordNotifier) Send(ctx context.Context, n Notification) error {
+	payload := map[string]string{"content": fmt.Sprintf("**%s**\n%s", n.Title, n.Body)}
+	return doJSON(ctx, http.MethodPost, n.Channel.WebhookURL, "", payload)
+}
+
+type matrixNotifier struct{}
+
+func (matrixNotifier) Send(ctx context.Context, n Notification) error {
+	ch := n.Channel
+	txnID := fmt.Sprintf("taskflow-%d", time.Now().UnixNano())
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(ch.ServerURL, "/"), url.PathEscape(ch.RoomID), txnID)
+	payload := map[string]any{
+		"msgtype": "m.text",
+		"body":    n.Title + "\n" + n.Body,
+	}
+	if n.Reminder != nil {
+		payload[matrixReminderKey] = n.Reminder
+	}
+	return doJSON(ctx, http.MethodPut, endpoint, ch.AccessToken, payload)
+}
+
+// ntfy acepta el mensaje como cuerpo plano y el resto como cabeceras.
+// https://docs.ntfy.sh/publish/
+type ntfyNotifier struct{}
+
+func (ntfyNotifier) Send(ctx context.Context, n Notification) error {
+	ch := n.Channel
+	endpoint := strings.TrimRight(ch.ServerURL, "/") + "/" + url.PathEscape(ch.Topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(n.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", n.Title)
+	req.Header.Set("Priority", map[string]string{"low": "low", "high": "high"}[n.Priority])
+	if n.Reminder != nil && n.Reminder.Category != "" {
+		req.Header.Set("Tags", n.Reminder.Category)
+	}
+	if ch.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ch.AccessToken)
+	}
+	resp, err := channelClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &notifyStatusError{Code: resp.StatusCode, Host: req.URL.Host}
+	}
+	return nil
+}
+
+// Gotify usa prioridades 0-10; mapeamos low/normal/high a 2/5/8.
+type gotifyNotifier struct{}
+
+func (gotifyNotifier) Send(ctx context.Context, n Notification) error {
+	prio := map[string]int{"low": 2, "high": 8}[n.Priority]
+	if prio == 0 {
+		prio = 5
+	}
+	endpoint := strings.TrimRight(n.Channel.ServerURL, "/") + "/message?token=" + url.QueryEscape(n.Channel.AccessToken)
+	payload := map[string]any{"title": n.Title, "message": n.Body, "priority": prio}
+	if n.Reminder != nil {
+		payload["extras"] = map[string]any{gotifyReminderKey: n.Reminder}
+	}
+	return doJSON(ctx, http.MethodPost, endpoint, "", payload)
+}
+
+func doJSON(ctx context.Context, method, endpoint, bearer string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := channelClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &notifyStatusError{Code: resp.StatusCode, Host: req.URL.Host}
+	}
+	return nil
+}
+
+// validateChannel comprueba que el canal trae la configuración que necesita su
+// tipo y que sus URLs no apuntan a la red interna.
+func validateChannel(ch *NotificationChannel) error {
+	if _, ok := notifiers[ch.Kind]; !ok {
+		return fmt.Errorf("tipo de canal no disponible en esta instancia: %s", ch.Kind)
+	}
+	switch ch.Kind {
+	case "discord":
+		if !isHTTPURL(ch.WebhookURL) {
+			return fmt.Errorf("webhook_url inválida")
+		}
+		if err := checkPublicURL(ch.WebhookURL); err != nil {
+			return fmt.Errorf("webhook_url: %w", err)
+		}
+	case "matrix":
+		if !isHTTPURL(ch.ServerURL) || ch.RoomID == "" || ch.AccessToken == "" {
+			return fmt.Errorf("matrix requiere server_url, room_id y access_token")
+		}
+	case "ntfy":
+		if !isHTTPURL(ch.ServerURL) || ch.Topic == "" {
+			return fmt.Errorf("ntfy requiere server_url y topic")
+		}
+	case "gotify":
+		if !isHTTPURL(ch.ServerURL) || ch.AccessToken == "" {
+			return fmt.Errorf("gotify requiere server_url y access_token")
+		}
+	}
+	if ch.ServerURL != "" {
+		if err := checkPublicURL(ch.ServerURL); err != nil {
+			return fmt.Errorf("server_url: %w", err)
+		}
+	}
+	return nil
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func listChannelsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		var chans []NotificationChannel
+		if err := db.Where("user_id = ?", uid).Order("id").Find(&chans).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, chans)
+	}
+}
+
+func createChannelHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Kind        string `json:"kind" binding:"required"`
+		WebhookURL  string `json:"webhook_url"`
+		ServerURL   string `json:"server_url"`
+		RoomID      string `json:"room_id"`
+		Topic       string `json:"topic"`
+		AccessToken string `json:"access_token"`
+	}
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		if isDemoUser(db, uid) {
+			c.JSON(403, gin.H{"error": "las cuentas demo no pueden enviar notificaciones externas"})
+			return
+		}
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		ch := NotificationChannel{
+			UserID:      uid,
+			Kind:        strings.ToLower(in.Kind),
+			WebhookURL:  in.WebhookURL,
+			ServerURL:   in.ServerURL,
+			RoomID:      in.RoomID,
+			Topic:       in.Topic,
+			AccessToken: in.AccessToken,
+			Enabled:     true,
+		}
+		if err := validateChannel(&ch); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if ch.Kind == "sms" {
+			var u User
+			if err := db.First(&u, uid).Error; err != nil || !u.PhoneVerified {
+				c.JSON(400, gin.H{"error": "verifica tu teléfono antes de activar SMS"})
+				return
+			}
+		}
+		if err := db.Create(&ch).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(201, ch)
+	}
+}
+
+func updateChannelHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Enabled *bool `json:"enabled"`
+	}
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		var ch NotificationChannel
+		if err := db.Where("user_id = ? AND id = ?", uid, c.Param("id")).First(&ch).Error; err != nil {
+			c.JSON(404, gin.H{"error": "canal no encontrado"})
+			return
+		}
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if in.Enabled != nil {
+			ch.Enabled = *in.Enabled
+		}
+		if err := db.Save(&ch).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, ch)
+	}
+}
+
+func deleteChannelHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		res := db.Where("user_id = ? AND id = ?", uid, c.Param("id")).Delete(&NotificationChannel{})
+		if res.Error != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(404, gin.H{"error": "canal no encontrado"})
+			return
+		}
+		c.JSON(200, gin.H{"deleted": c.Param("id")})
+	}
+}
+
+// testChannelHandler envía un mensaje de prueba al canal para que el usuario
+// pueda validar la configuración. Del fallo solo devuelve el resumen de
+// channelErrorSummary; el error completo va al log.
+func testChannelHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		var ch NotificationChannel
+		if err := db.Where("user_id = ? AND id = ?", uid, c.Param("id")).First(&ch).Error; err != nil {
+			c.JSON(404, gin.H{"error": "canal no encontrado"})
+			return
+		}
+		n := Notification{UserID: uid, Priority: "high", Title: "TaskFlow", Body: "Mensaje de prueba: el canal está bien configurado."}
+		err := sendToChannel(c.Request.Context(), ch, n)
+		recordChannelResult(db, ch, err)
+		if err != nil {
+			log.Printf("[NOTIFY] prueba del canal #%d (%s) falló: %v", ch.ID, ch.Kind, err)
+			c.JSON(502, gin.H{"error": channelErrorSummary(err)})
+			return
+		}
+		c.JSON(200, gin.H{"sent": true})
+	}
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= OAUTH2 (servidor de autorización) =========
+//
+// Aplicaciones de terceros acceden a la cuenta de un usuario con permisos
+// limitados. Flujo authorization code + PKCE (S256 obligatorio):
+//
+//  1. El usuario registra la app: POST /api/oauth/apps -> client_id
+//     (y client_secret si es confidencial).
+//  2. La app manda al usuario al frontend con los parámetros estándar; el
+//     frontend pide GET /api/oauth/authorize para pintar el consentimiento y
+//     POST /api/oauth/authorize con la respuesta, que devuelve la URL de
+//     vuelta con ?code=...&state=...
+//  3. La app canjea el código en POST /oauth/token y usa el access token como
+//     Bearer en /api. Los tokens son opacos (tfo_at_...), se guardan como
+//     sha256 y solo alcanzan las rutas de oauthRouteScopes.
+//
+// POST /oauth/introspect (RFC 7662) y POST /oauth/revoke (RFC 7009) son para
+// la propia app; el usuario revoca desde /api/me/authorizations.
+
+var (
+	oauthCodeTTL    = 10 * time.Minute
+	oauthAccessTTL  = time.Duration(getEnvInt("OAUTH_ACCESS_TTL_MINUTES", 60)) * time.Minute
+	oauthRefreshTTL = time.Duration(getEnvInt("OAUTH_REFRESH_TTL_DAYS", 30)) * 24 * time.Hour
+)
+
+const (
+	oauthAccessPrefix  = "tfo_at_"
+	oauthRefreshPrefix = "tfo_rt_"
+)
+
+// oauthScopes son los permisos que puede pedir una app, con el texto que ve
+// el usuario en la pantalla de consentimiento. tasks:write incluye leer.
+var oauthScopes = map[string]string{
+	"tasks:read":  "Ver tus tareas",
+	"tasks:write": "Crear, editar y borrar tus tareas",
+}
+
+// oauthRouteScopes es lo único que puede hacer un token OAuth: el resto de
+// /api (perfil, canales, exportaciones...) responde 403.
+var oauthRouteScopes = map[string]string{
+	"GET /api/tasks":                       "tasks:read",
+	"GET /api/tasks/search":                "tasks:read",
+	"GET /api/tasks/:id":                   "tasks:read",
+	"GET /api/tasks/:id/reminders/preview": "tasks:read",
+	"GET /api/imports/:id":                 "tasks:read",
+	"GET /api/view-presets":                "tasks:read",
+	"GET /api/view-presets/:id":            "tasks:read",
+	"POST /api/tasks":                      "tasks:write",
+	"PATCH /api/tasks/:id":                 "tasks:write",
+	"DELETE /api/tasks/:id":                "tasks:write",
+	"POST /api/tasks/import":               "tasks:write",
+	"POST /api/imports/:id/cancel":         "tasks:write",
+}
+
+type OAuthApp struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	UserID           uint      `gorm:"index;not null" json:"user_id"` // quien la registró
+	Name             string    `gorm:"not null" json:"name"`
+	ClientID         string    `gorm:"uniqueIndex;not null" json:"client_id"`
+	ClientSecretHash string    `json:"-"`
+	RedirectURIs     string    `gorm:"not null" json:"-"` // separadas por espacios
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func (OAuthApp) TableName() string { return "oauth_apps" }
+
+func (a OAuthApp) redirectURIs() []string { return strings.Fields(a.RedirectURIs) }
+
+func (a OAuthApp) confidential() bool { return a.ClientSecretHash != "" }
+
+type OAuthCode struct {
+	ID            uint      `gorm:"primaryKey"`
+	CodeHash      string    `gorm:"uniqueIndex;not null"`
+	AppID         uint      `gorm:"index;not null"`
+	UserID        uint      `gorm:"index;not null"`
+	Scope         string    `gorm:"not null"`
+	RedirectURI   string    `gorm:"not null"`
+	CodeChallenge string    `gorm:"not null"`
+	ExpiresAt     time.Time `gorm:"not null"`
+}
+
+func (OAuthCode) TableName() string { return "oauth_codes" }
+
+type OAuthToken struct {
+	ID               uint       `gorm:"primaryKey"`
+	AppID            uint       `gorm:"index;not null"`
+	UserID           uint       `gorm:"index;not null"`
+	Scope            string     `gorm:"not null"`
+	AccessHash       string     `gorm:"uniqueIndex;not null"`
+	RefreshHash      string     `gorm:"uniqueIndex;not null"`
+	ExpiresAt        time.Time  `gorm:"not null"`
+	RefreshExpiresAt time.Time  `gorm:"not null"`
+	RevokedAt        *time.Time `gorm:"index"`
+	CreatedAt        time.Time
+}
+
+func (OAuthToken) TableName() string { return "oauth_tokens" }
+
+func hashOAuthSecret(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// scopeAllows indica si los permisos concedidos cubren need.
+func scopeAllows(granted, need string) bool {
+	for _, s := range strings.Fields(granted) {
+		if s == need || (s == "tasks:write" && need == "tasks:read") {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupOAuthAccess devuelve el token vigente que corresponde a raw.
+func lookupOAuthAccess(db *gorm.DB, raw string) (OAuthToken, bool) {
+	var t OAuthToken
+	err := db.Where("access_hash = ? AND revoked_at IS NULL AND expires_at > ?", hashOAuthSecret(raw), time.Now()).First(&t).Error
+	return t, err == nil
+}
+
+// OAuthScopeGuard limita las peticiones hechas con token OAuth a las rutas de
+// oauthRouteScopes. Va justo después de AuthMiddleware.
+func OAuthScopeGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, ok := c.Get("oauth_scope")
+		if !ok {
+			c.Next()
+			return
+		}
+		need, ok := oauthRouteScopes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.AbortWithStatusJSON(403, gin.H{"error": "este endpoint no admite tokens OAuth"})
+			return
+		}
+		if !scopeAllows(granted.(string), need) {
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+need+`"`)
+			c.AbortWithStatusJSON(403, gin.H{"error": "insufficient_scope", "scope": need})
+			return
+		}
+		c.Next()
+	}
+}
+
+// --- registro de apps ---
+
+func oauthAppView(a OAuthApp) gin.H {
+	return gin.H{
+		"id":            a.ID,
+		"name":          a.Name,
+		"client_id":     a.ClientID,
+		"confidential":  a.confidential(),
+		"redirect_uris": a.redirectURIs(),
+		"created_at":    a.CreatedAt,
+	}
+}
+
+// validRedirectURI acepta https, http solo en loopback (apps de escritorio)
+// y esquemas propios de apps móviles, que según RFC 8252 §7.1 llevan un
+// punto (com.example.app:/cb). Cualquier otro (javascript:, data:, file:...)
+// se rechaza: la URI vuelve al frontend como redirect_to y este navega a
+// ella. Nunca fragmentos.
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Fragment != "" || strings.ContainsAny(raw, " \t\n") {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		h := u.Hostname()
+		return h == "localhost" || h == "127.0.0.1" || h == "::1"
+	default:
+		return strings.Contains(u.Scheme, ".")
+	}
+}
+
+func createOAuthAppHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Name         string   `json:"name" binding:"required"`
+		RedirectURIs []string `json:"redirect_uris" binding:"required,min=1"`
+		Confidential bool     `json:"confidential"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		for _, u := range in.RedirectURIs {
+			if !validRedirectURI(u) {
+				c.JSON(400, gin.H{"error": "redirect_uri inválida: " + u})
+				return
+			}
+		}
+		app := OAuthApp{
+			UserID:       c.GetUint("user_id"),
+			Name:         strings.TrimSpace(in.Name),
+			ClientID:     randomHex(16),
+			RedirectURIs: strings.Join(in.RedirectURIs, " "),
+		}
+		var secret string
+		if in.Confidential {
+			secret = randomHex(32)
+			app.ClientSecretHash = hashOAuthSecret(secret)
+		}
+		if err := db.Create(&app).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		resp := oauthAppView(app)
+		if secret != "" {
+			resp["client_secret"] = secret // solo se muestra ahora
+		}
+		c.JSON(201, resp)
+	}
+}
+
+func listOAuthAppsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var apps []OAuthApp
+		if err := db.Where("user_id = ?", c.GetUint("user_id")).Order("id").Find(&apps).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		out := make([]gin.H, 0, len(apps))
+		for _, a := range apps {
+			out = append(out, oauthAppView(a))
+		}
+		c.JSON(200, out)
+	}
+}
+
+// deleteOAuthAppHandler borra la app y con ella todos sus códigos y tokens.
+func deleteOAuthAppHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var app OAuthApp
+		if err := db.Where("user_id = ? AND id = ?", c.GetUint("user_id"), c.Param("id")).First(&app).Error; err != nil {
+			c.JSON(404, gin.H{"error": "app no encontrada"})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error { return purgeOAuthApps(tx, []uint{app.ID}) })
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"deleted": c.Param("id")})
+	}
+}
+
+func purgeOAuthApps(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, model := range []any{&OAuthCode{}, &OAuthToken{}} {
+		if err := tx.Where("app_id IN ?", ids).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("id IN ?", ids).Delete(&OAuthApp{}).Error
+}
+
+// --- consentimiento ---
+
+type authorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// validate comprueba la petición contra la app registrada y normaliza
+// redirect_uri (si la app solo tiene una puede omitirse) y scope (por defecto
+// tasks:read).
+func (r *authorizeRequest) validate(db *gorm.DB) (OAuthApp, error) {
+	var app OAuthApp
+	if r.ClientID == "" || db.Where("client_id = ?", r.ClientID).First(&app).Error != nil {
+		return app, errors.New("client_id desconocido")
+	}
+	uris := app.redirectURIs()
+	if r.RedirectURI == "" && len(uris) == 1 {
+		r.RedirectURI = uris[0]
+	}
+	if !slices.Contains(uris, r.RedirectURI) {
+		return app, errors.New("redirect_uri no registrada para esta app")
+	}
+	// Las apps dadas de alta antes de endurecer validRedirectURI pueden
+	// tener guardada alguna que ya no se acepta.
+	if !validRedirectURI(r.RedirectURI) {
+		return app, errors.New("redirect_uri no permitida")
+	}
+	if r.ResponseType != "code" {
+		return app, errors.New("response_type debe ser code")
+	}
+	if r.CodeChallengeMethod != "S256" || len(r.CodeChallenge) < 43 {
+		return app, errors.New("PKCE obligatorio: code_challenge con code_challenge_method=S256")
+	}
+	if strings.TrimSpace(r.Scope) == "" {
+		r.Scope = "tasks:read"
+	}
+	scopes := strings.Fields(r.Scope)
+	for _, s := range scopes {
+		if _, ok := oauthScopes[s]; !ok {
+			return app, errors.New("scope desconocido: " + s)
+		}
+	}
+	slices.Sort(scopes)
+	r.Scope = strings.Join(slices.Compact(scopes), " ")
+	return app, nil
+}
+
+// authorizeInfoHandler devuelve lo que el frontend necesita para la pantalla
+// de consentimiento.
+func authorizeInfoHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req authorizeRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		app, err := req.validate(db)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		scopes := []gin.H{}
+		for _, s := range strings.Fields(req.Scope) {
+			scopes = append(scopes, gin.H{"name": s, "description": oauthScopes[s]})
+		}
+		c.JSON(200, gin.H{
+			"app":          gin.H{"name": app.Name, "client_id": app.ClientID},
+			"scopes":       scopes,
+			"redirect_uri": req.RedirectURI,
+			"state":        req.State,
+		})
+	}
+}
+
+// authorizeDecisionHandler registra la respuesta del usuario y devuelve la URL
+// a la que el frontend debe redirigir.
+func authorizeDecisionHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		authorizeRequest
+		Approve bool `json:"approve"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		app, err := in.validate(db)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		q := url.Values{}
+		if in.State != "" {
+			q.Set("state", in.State)
+		}
+		if !in.Approve {
+			q.Set("error", "access_denied")
+			c.JSON(200, gin.H{"redirect_to": withQuery(in.RedirectURI, q)})
+			return
+		}
+		code := randomHex(32)
+		grant := OAuthCode{
+			CodeHash:      hashOAuthSecret(code),
+			AppID:         app.ID,
+			UserID:        c.GetUint("user_id"),
+			Scope:         in.Scope,
+			RedirectURI:   in.RedirectURI,
+			CodeChallenge: in.CodeChallenge,
+			ExpiresAt:     time.Now().Add(oauthCodeTTL),
+		}
+		if err := db.Create(&grant).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		q.Set("code", code)
+		c.JSON(200, gin.H{"redirect_to": withQuery(in.RedirectURI, q)})
+	}
+}
+
+func withQuery(raw string, q url.Values) string {
+	u, _ := url.Parse(raw) // ya validada al registrar la app
+	merged := u.Query()
+	for k, v := range q {
+		merged[k] = v
+	}
+	u.RawQuery = merged.Encode()
+	return u.String()
+}
+
+// --- endpoints de la app (form-urlencoded, errores de RFC 6749) ---
+
+func oauthError(c *gin.Context, status int, code, desc string) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, gin.H{"error": code, "error_description": desc})
+}
+
+// oauthClient identifica la app por Basic auth o por client_id/client_secret
+// en el formulario. Las apps confidenciales tienen que presentar su secreto.
+func oauthClient(db *gorm.DB, c *gin.Context) (OAuthApp, bool) {
+	id, secret, basic := c.Request.BasicAuth()
+	if !basic {
+		id, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	var app OAuthApp
+	if id == "" || db.Where("client_id = ?", id).First(&app).Error != nil {
+		return app, false
+	}
+	if app.confidential() && subtle.ConstantTimeCompare([]byte(hashOAuthSecret(secret)), []byte(app.ClientSecretHash)) != 1 {
+		return app, false
+	}
+	return app, true
+}
+
+func issueOAuthToken(db *gorm.DB, c *gin.Context, appID, userID uint, scope string) {
+	access, refresh := oauthAccessPrefix+randomHex(32), oauthRefreshPrefix+randomHex(32)
+	now := time.Now()
+	t := OAuthToken{
+		AppID:            appID,
+		UserID:           userID,
+		Scope:            scope,
+		AccessHash:       hashOAuthSecret(access),
+		RefreshHash:      hashOAuthSecret(refresh),
+		ExpiresAt:        now.Add(oauthAccessTTL),
+		RefreshExpiresAt: now.Add(oauthRefreshTTL),
+	}
+	if err := db.Create(&t).Error; err != nil {
+		oauthError(c, 500, "server_error", "db error")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(200, gin.H{
+		"access_token":  access,
+		"token_type":    "Bearer",
+		"expires_in":    int(oauthAccessTTL.Seconds()),
+		"refresh_token": refresh,
+		"scope":         scope,
+	})
+}
+
+func pkceMatches(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+func oauthTokenHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := oauthClient(db, c)
+		if !ok {
+			oauthError(c, 401, "invalid_client", "cliente desconocido o secreto incorrecto")
+			return
+		}
+		switch c.PostForm("grant_type") {
+		case "authorization_code":
+			var code OAuthCode
+			if db.Where("code_hash = ?", hashOAuthSecret(c.PostForm("code"))).First(&code).Error != nil {
+				oauthError(c, 400, "invalid_grant", "código desconocido")
+				return
+			}
+			// Un código vale una sola vez: quien lo borra primero se lo queda.
+			if res := db.Delete(&code); res.Error != nil || res.RowsAffected != 1 {
+				oauthError(c, 400, "invalid_grant", "código ya usado")
+				return
+			}
+			switch {
+			case code.AppID != app.ID:
+				oauthError(c, 400, "invalid_grant", "el código es de otra app")
+			case time.Now().After(code.ExpiresAt):
+				oauthError(c, 400, "invalid_grant", "código caducado")
+			case c.PostForm("redirect_uri") != "" && c.PostForm("redirect_uri") != code.RedirectURI:
+				oauthError(c, 400, "invalid_grant", "redirect_uri no coincide")
+			case !pkceMatches(c.PostForm("code_verifier"), code.CodeChallenge):
+				oauthError(c, 400, "invalid_grant", "code_verifier incorrecto")
+			default:
+				issueOAuthToken(db, c, app.ID, code.UserID, code.Scope)
+			}
+		case "refresh_token":
+			var t OAuthToken
+			err := db.Where("refresh_hash = ? AND app_id = ? AND revoked_at IS NULL AND refresh_expires_at > ?",
+				hashOAuthSecret(c.PostForm("refresh_token")), app.ID, time.Now()).First(&t).Error
+			if err != nil {
+				oauthError(c, 400, "invalid_grant", "refresh_token inválido o caducado")
+				return
+			}
+			// Rotación: el refresh token usado deja de valer.
+			res := db.Model(&OAuthToken{}).Where("id = ? AND revoked_at IS NULL", t.ID).Update("revoked_at", time.Now())
+			if res.Error != nil || res.RowsAffected != 1 {
+				oauthError(c, 400, "invalid_grant", "refresh_token ya usado")
+				return
+			}
+			issueOAuthToken(db, c, app.ID, t.UserID, t.Scope)
+		default:
+			oauthError(c, 400, "unsupported_grant_type", "grant_type debe ser authorization_code o refresh_token")
+		}
+	}
+}
+
+// findAppToken busca raw como access o refresh token de app.
+func findAppToken(db *gorm.DB, app OAuthApp, raw string) (OAuthToken, bool) {
+	var t OAuthToken
+	h := hashOAuthSecret(raw)
+	err := db.Where("app_id = ? AND (access_hash = ? OR refresh_hash = ?)", app.ID, h, h).First(&t).Error
+	return t, err == nil
+}
+
+// oauthIntrospectHandler (RFC 7662) solo responde sobre tokens de la propia
+// app; para el resto dice active=false.
+func oauthIntrospectHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := oauthClient(db, c)
+		if !ok || !app.confidential() {
+			oauthError(c, 401, "invalid_client", "la introspección requiere una app confidencial")
+			return
+		}
+		raw := c.PostForm("token")
+		t, found := findAppToken(db, app, raw)
+		exp := t.ExpiresAt
+		if strings.HasPrefix(raw, oauthRefreshPrefix) {
+			exp = t.RefreshExpiresAt
+		}
+		var u User
+		if !found || t.RevokedAt != nil || time.Now().After(exp) ||
+			db.Where("id = ? AND deactivated_at IS NULL", t.UserID).First(&u).Error != nil {
+			c.JSON(200, gin.H{"active": false})
+			return
+		}
+		c.JSON(200, gin.H{
+			"active":     true,
+			"scope":      t.Scope,
+			"client_id":  app.ClientID,
+			"sub":        strconv.FormatUint(uint64(t.UserID), 10),
+			"username":   u.Email,
+			"token_type": "Bearer",
+			"exp":        exp.Unix(),
+			"iat":        t.CreatedAt.Unix(),
+		})
+	}
+}
+
+// oauthRevokeHandler (RFC 7009) responde 200 aunque el token no exista.
+func oauthRevokeHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := oauthClient(db, c)
+		if !ok {
+			oauthError(c, 401, "invalid_client", "cliente desconocido o secreto incorrecto")
+			return
+		}
+		if t, found := findAppToken(db, app, c.PostForm("token")); found {
+			db.Model(&OAuthToken{}).Where("id = ? AND revoked_at IS NULL", t.ID).Update("revoked_at", time.Now())
+		}
+		c.Status(200)
+	}
+}
+
+// --- apps autorizadas por el usuario ---
+
+func listAuthorizationsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rows []struct {
+			AppID        uint      `json:"app_id"`
+			Name         string    `json:"name"`
+			Scope        string    `json:"scope"`
+			AuthorizedAt time.Time `json:"authorized_at"`
+		}
+		err := db.Table("oauth_tokens t").
+			Select("t.app_id, a.name, max(t.scope) AS scope, min(t.created_at) AS authorized_at").
+			Joins("JOIN oauth_apps a ON a.id = t.app_id").
+			Where("t.user_id = ? AND t.revoked_at IS NULL AND t.refresh_expires_at > ?", c.GetUint("user_id"), time.Now()).
+			Group("t.app_id, a.name").
+			Order("authorized_at").
+			Scan(&rows).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, rows)
+	}
+}
+
+// revokeAuthorizationHandler retira a una app todo acceso a la cuenta.
+func revokeAuthorizationHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		res := db.Model(&OAuthToken{}).
+			Where("user_id = ? AND app_id = ? AND revoked_at IS NULL", uid, c.Param("app_id")).
+			Update("revoked_at", time.Now())
+		if res.Error != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		db.Where("user_id = ? AND app_id = ?", uid, c.Param("app_id")).Delete(&OAuthCode{})
+		c.JSON(200, gin.H{"revoked": res.RowsAffected})
+	}
+}
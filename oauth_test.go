@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestValidRedirectURI(t *testing.T) {
+	for raw, want := range map[string]bool{
+		"https://app.example/cb":            true,
+		"http://127.0.0.1:8123/cb":          true,
+		"http://[::1]/cb":                   true,
+		"http://localhost/cb":               true,
+		"com.example.app:/oauth2redirect":   true,
+		"http://app.example/cb":             false,
+		"https:///cb":                       false,
+		"https://app.example/cb#frag":       false,
+		"javascript:alert(document.domain)": false,
+		"JavaScript:alert(1)":               false,
+		"data:text/html,<script>x</script>": false,
+		"vbscript:msgbox(1)":                false,
+		"file:///etc/passwd":                false,
+		"myapp:/cb":                         false,
+		"/relative/cb":                      false,
+	} {
+		if got := validRedirectURI(raw); got != want {
+			t.Errorf("validRedirectURI(%q) = %v, quería %v", raw, got, want)
+		}
+	}
+}
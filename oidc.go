@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// ========= OIDC SSO =========
+//
+// Login genérico con cualquier proveedor OIDC (Keycloak, Authentik, Google,
+// Azure AD...). Se activa con OIDC_ISSUER, OIDC_CLIENT_ID y OIDC_CLIENT_SECRET.
+// El usuario se enlaza por "sub"; la primera vez se busca por email y, si no
+// existe y OIDC_AUTO_PROVISION=true, se crea. Para eso el id_token tiene que
+// traer email_verified: true; a un proveedor que no manda el claim solo se le
+// cree con OIDC_TRUST_MISSING_EMAIL_VERIFIED=true (si no, quien controle una
+// cuenta del IdP con el email de otro se quedaría con su cuenta local).
+
+var passwordLoginDisabled = getEnv("PASSWORD_LOGIN_DISABLED", "false") == "true"
+
+type oidcConfig struct {
+	provider      *oidc.Provider
+	verifier      *oidc.IDTokenVerifier
+	oauth         oauth2.Config
+	autoProvision bool
+	// trustMissingVerified da por verificado el email si falta el claim.
+	trustMissingVerified bool
+	// Si se define, tras el login se redirige a esta URL con #token=<JWT>.
+	successRedirect string
+}
+
+const oidcStateCookie = "taskflow_oidc"
+
+func setupOIDC(ctx context.Context) (*oidcConfig, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if issuer == "" || clientID == "" {
+		return nil, errors.New("OIDC_ISSUER y OIDC_CLIENT_ID son obligatorios")
+	}
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &oidcConfig{
+		provider: provider,
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		oauth: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  getEnv("OIDC_REDIRECT_URL", publicURL+"/auth/oidc/callback"),
+			Scopes:       strings.Fields(getEnv("OIDC_SCOPES", "openid email profile")),
+		},
+		autoProvision:        getEnv("OIDC_AUTO_PROVISION", "false") == "true",
+		trustMissingVerified: getEnv("OIDC_TRUST_MISSING_EMAIL_VERIFIED", "false") == "true",
+		successRedirect:      os.Getenv("OIDC_SUCCESS_REDIRECT"),
+	}, nil
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// loginHandler redirige al proveedor. state, nonce y el verificador PKCE viajan
+// en una cookie firmada de 10 minutos, así no hace falta estado en el servidor.
+func (o *oidcConfig) loginHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state, nonce, verifier := randomHex(16), randomHex(16), oauth2.GenerateVerifier()
+		cookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"state":    state,
+			"nonce":    nonce,
+			"verifier": verifier,
+			"exp":      time.Now().Add(10 * time.Minute).Unix(),
+		}).SignedString(jwtSecret)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "no se pudo iniciar el login"})
+			return
+		}
+		// Lax: la vuelta del IdP es una navegación GET de primer nivel.
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(oidcStateCookie, cookie, 600, "/auth/oidc", "", strings.HasPrefix(publicURL, "https://"), true)
+		c.Redirect(302, o.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)))
+	}
+}
+
+func (o *oidcConfig) callbackHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, err := c.Cookie(oidcStateCookie)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "falta el estado del login, vuelve a empezar"})
+			return
+		}
+		c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", "", false, true)
+		claims := jwt.MapClaims{}
+		if _, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+			return jwtSecret, nil
+		}, jwt.WithValidMethods([]string{"HS256"})); err != nil {
+			c.JSON(400, gin.H{"error": "estado del login inválido o caducado"})
+			return
+		}
+		if c.Query("state") == "" || c.Query("state") != claims["state"] {
+			c.JSON(400, gin.H{"error": "state no coincide"})
+			return
+		}
+		if e := c.Query("error"); e != "" {
+			c.JSON(401, gin.H{"error": "el proveedor rechazó el login: " + e})
+			return
+		}
+		verifier, _ := claims["verifier"].(string)
+		tok, err := o.oauth.Exchange(c.Request.Context(), c.Query("code"), oauth2.VerifierOption(verifier))
+		if err != nil {
+			c.JSON(401, gin.H{"error": "no se pudo canjear el código"})
+			return
+		}
+		rawID, ok := tok.Extra("id_token").(string)
+		if !ok {
+			c.JSON(401, gin.H{"error": "el proveedor no devolvió id_token"})
+			return
+		}
+		idTok, err := o.verifier.Verify(c.Request.Context(), rawID)
+		if err != nil || idTok.Nonce != claims["nonce"] {
+			c.JSON(401, gin.H{"error": "id_token inválido"})
+			return
+		}
+		var info struct {
+			Email         string `json:"email"`
+			EmailVerified *bool  `json:"email_verified"`
+		}
+		if err := idTok.Claims(&info); err != nil {
+			c.JSON(401, gin.H{"error": "claims inválidos"})
+			return
+		}
+		u, status, msg := o.resolveUser(db, idTok.Subject, info.Email, o.emailVerified(info.EmailVerified))
+		if status != 0 {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+		jwtStr, err := issueToken(u)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "no se pudo firmar token"})
+			return
+		}
+		if o.successRedirect != "" {
+			c.Redirect(302, o.successRedirect+"#token="+url.QueryEscape(jwtStr))
+			return
+		}
+		c.JSON(200, gin.H{"token": jwtStr})
+	}
+}
+
+// emailVerified interpreta el claim email_verified; sin él, depende de
+// OIDC_TRUST_MISSING_EMAIL_VERIFIED.
+func (o *oidcConfig) emailVerified(claim *bool) bool {
+	if claim == nil {
+		return o.trustMissingVerified
+	}
+	return *claim
+}
+
+// resolveUser busca (o crea) el usuario del login OIDC. Devuelve un status
+// HTTP distinto de 0 si hay que rechazar el login.
+func (o *oidcConfig) resolveUser(db *gorm.DB, subject, email string, emailVerified bool) (User, int, string) {
+	var u User
+	err := db.Where("oidc_subject = ?", subject).First(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" || !emailVerified {
+			return u, 403, "el proveedor no devolvió un email verificado"
+		}
+		err = db.Where("email = ?", email).First(&u).Error
+		switch {
+		case err == nil:
+			u.OIDCSubject = subject
+			err = db.Save(&u).Error
+		case errors.Is(err, gorm.ErrRecordNotFound) && o.autoProvision:
+			if setupNeeded(db) {
+				return u, 403, errSetupPending.Error()
+			}
+			// Las invitaciones no aplican al SSO: aquí solo cuenta el modo.
+			if _, rerr := checkRegistration(db, email, ""); rerr != nil {
+				return u, 403, rerr.Error()
+			}
+			u = User{Email: email, OIDCSubject: subject}
+			err = db.Create(&u).Error
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return u, 403, "usuario no registrado en esta instancia"
+		}
+	}
+	if err != nil {
+		log.Printf("[OIDC] error resolviendo usuario %s: %v", subject, err)
+		return u, 500, "db error"
+	}
+	if u.DeactivatedAt != nil {
+		return u, 403, "cuenta desactivada"
+	}
+	return u, 0, ""
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestOIDCEmailVerified(t *testing.T) {
+	yes, no := true, false
+	strict := &oidcConfig{}
+	trusting := &oidcConfig{trustMissingVerified: true}
+	if strict.emailVerified(nil) {
+		t.Error("sin el claim, el email no debe contar como verificado")
+	}
+	if !trusting.emailVerified(nil) {
+		t.Error("con OIDC_TRUST_MISSING_EMAIL_VERIFIED, sin el claim cuenta como verificado")
+	}
+	if trusting.emailVerified(&no) || !strict.emailVerified(&yes) {
+		t.Error("un claim explícito manda sobre la opción")
+	}
+}
+
+// Sin email verificado no se enlaza con una cuenta local por email: no llega
+// a buscarla.
+func TestOIDCResolveUserNeedsVerifiedEmail(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE oidc_subject`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	o := &oidcConfig{autoProvision: true}
+	if _, status, _ := o.resolveUser(db, "sub-1", "victim@example.com", false); status != 403 {
+		t.Fatalf("status %d, quería 403", status)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Con /setup pendiente, el alta automática no crea la cuenta: el primer
+// usuario (el admin) sale del asistente.
+func TestOIDCResolveUserWaitsForSetup(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE oidc_subject`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE email`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM "settings"`).WillReturnRows(sqlmock.NewRows([]string{"key"}))
+	mock.ExpectQuery(`INSERT INTO "users"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	o := &oidcConfig{autoProvision: true}
+	_, status, msg := o.resolveUser(db, "sub-1", "first@example.com", true)
+	if status != 403 || msg != errSetupPending.Error() {
+		t.Fatalf("status %d %q, quería 403 por el asistente", status, msg)
+	}
+	if err := mock.ExpectationsWereMet(); err == nil {
+		t.Fatal("creó la cuenta antes de /setup")
+	}
+}
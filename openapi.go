@@ -0,0 +1,23 @@
+package main
+
+import (
+	_ "embed"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========= OPENAPI =========
+//
+// El contrato de la API vive en openapi/openapi.yaml y se sirve tal cual en
+// /openapi.yaml. El cliente TypeScript del frontend se genera a partir de
+// esta ruta (make ts-client), así que cualquier cambio de endpoints o de
+// campos JSON tiene que reflejarse aquí en el mismo commit.
+
+//go:embed openapi/openapi.yaml
+var openapiSpec []byte
+
+func openapiHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(200, "application/yaml", openapiSpec)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========= OPS GUARD =========
+//
+// Protección extra para las superficies operativas (/admin, /metrics) aunque
+// el puerto de la app esté expuesto:
+//   - OPS_ALLOWED_CIDRS: solo estas redes/IPs pueden entrar.
+//   - OPS_REQUIRE_CLIENT_CERT: exige certificado de cliente verificado (mTLS);
+//     requiere servir en TLS (TLS_CERT_FILE, TLS_KEY_FILE) con
+//     TLS_CLIENT_CA_FILE.
+
+type opsGuardConfig struct {
+	allowed           []*net.IPNet
+	requireClientCert bool
+}
+
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("CIDR inválido %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func newOpsGuardConfig() (*opsGuardConfig, error) {
+	nets, err := parseCIDRs(splitList(os.Getenv("OPS_ALLOWED_CIDRS")))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &opsGuardConfig{
+		allowed:           nets,
+		requireClientCert: getEnv("OPS_REQUIRE_CLIENT_CERT", "false") == "true",
+	}
+	if cfg.requireClientCert {
+		// Sin certificado ni clave el servidor ni siquiera escucha en TLS, y
+		// ninguna petición traería certificado de cliente.
+		var missing []string
+		for _, name := range []string{"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_CLIENT_CA_FILE"} {
+			if os.Getenv(name) == "" {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("OPS_REQUIRE_CLIENT_CERT necesita %s", strings.Join(missing, ", "))
+		}
+	}
+	return cfg, nil
+}
+
+// OpsGuard va antes de la autenticación: si la IP o el certificado no valen,
+// la petición ni siquiera llega a comprobar el JWT.
+func OpsGuard(cfg *opsGuardConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(cfg.allowed) > 0 {
+			ip := net.ParseIP(c.ClientIP())
+			ok := false
+			for _, n := range cfg.allowed {
+				if ip != nil && n.Contains(ip) {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				c.AbortWithStatusJSON(403, gin.H{"error": "origen no permitido"})
+				return
+			}
+		}
+		if cfg.requireClientCert {
+			if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+				c.AbortWithStatusJSON(403, gin.H{"error": "requiere certificado de cliente"})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// newHTTPServer sirve en TLS si hay TLS_CERT_FILE/TLS_KEY_FILE. Con
+// TLS_CLIENT_CA_FILE pide certificado de cliente de forma opcional: solo las
+// rutas con OpsGuard lo exigen.
+func newHTTPServer(addr string, h http.Handler) (*http.Server, bool, error) {
+	srv := &http.Server{Addr: addr, Handler: h}
+	if os.Getenv("TLS_CERT_FILE") == "" {
+		return srv, false, nil
+	}
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile := os.Getenv("TLS_CLIENT_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, false, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, false, fmt.Errorf("TLS_CLIENT_CA_FILE sin certificados válidos")
+		}
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return srv, true, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOpsGuardClientCertNeedsTLSFiles(t *testing.T) {
+	t.Setenv("OPS_REQUIRE_CLIENT_CERT", "true")
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	t.Setenv("TLS_CLIENT_CA_FILE", "/etc/taskflow/ca.pem")
+	_, err := newOpsGuardConfig()
+	if err == nil || !strings.Contains(err.Error(), "TLS_CERT_FILE, TLS_KEY_FILE") {
+		t.Fatalf("solo con la CA: err = %v", err)
+	}
+
+	t.Setenv("TLS_CERT_FILE", "/etc/taskflow/cert.pem")
+	t.Setenv("TLS_KEY_FILE", "/etc/taskflow/key.pem")
+	if _, err := newOpsGuardConfig(); err != nil {
+		t.Fatalf("con los tres: %v", err)
+	}
+}
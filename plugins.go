@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= PLUGINS =========
+//
+// Extensiones registradas en tiempo de compilación. Un fork añade un fichero
+// con un init() que llama a registerPlugin; el núcleo no cambia:
+//
+//	func init() { registerPlugin(miPlugin{}) }
+//
+// Un plugin implementa Plugin y, opcionalmente, TaskInterceptor,
+// TaskEventListener y/o RouteProvider.
+
+type Plugin interface {
+	Name() string
+}
+
+// TaskInterceptor se ejecuta antes de guardar una tarea (alta o edición).
+// Puede modificarla; si devuelve error la operación se rechaza con 422.
+type TaskInterceptor interface {
+	BeforeTaskSave(ctx context.Context, t *Task) error
+}
+
+// TaskEventListener recibe los eventos del ciclo de vida una vez ocurridos.
+type TaskEventListener interface {
+	OnTaskEvent(ctx context.Context, ev TaskEvent)
+}
+
+// RouteProvider permite añadir rutas públicas (r) o protegidas por JWT (api).
+type RouteProvider interface {
+	RegisterRoutes(db *gorm.DB, r *gin.Engine, api *gin.RouterGroup)
+}
+
+const (
+	TaskCreated  = "task.created"
+	TaskUpdated  = "task.updated"
+	TaskDeleted  = "task.deleted"
+	TaskReminder = "task.reminder"
+)
+
+type TaskEvent struct {
+	Kind   string
+	UserID uint
+	Task   Task
+}
+
+var plugins []Plugin
+
+func registerPlugin(p Plugin) {
+	plugins = append(plugins, p)
+}
+
+func runBeforeTaskSave(ctx context.Context, t *Task) error {
+	for _, p := range plugins {
+		if h, ok := p.(TaskInterceptor); ok {
+			if err := h.BeforeTaskSave(ctx, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// emitTaskEvent avisa a los listeners. Un plugin que hace panic no tumba la
+// petición: se loguea y se sigue con el resto.
+func emitTaskEvent(ctx context.Context, kind string, t Task) {
+	ev := TaskEvent{Kind: kind, UserID: t.UserID, Task: t}
+	for _, p := range plugins {
+		h, ok := p.(TaskEventListener)
+		if !ok {
+			continue
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("[PLUGIN] %s: panic en %s: %v", p.Name(), kind, r)
+				}
+			}()
+			h.OnTaskEvent(ctx, ev)
+		}()
+	}
+}
+
+func registerPluginRoutes(db *gorm.DB, r *gin.Engine, api *gin.RouterGroup) {
+	for _, p := range plugins {
+		if rp, ok := p.(RouteProvider); ok {
+			rp.RegisterRoutes(db, r, api)
+		}
+		log.Printf("plugin cargado: %s", p.Name())
+	}
+}
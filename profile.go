@@ -0,0 +1,119 @@
+package main
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= PERFIL PÚBLICO =========
+//
+// Quien quiera presumir de constancia elige un slug con PATCH /api/me
+// {"public_slug": "ana"} ("" lo despublica) y GET /profiles/ana enseña, sin
+// login, su racha y cuántas tareas completa: nunca títulos, fechas de tareas
+// ni el email. El avatar solo sale si lo subió (el de Gravatar delataría el
+// hash del email). Los días se cuentan en la zona del usuario.
+
+var (
+	validPublicSlug = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{2,29}$`)
+	reservedSlugs   = map[string]bool{"admin": true, "api": true, "me": true, "new": true, "settings": true, "support": true}
+)
+
+// profileStreakDays es hasta dónde se mira para la racha más larga.
+const profileStreakDays = 366
+
+type publicProfile struct {
+	Slug           string     `json:"slug"`
+	AvatarURL      string     `json:"avatar_url,omitempty"`
+	MemberSince    string     `json:"member_since"` // "2006-01"
+	CurrentStreak  int        `json:"current_streak"`
+	LongestStreak  int        `json:"longest_streak"` // en el último año
+	Completed7d    int64      `json:"completed_7d"`
+	Completed30d   int64      `json:"completed_30d"`
+	CompletedTotal int64      `json:"completed_total"`
+	PerWeek        []weekDone `json:"per_week"` // últimas 12 semanas
+}
+
+type weekDone struct {
+	Week      string `json:"week"` // lunes, "2006-01-02"
+	Completed int    `json:"completed"`
+}
+
+// completionStreaks calcula la racha actual (acaba hoy o ayer) y la más larga
+// a partir de los días con alguna tarea completada, ordenados de más reciente
+// a más antiguo.
+func completionStreaks(days []time.Time, today time.Time) (current, longest int) {
+	run := 0
+	for i, d := range days {
+		if i > 0 && days[i-1].AddDate(0, 0, -1).Equal(d) {
+			run++
+		} else {
+			run = 1
+		}
+		longest = max(longest, run)
+		if run == i+1 && (d.Equal(today.AddDate(0, 0, -i)) || d.Equal(today.AddDate(0, 0, -i-1))) {
+			current = run
+		}
+	}
+	return current, longest
+}
+
+func validateSlug(slug string) string {
+	if !validPublicSlug.MatchString(slug) || reservedSlugs[slug] {
+		return "public_slug: 3 a 30 caracteres en minúscula, números o guiones"
+	}
+	return ""
+}
+
+func publicProfileHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		err := db.Where("public_slug = ? AND deactivated_at IS NULL", c.Param("slug")).First(&u).Error
+		if err != nil {
+			c.JSON(404, gin.H{"error": "perfil no encontrado"})
+			return
+		}
+		loc := userLocation(u.Timezone)
+		now := time.Now().In(loc)
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+		p := publicProfile{Slug: *u.PublicSlug, MemberSince: u.CreatedAt.In(loc).Format("2006-01"), PerWeek: []weekDone{}}
+		if u.AvatarKey != "" {
+			p.AvatarURL = u.AvatarURL
+		}
+		var rows []struct{ Day time.Time }
+		err = db.Raw(`SELECT DISTINCT (completed_at AT TIME ZONE ?)::date AS day FROM tasks
+			WHERE user_id = ? AND completed_at IS NOT NULL AND completed_at > ?
+			ORDER BY day DESC`, loc.String(), u.ID, time.Now().AddDate(0, 0, -profileStreakDays-1)).Scan(&rows).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		days := make([]time.Time, len(rows))
+		for i, r := range rows {
+			days[i] = r.Day
+		}
+		p.CurrentStreak, p.LongestStreak = completionStreaks(days, today)
+
+		err = db.Raw(`SELECT count(*) FILTER (WHERE completed_at > now() - interval '7 days') AS completed7d,
+				count(*) FILTER (WHERE completed_at > now() - interval '30 days') AS completed30d,
+				count(*) AS completed_total
+			FROM tasks WHERE user_id = ? AND completed_at IS NOT NULL`, u.ID).Row().Scan(&p.Completed7d, &p.Completed30d, &p.CompletedTotal)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		err = db.Raw(`SELECT to_char(date_trunc('week', completed_at AT TIME ZONE ?), 'YYYY-MM-DD') AS week, count(*) AS completed
+			FROM tasks WHERE user_id = ? AND completed_at > now() - interval '12 weeks'
+			GROUP BY 1 ORDER BY 1`, loc.String(), u.ID).Scan(&p.PerWeek).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.Header("Cache-Control", "public, max-age=300")
+		setCacheKeys(c, userCacheKey(u.ID))
+		c.JSON(200, p)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryBudgets: cada listado tiene un número fijo de consultas por petición, que no crece
+// con las filas: los casos de contractCases devuelven varias, así que un
+// listado que vaya a buscar algo por fila (el N+1 de siempre al añadir
+// etiquetas, subtareas o comentarios) se pasa del presupuesto. Lo relacionado
+// se carga con un Preload explícito en el handler, que es una consulta más
+// por asociación, y se sube aquí el número a la vez.
+var queryBudgets = map[string]int{
+	"/api/tasks":                  3, // preferencias, total y la página
+	"/api/searches":               1,
+	"/api/notifications/channels": 1,
+	"/api/me":                     1,
+}
+
+func TestListEndpointsStayWithinQueryBudget(t *testing.T) {
+	for _, tc := range contractCases {
+		budget, ok := queryBudgets[tc.specPath]
+		if !ok || tc.status != 200 {
+			continue
+		}
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			db, mock := newMockDB(t)
+			tc.mock(mock)
+			queries := countQueries(t, db)
+			r := gin.New()
+			registerAPIRoutes(r.Group("/api", asUser(User{ID: 7, Timezone: "UTC"})), db)
+
+			if w := doRequest(r, tc.method, tc.path, ""); w.Code != 200 {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			if *queries > budget {
+				t.Errorf("%d consultas, el presupuesto es %d", *queries, budget)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========= CUOTAS =========
+//
+// Límites por usuario: tareas (QUOTA_TASKS, 0 = sin límite), SMS al mes
+// (SMS_MONTHLY_CAP) y almacenamiento (QUOTA_STORAGE_MB, ver blobusage.go).
+// Al pasar del 80% y al llegar al 100% se avisa una vez por los canales del
+// usuario; si el uso baja del 80% el aviso se rearma.
+// GET /api/me/usage enseña cuánto queda, para que la app avise antes de que
+// una acción falle.
+
+var quotaTasks = getEnvInt("QUOTA_TASKS", 0)
+
+var quotaLevels = []int{100, 80}
+
+// QuotaWarning recuerda qué avisos ya se mandaron. Period es "" para las
+// cuotas sin periodo y "2006-01" para las mensuales.
+type QuotaWarning struct {
+	UserID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Quota     string `gorm:"primaryKey"`
+	Level     int    `gorm:"primaryKey;autoIncrement:false"`
+	Period    string `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+type quotaUsage struct {
+	Used      int64  `json:"used"`
+	Limit     int64  `json:"limit"` // 0 = sin límite
+	Remaining *int64 `json:"remaining,omitempty"`
+	Percent   int    `json:"percent"`
+	Period    string `json:"period,omitempty"`
+}
+
+func newQuotaUsage(used, limit int64, period string) quotaUsage {
+	q := quotaUsage{Used: used, Limit: limit, Period: period}
+	if limit > 0 {
+		rem := max(limit-used, 0)
+		q.Remaining = &rem
+		q.Percent = int(used * 100 / limit)
+	}
+	return q
+}
+
+func taskUsage(db *gorm.DB, uid uint) (quotaUsage, error) {
+	var n int64
+	err := db.Model(&Task{}).Where("user_id = ?", uid).Count(&n).Error
+	return newQuotaUsage(n, int64(quotaTasks), ""), err
+}
+
+func smsUsage(db *gorm.DB, uid uint) (quotaUsage, error) {
+	period := time.Now().UTC().Format("2006-01")
+	var u User
+	if err := db.Select("sms_period", "sms_sent").First(&u, uid).Error; err != nil {
+		return quotaUsage{}, err
+	}
+	used := int64(0)
+	if u.SMSPeriod == period {
+		used = int64(u.SMSSent)
+	}
+	return newQuotaUsage(used, int64(smsMonthlyCap), period), nil
+}
+
+// taskQuotaHeadroom devuelve cuántas tareas más caben (-1 sin límite).
+func taskQuotaHeadroom(db *gorm.DB, uid uint) (int64, error) {
+	if quotaTasks <= 0 {
+		return -1, nil
+	}
+	q, err := taskUsage(db, uid)
+	if err != nil {
+		return 0, err
+	}
+	return *q.Remaining, nil
+}
+
+// checkQuota avisa si el uso cruzó un umbral todavía no avisado. Se llama
+// después de cada acción que consume cuota; los fallos solo se loguean.
+func checkQuota(db *gorm.DB, uid uint, quota string, q quotaUsage) {
+	if q.Limit <= 0 {
+		return
+	}
+	if q.Percent < quotaLevels[len(quotaLevels)-1] {
+		db.Where("user_id = ? AND quota = ? AND period = ?", uid, quota, q.Period).Delete(&QuotaWarning{})
+		return
+	}
+	for _, level := range quotaLevels {
+		if q.Percent < level {
+			continue
+		}
+		w := QuotaWarning{UserID: uid, Quota: quota, Level: level, Period: q.Period}
+		res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&w)
+		if res.Error != nil {
+			log.Printf("[QUOTA] no pude guardar el aviso %s/%d del user %d: %v", quota, level, uid, res.Error)
+			return
+		}
+		if res.RowsAffected == 1 {
+			queueQuotaWarning(db, uid, quota, level, q)
+		}
+		// Solo el umbral más alto alcanzado: quien salta de 70% a 100% no recibe dos.
+		return
+	}
+}
+
+var quotaNames = map[string]string{"tasks": "tareas", "sms": "SMS de este mes", "storage": "almacenamiento"}
+
+func queueQuotaWarning(db *gorm.DB, uid uint, quota string, level int, q quotaUsage) {
+	n := Notification{UserID: uid, Priority: "normal", Title: fmt.Sprintf("Has usado el %d%% de tus %s", level, quotaNames[quota])}
+	if level >= 100 {
+		n.Title = fmt.Sprintf("Has llegado al límite de %s", quotaNames[quota])
+	}
+	n.Body = fmt.Sprintf("Llevas %d de %d.", q.Used, q.Limit)
+	recordEvent(db, uid, "quota.warning", nil, gin.H{"quota": quota, "level": level, "used": q.Used, "limit": q.Limit})
+	if _, err := enqueueJob(db, "quota.warning", n); err != nil {
+		log.Printf("[QUOTA] no pude encolar el aviso del user %d: %v", uid, err)
+	}
+}
+
+func quotaWarningJob(_ context.Context, db *gorm.DB, j Job) error {
+	var n Notification
+	if err := json.Unmarshal([]byte(j.Payload), &n); err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	dispatchNotification(db, n)
+	return nil
+}
+
+func checkTaskQuota(db *gorm.DB, uid uint) {
+	if quotaTasks <= 0 {
+		return
+	}
+	if q, err := taskUsage(db, uid); err == nil {
+		checkQuota(db, uid, "tasks", q)
+	}
+}
+
+func checkSMSQuota(db *gorm.DB, uid uint) {
+	if q, err := smsUsage(db, uid); err == nil {
+		checkQuota(db, uid, "sms", q)
+	}
+}
+
+func usageHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		tasks, err := taskUsage(db, uid)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		sms, err := smsUsage(db, uid)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		storage, err := storageUsage(db, uid)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"tasks": tasks, "sms": sms, "storage": storage})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========= RECENT =========
+
+// TaskView guarda la última vez que un usuario abrió una tarea.
+type TaskView struct {
+	UserID   uint      `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	TaskID   uint      `gorm:"primaryKey;autoIncrement:false;index" json:"task_id"`
+	ViewedAt time.Time `gorm:"not null;index" json:"viewed_at"`
+}
+
+// viewRecorder acumula las vistas en memoria y las vuelca por lotes, para que
+// abrir una tarea no cueste una escritura por petición.
+type viewRecorder struct {
+	mu      sync.Mutex
+	pending map[[2]uint]time.Time
+}
+
+var views = &viewRecorder{pending: map[[2]uint]time.Time{}}
+
+func (v *viewRecorder) record(userID, taskID uint) {
+	v.mu.Lock()
+	v.pending[[2]uint{userID, taskID}] = time.Now()
+	v.mu.Unlock()
+}
+
+func (v *viewRecorder) flush(db *gorm.DB) {
+	v.mu.Lock()
+	batch := v.pending
+	v.pending = map[[2]uint]time.Time{}
+	v.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	rows := make([]TaskView, 0, len(batch))
+	for k, at := range batch {
+		rows = append(rows, TaskView{UserID: k[0], TaskID: k[1], ViewedAt: at})
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "task_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"viewed_at"}),
+	}).CreateInBatches(rows, 500).Error
+	if err != nil {
+		log.Printf("[VIEWS] no pude guardar %d vistas: %v", len(rows), err)
+	}
+}
+
+func startViewFlusher(db *gorm.DB, every time.Duration) {
+	for range time.Tick(every) {
+		views.flush(db)
+	}
+}
+
+// recentMigrations rellena updated_at en filas anteriores a la columna.
+var recentMigrations = []string{
+	`UPDATE tasks SET updated_at = created_at WHERE updated_at IS NULL`,
+}
+
+func getTaskHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		var t Task
+		if err := db.Where("user_id = ? AND id = ?", uid, c.Param("id")).First(&t).Error; err != nil {
+			c.JSON(404, gin.H{"error": "task no encontrada"})
+			return
+		}
+		views.record(uid, t.ID)
+		c.JSON(200, t)
+	}
+}
+
+// recentTasksHandler devuelve las tareas vistas más recientemente.
+func recentTasksHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+		if err != nil || limit < 1 || limit > 50 {
+			limit = 10
+		}
+		var tasks []Task
+		err = db.Joins("JOIN task_views tv ON tv.task_id = tasks.id AND tv.user_id = ?", uid).
+			Where("tasks.user_id = ?", uid).
+			Order("tv.viewed_at DESC").
+			Limit(limit).
+			Find(&tasks).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, tasks)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========= REQUEST RECORDING =========
+//
+// Con REQUEST_RECORD_FILE=ruta se guarda cada petición a /api (una fracción
+// REQUEST_RECORD_SAMPLE, 1 por defecto) como una línea JSON con la respuesta.
+// cmd/replay las reproduce contra otra instancia y compara respuestas.
+//
+// El fichero no lleva datos personales: el usuario es un HMAC de su id, los
+// textos libres (título, cuerpo...) van como un hash estable, de forma que el
+// mismo título grabado dos veces sigue siendo igual, y de los demás textos
+// solo se guardan los de recordedKeys (estados, zonas horarias, fechas...).
+// El resto, y cualquier campo nuevo hasta que se añada ahí, va como
+// "<redacted>": un secreto o una URL que se olvide en la lista no se graba.
+
+type recordedRequest struct {
+	Time     time.Time       `json:"ts"`
+	User     string          `json:"user,omitempty"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Query    string          `json:"query,omitempty"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+var (
+	recordedKeys = map[string]bool{
+		"status": true, "priority": true, "kind": true, "role": true, "type": true, "state": true,
+		"sort": true, "order": true, "group_by": true, "mode": true, "op": true, "period": true,
+		"timezone": true, "from_tz": true, "session_timezone": true, "search_language": true,
+		"category": true, "sound": true, "scope": true, "source": true, "error": true,
+		"request_id": true, "deactivated_by": true, "email_suppression_reason": true,
+		"day": true, "week": true, "today": true, "since": true, "member_since": true, "fires_at_local": true,
+	}
+	hashedKeys = map[string]bool{"title": true, "body": true, "query": true, "label": true, "topic": true, "room_id": true}
+)
+
+// recordedKey indica si el valor de key se graba tal cual; las fechas
+// (*_at) también.
+func recordedKey(key string) bool {
+	return recordedKeys[key] || strings.HasSuffix(key, "_at")
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	out    *os.File
+	key    []byte
+	sample float64
+}
+
+func newRecorder() (*recorder, error) {
+	path := getEnv("REQUEST_RECORD_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	sample, err := parseRate(getEnv("REQUEST_RECORD_SAMPLE", "1"))
+	if err != nil {
+		return nil, err
+	}
+	// Derivada de JWT_SECRET: estable entre reinicios y réplicas, pero sin el
+	// secreto no se puede comprobar si un email o título concreto está grabado.
+	m := hmac.New(sha256.New, jwtSecret)
+	m.Write([]byte("request-recording"))
+	key := m.Sum(nil)
+	log.Printf("[RECORD] grabando peticiones en %s (%.0f%%)", path, sample*100)
+	return &recorder{out: f, key: key, sample: sample}, nil
+}
+
+func (r *recorder) hash(s string) string {
+	m := hmac.New(sha256.New, r.key)
+	m.Write([]byte(s))
+	return hex.EncodeToString(m.Sum(nil))[:12]
+}
+
+// anonymize recorre el JSON y sustituye los campos sensibles.
+func (r *recorder) anonymize(raw []byte) json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil // no es JSON (Markdown, NDJSON...): no se guarda
+	}
+	out, _ := json.Marshal(r.scrub("", v))
+	return out
+}
+
+func (r *recorder) scrub(key string, v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			t[k] = r.scrub(k, val)
+		}
+		return t
+	case []any:
+		for i, val := range t {
+			t[i] = r.scrub(key, val)
+		}
+		return t
+	case string:
+		switch {
+		case hashedKeys[key]:
+			return "h:" + r.hash(t)
+		case !recordedKey(key):
+			return "<redacted>"
+		}
+	}
+	return v
+}
+
+type bodyCapture struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *bodyCapture) Write(b []byte) (int, error) {
+	if w.buf.Len() < 64<<10 {
+		w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Middleware va detrás de AuthMiddleware para conocer el usuario.
+func (r *recorder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rand.Float64() >= r.sample {
+			c.Next()
+			return
+		}
+		var reqBody []byte
+		if c.Request.Body != nil {
+			reqBody, _ = io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+			c.Request.Body = io.NopCloser(bytes.NewReader(reqBody))
+		}
+		w := &bodyCapture{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		rec := recordedRequest{
+			Time:     time.Now().UTC(),
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			Query:    r.scrubQuery(c.Request.URL.Query()),
+			Body:     r.anonymize(reqBody),
+			Status:   w.Status(),
+			Response: r.anonymize(w.buf.Bytes()),
+		}
+		if uid := c.GetUint("user_id"); uid != 0 {
+			rec.User = r.hash(strconv.FormatUint(uint64(uid), 10))
+		}
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.out.Write(append(line, '\n'))
+		r.mu.Unlock()
+	}
+}
+
+func (r *recorder) scrubQuery(q map[string][]string) string {
+	if len(q) == 0 {
+		return ""
+	}
+	var parts []string
+	for k, vals := range q {
+		for _, v := range vals {
+			switch _, err := strconv.ParseFloat(v, 64); {
+			case hashedKeys[k] || k == "q" || k == "email":
+				v = "h:" + r.hash(v)
+			case !recordedKey(k) && err != nil:
+				v = "<redacted>"
+			}
+			parts = append(parts, k+"="+v)
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= MODOS DE REGISTRO =========
+//
+// Quién puede darse de alta en /auth/register (y por auto-provisión OIDC). Se
+// guarda en el ajuste "registration" y lo cambia un admin en caliente:
+//
+//   - open:              cualquiera.
+//   - invite_only:       solo con invitación.
+//   - closed:            nadie.
+//   - domain_restricted: emails de Domains (p.ej. "acme.com").
+//
+// Una invitación válida permite registrarse en cualquier modo. Si el ajuste
+// no existe se usa REGISTRATION_MODE (open por defecto). SCIM y las cuentas
+// demo no pasan por aquí.
+
+const settingRegistration = "registration"
+
+const (
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "invite_only"
+	RegistrationClosed     = "closed"
+	RegistrationDomain     = "domain_restricted"
+)
+
+var (
+	inviteTTL   = time.Duration(getEnvInt("INVITE_TTL_DAYS", 7)) * 24 * time.Hour
+	registerURL = getEnv("REGISTER_URL", publicURL+"/register")
+)
+
+type registrationSettings struct {
+	Mode    string   `json:"mode"`
+	Domains []string `json:"domains,omitempty"`
+}
+
+func (s *registrationSettings) validate() error {
+	switch s.Mode {
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationClosed:
+		s.Domains = nil
+	case RegistrationDomain:
+		if len(s.Domains) == 0 {
+			return errors.New("domain_restricted requiere al menos un dominio")
+		}
+		for i, d := range s.Domains {
+			s.Domains[i] = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		}
+	default:
+		return errors.New("mode debe ser open, invite_only, closed o domain_restricted")
+	}
+	return nil
+}
+
+func loadRegistrationSettings(db *gorm.DB) (registrationSettings, error) {
+	s := registrationSettings{Mode: getEnv("REGISTRATION_MODE", RegistrationOpen)}
+	if domains := getEnv("REGISTRATION_DOMAINS", ""); domains != "" {
+		s.Domains = splitList(domains)
+	}
+	_, err := getSetting(db, settingRegistration, &s)
+	return s, err
+}
+
+type Invite struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CodeHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	Email     string     `json:"email,omitempty"` // si se fija, solo vale para ese email
+	CreatedBy uint       `gorm:"index;not null" json:"created_by"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	UsedBy    *uint      `json:"used_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// checkRegistration decide si email puede registrarse. Con una invitación
+// válida la devuelve para consumirla al crear el usuario.
+func checkRegistration(db *gorm.DB, email, inviteCode string) (*Invite, error) {
+	if inviteCode != "" {
+		var inv Invite
+		err := db.Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", hashOAuthSecret(inviteCode), time.Now()).First(&inv).Error
+		if err != nil || (inv.Email != "" && !strings.EqualFold(inv.Email, email)) {
+			return nil, errors.New("invitación inválida o caducada")
+		}
+		return &inv, nil
+	}
+	s, err := loadRegistrationSettings(db)
+	if err != nil {
+		return nil, err
+	}
+	switch s.Mode {
+	case RegistrationOpen:
+		return nil, nil
+	case RegistrationDomain:
+		_, domain, _ := strings.Cut(strings.ToLower(email), "@")
+		if slices.Contains(s.Domains, domain) {
+			return nil, nil
+		}
+		return nil, errors.New("registro limitado a emails de " + strings.Join(s.Domains, ", "))
+	case RegistrationInviteOnly:
+		return nil, errors.New("registro solo con invitación")
+	default:
+		return nil, errors.New("registro cerrado")
+	}
+}
+
+// consumeInvite marca la invitación como usada dentro de la transacción del
+// alta; falla si otra alta la gastó antes.
+func consumeInvite(tx *gorm.DB, inv *Invite, userID uint) error {
+	res := tx.Model(&Invite{}).Where("id = ? AND used_at IS NULL", inv.ID).
+		Updates(map[string]any{"used_at": time.Now(), "used_by": userID})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != 1 {
+		return errors.New("invitación ya usada")
+	}
+	return nil
+}
+
+// --- admin ---
+
+func adminGetRegistrationHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s, err := loadRegistrationSettings(db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, s)
+	}
+}
+
+func adminPutRegistrationHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var s registrationSettings
+		if err := c.ShouldBindJSON(&s); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := s.validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := putSetting(db, settingRegistration, s); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, s)
+	}
+}
+
+func adminCreateInviteHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Email string `json:"email" binding:"omitempty,email"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		code := randomHex(16)
+		inv := Invite{
+			CodeHash:  hashOAuthSecret(code),
+			Email:     strings.ToLower(in.Email),
+			CreatedBy: c.GetUint("user_id"),
+			ExpiresAt: time.Now().Add(inviteTTL),
+		}
+		if err := db.Create(&inv).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		link := registerURL + "?invite=" + url.QueryEscape(code)
+		if inv.Email != "" {
+			queueInviteEmail(requestDB(db, c.Request.Context()), inv, link)
+		}
+		c.JSON(201, gin.H{"invite": inv, "code": code, "url": link})
+	}
+}
+
+func queueInviteEmail(db *gorm.DB, inv Invite, link string) {
+	e, err := renderEmail("invite", map[string]any{
+		"Email": inv.Email, "Link": link, "ExpiresAt": inv.ExpiresAt.Format("02/01/2006"), "Brand": loadBranding(db),
+	})
+	if err == nil {
+		e.To = inv.Email
+		_, err = enqueueJob(db, "email", e)
+	}
+	if err != nil {
+		log.Printf("[MAIL] no pude encolar la invitación de %s: %v", inv.Email, err)
+	}
+}
+
+func adminListInvitesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var invites []Invite
+		if err := db.Order("id desc").Limit(200).Find(&invites).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, invites)
+	}
+}
+
+func adminDeleteInviteHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res := db.Where("id = ? AND used_at IS NULL", c.Param("id")).Delete(&Invite{})
+		if res.Error != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(404, gin.H{"error": "invitación no encontrada o ya usada"})
+			return
+		}
+		c.JSON(200, gin.H{"deleted": c.Param("id")})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ========= METADATOS DEL RECORDATORIO =========
+//
+// Una tarea puede llevar en "reminder" una etiqueta, una categoría y una pista
+// de sonido, para que las apps distingan un aviso urgente de uno suave sin
+// adivinarlo por el título. El servidor no interpreta categoría ni sonido: los
+// valida y los pasa tal cual a los canales que admiten datos extra (extras en
+// Gotify, Tags en ntfy, un campo propio en Matrix). La etiqueta sustituye a
+// "Recordatorio" como título del aviso en todos los canales.
+
+type ReminderMeta struct {
+	Label    string `json:"label,omitempty"`
+	Category string `json:"category,omitempty"` // p. ej. "urgent", "gentle"
+	Sound    string `json:"sound,omitempty"`    // p. ej. "alarm", "chime", "none"
+}
+
+const reminderLabelMax = 40
+
+var reminderHint = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Claves con las que viajan los metadatos: Gotify pide "espacio::nombre" en
+// extras y Matrix, nombres con dominio invertido.
+const (
+	gotifyReminderKey = "taskflow::reminder"
+	matrixReminderKey = "io.taskflow.reminder"
+)
+
+// normalize limpia y valida m; devuelve nil si se queda vacío, que es como se
+// quitan los metadatos ("reminder": {}).
+func (m *ReminderMeta) normalize() (*ReminderMeta, error) {
+	if m == nil {
+		return nil, nil
+	}
+	m.Label = strings.TrimSpace(m.Label)
+	m.Category = strings.ToLower(strings.TrimSpace(m.Category))
+	m.Sound = strings.ToLower(strings.TrimSpace(m.Sound))
+	if utf8.RuneCountInString(m.Label) > reminderLabelMax {
+		return nil, errors.New("reminder.label: máximo 40 caracteres")
+	}
+	// La etiqueta acaba de título del aviso y de asunto del correo: un salto
+	// de línea ahí añade cabeceras.
+	if strings.ContainsFunc(m.Label, breaksLine) {
+		return nil, errors.New("reminder.label: sin saltos de línea ni caracteres de control")
+	}
+	for name, v := range map[string]string{"category": m.Category, "sound": m.Sound} {
+		if v != "" && !reminderHint.MatchString(v) {
+			return nil, errors.New("reminder." + name + ": minúsculas, números, _ o -, hasta 32")
+		}
+	}
+	if *m == (ReminderMeta{}) {
+		return nil, nil
+	}
+	return m, nil
+}
+
+func breaksLine(r rune) bool {
+	return unicode.IsControl(r) || r == '\u2028' || r == '\u2029'
+}
+
+// reminderTitle es el título del aviso de una tarea.
+func reminderTitle(m *ReminderMeta) string {
+	if m != nil && m.Label != "" {
+		return m.Label
+	}
+	return "Recordatorio"
+}
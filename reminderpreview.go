@@ -0,0 +1,137 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= VISTA PREVIA DE RECORDATORIOS =========
+//
+// GET /api/tasks/:id/reminders/preview dice cuándo y por dónde saldría el
+// recordatorio de una tarea con la configuración actual, sin enviar nada. Hace
+// las mismas comprobaciones que fireReminder, deliverNotification y cada
+// Notifier, en el mismo orden. El aviso sale justo en due_at: no hay
+// antelación configurable ni horas de silencio, así que la zona del usuario
+// solo cambia cómo se enseña la hora.
+
+type reminderPreviewChannel struct {
+	ID      uint   `json:"id"`
+	Kind    string `json:"kind"`
+	Deliver bool   `json:"deliver"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type reminderPreview struct {
+	TaskID       uint                     `json:"task_id"`
+	WillFire     bool                     `json:"will_fire"`
+	Reason       string                   `json:"reason,omitempty"`
+	FiresAt      *time.Time               `json:"fires_at,omitempty"`
+	FiresAtLocal string                   `json:"fires_at_local,omitempty"`
+	Timezone     string                   `json:"timezone"`
+	Scheduler    string                   `json:"scheduler"`
+	Queued       *bool                    `json:"queued,omitempty"` // solo con la cola en Postgres
+	Title        string                   `json:"title"`
+	Reminder     *ReminderMeta            `json:"reminder,omitempty"`
+	Channels     []reminderPreviewChannel `json:"channels"`
+	Digest       gin.H                    `json:"digest"`
+}
+
+// previewChannel repite las condiciones con las que un canal descarta o
+// falla el aviso.
+func previewChannel(u User, t Task, ch NotificationChannel) reminderPreviewChannel {
+	p := reminderPreviewChannel{ID: ch.ID, Kind: ch.Kind, Deliver: true}
+	if _, ok := notifiers[ch.Kind]; !ok {
+		p.Deliver, p.Reason = false, "tipo de canal desactivado en el servidor"
+		return p
+	}
+	switch ch.Kind {
+	case "sms":
+		period := time.Now().UTC().Format("2006-01")
+		switch {
+		case t.Priority != "high":
+			p.Deliver, p.Reason = false, "los SMS solo se mandan para prioridad alta"
+		case !u.PhoneVerified || u.Phone == "":
+			p.Deliver, p.Reason = false, "teléfono sin verificar"
+		case u.SMSPeriod == period && u.SMSSent >= smsMonthlyCap:
+			p.Deliver, p.Reason = false, "cupo de SMS del mes agotado"
+		}
+	case "email":
+		if u.EmailUndeliverableAt != nil {
+			p.Deliver, p.Reason = false, "dirección suprimida por "+u.EmailSuppressionReason
+		}
+	}
+	return p
+}
+
+func reminderPreviewHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		var t Task
+		if err := db.Where("user_id = ? AND id = ?", uid, c.Param("id")).First(&t).Error; err != nil {
+			c.JSON(404, gin.H{"error": "task no encontrada"})
+			return
+		}
+		var u User
+		if err := db.First(&u, uid).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		p := reminderPreview{TaskID: t.ID, WillFire: true, Timezone: c.GetString("timezone"), Scheduler: stateBackend, Channels: []reminderPreviewChannel{},
+			Title: reminderTitle(t.Reminder), Reminder: t.Reminder}
+		loc, err := time.LoadLocation(p.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		switch {
+		case t.Done:
+			p.WillFire, p.Reason = false, "la tarea está hecha"
+		case t.DueAt == nil:
+			p.WillFire, p.Reason = false, "la tarea no tiene due_at"
+		case !t.DueAt.After(time.Now()):
+			p.WillFire, p.Reason = false, "due_at ya pasó"
+		case u.DeactivatedAt != nil:
+			p.WillFire, p.Reason = false, "la cuenta está desactivada"
+		case demoMode && u.IsDemo:
+			p.WillFire, p.Reason = false, "las cuentas demo no reciben avisos"
+		}
+		if t.DueAt != nil {
+			p.FiresAt = t.DueAt
+			p.FiresAtLocal = t.DueAt.In(loc).Format(time.RFC3339)
+		}
+		if _, ok := reminders.(*jobReminders); ok && p.WillFire {
+			var n int64
+			db.Model(&Job{}).Where("kind = ? AND status IN ? AND (payload->>'task_id')::bigint = ? AND (payload->>'due_at')::timestamptz = ?",
+				"task.reminder", []string{JobPending, JobRunning}, t.ID, *t.DueAt).Count(&n)
+			queued := n > 0
+			p.Queued = &queued
+			if !queued {
+				p.Reason = "no hay trabajo en cola: POST /admin/users/:id/reminders/reconcile lo reprograma"
+			}
+		}
+
+		var chans []NotificationChannel
+		if err := db.Where("user_id = ? AND enabled = ?", uid, true).Order("id").Find(&chans).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		for _, ch := range chans {
+			p.Channels = append(p.Channels, previewChannel(u, t, ch))
+		}
+
+		// El cupo por hora se gasta al enviar, así que solo se puede estimar con
+		// los demás recordatorios que vencen en la hora anterior.
+		var sameHour int64
+		if t.DueAt != nil {
+			db.Model(&Task{}).Where("user_id = ? AND id <> ? AND NOT done AND due_at > ? AND due_at <= ?",
+				uid, t.ID, t.DueAt.Add(-digestWindow), *t.DueAt).Count(&sameHour)
+		}
+		p.Digest = gin.H{
+			"max_per_hour":        notifyMaxPerHour,
+			"reminders_same_hour": sameHour,
+			"may_be_deferred":     sameHour >= int64(notifyMaxPerHour),
+		}
+		c.JSON(200, p)
+	}
+}
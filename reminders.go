@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ========= REMINDERS =========
+
+// ReminderScheduler programa el aviso de una tarea para su due_at. Se llama
+// en cada alta/edición: con la misma fecha no se programa otro, y al cambiarla
+// el aviso viejo ya no sale (al dispararse se comprueba que due_at coincide).
+type ReminderScheduler interface {
+	Schedule(t Task)
+}
+
+var reminders ReminderScheduler
+
+// newReminderScheduler usa timers en memoria (se pierden al reiniciar y solo
+// los ve la réplica que recibió la petición) o la cola de trabajos en
+// Postgres, que sobrevive a reinicios y reparte los avisos entre réplicas.
+func newReminderScheduler(db *gorm.DB, backend string) ReminderScheduler {
+	if backend == StatePostgres {
+		return &jobReminders{db: db}
+	}
+	ch := make(chan uint, 100)
+	go startReminderWorker(db, ch)
+	return memoryReminders(ch)
+}
+
+type memoryReminders chan uint
+
+func (m memoryReminders) Schedule(t Task) { m <- t.ID }
+
+// startReminderWorker lleva un timer por tarea: reprogramarla sustituye el
+// anterior.
+func startReminderWorker(db *gorm.DB, ch <-chan uint) {
+	var mu sync.Mutex
+	timers := map[uint]*time.Timer{}
+	for id := range ch {
+		go func(taskID uint) {
+			var t Task
+			if err := db.First(&t, taskID).Error; err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if old := timers[taskID]; old != nil {
+				old.Stop()
+				delete(timers, taskID)
+			}
+			if t.DueAt == nil || t.Done {
+				return
+			}
+			due := *t.DueAt
+			var tm *time.Timer
+			tm = time.AfterFunc(max(time.Until(due), 0), func() {
+				mu.Lock()
+				if timers[taskID] == tm {
+					delete(timers, taskID)
+				}
+				mu.Unlock()
+				fireIfStillDue(db, taskID, due)
+			})
+			timers[taskID] = tm
+		}(id)
+	}
+}
+
+// fireIfStillDue avisa de la tarea si sigue pendiente y con el mismo due_at.
+func fireIfStillDue(db *gorm.DB, taskID uint, due time.Time) {
+	var t Task
+	if err := db.First(&t, taskID).Error; err != nil {
+		return // la tarea se borró
+	}
+	if t.Done || t.DueAt == nil || !t.DueAt.Equal(due) {
+		return
+	}
+	fireReminder(db, t)
+}
+
+func fireReminder(db *gorm.DB, t Task) {
+	if !userActive(db, t.UserID) {
+		log.Printf("[REMINDER] Task #%d: user %d desactivado, no aviso", t.ID, t.UserID)
+		return
+	}
+	log.Printf("[REMINDER] Task #%d (user %d): %q vence ahora", t.ID, t.UserID, t.Title)
+	emitTaskEvent(context.Background(), TaskReminder, t)
+	dispatchNotification(db, Notification{
+		UserID:   t.UserID,
+		TaskID:   t.ID,
+		Priority: t.Priority,
+		Title:    reminderTitle(t.Reminder),
+		Body:     fmt.Sprintf("%q vence ahora", t.Title),
+		Reminder: t.Reminder,
+	})
+}
+
+// jobReminders encola un trabajo "task.reminder" para el due_at, salvo que ya
+// haya uno en cola para esa tarea y fecha. Si la tarea cambia de fecha se
+// encola otro; el antiguo ve que due_at ya no coincide y no hace nada.
+type jobReminders struct {
+	db *gorm.DB
+}
+
+type reminderPayload struct {
+	TaskID uint      `json:"task_id"`
+	DueAt  time.Time `json:"due_at"`
+}
+
+func (r *jobReminders) Schedule(t Task) {
+	if t.DueAt == nil || t.Done {
+		return
+	}
+	var n int64
+	err := r.db.Model(&Job{}).
+		Where("kind = ? AND status IN ? AND (payload->>'task_id')::bigint = ? AND (payload->>'due_at')::timestamptz = ?",
+			"task.reminder", []string{JobPending, JobRunning}, t.ID, *t.DueAt).
+		Count(&n).Error
+	if err != nil {
+		log.Printf("[REMINDER] no pude comprobar la cola de la tarea #%d: %v", t.ID, err)
+	}
+	if n > 0 {
+		return
+	}
+	if _, err := enqueueJobAt(r.db, "task.reminder", reminderPayload{TaskID: t.ID, DueAt: *t.DueAt}, *t.DueAt); err != nil {
+		log.Printf("[REMINDER] no pude programar la tarea #%d: %v", t.ID, err)
+	}
+}
+
+func reminderJob(_ context.Context, db *gorm.DB, j Job) error {
+	var p reminderPayload
+	if err := json.Unmarshal([]byte(j.Payload), &p); err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	fireIfStillDue(db, p.TaskID, p.DueAt)
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestJobRemindersScheduleSkipsQueued(t *testing.T) {
+	db, mock := newMockDB(t)
+	due := time.Now().Add(time.Hour)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "jobs"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	// El INSERT no debe llegar: su expectativa tiene que quedar sin cumplir.
+	mock.ExpectQuery(`INSERT INTO "jobs"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	(&jobReminders{db: db}).Schedule(Task{ID: 5, DueAt: &due})
+	if mock.ExpectationsWereMet() == nil {
+		t.Fatal("encoló otro aviso para la misma tarea y fecha")
+	}
+}
+
+func TestJobRemindersScheduleEnqueues(t *testing.T) {
+	db, mock := newMockDB(t)
+	due := time.Now().Add(time.Hour)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "jobs"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`INSERT INTO "jobs"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	(&jobReminders{db: db}).Schedule(Task{ID: 5, DueAt: &due})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobRemindersScheduleIgnoresDone(t *testing.T) {
+	db, mock := newMockDB(t)
+	due := time.Now().Add(time.Hour)
+	(&jobReminders{db: db}).Schedule(Task{ID: 5, DueAt: &due, Done: true})
+	(&jobReminders{db: db}).Schedule(Task{ID: 6})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkReminderSchedule mide lo que añade Schedule a cada alta o edición
+// con el backend de la cola: "new" encola, "unchanged" solo comprueba que ya
+// hay uno en cola.
+func BenchmarkReminderSchedule(b *testing.B) {
+	db := benchDB(b, true)
+	u := benchUser(b, db, 1)
+	var task Task
+	if err := db.Where("user_id = ?", u.ID).First(&task).Error; err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		db.Where("kind = ? AND (payload->>'task_id')::bigint = ?", "task.reminder", task.ID).Delete(&Job{})
+	})
+	r := &jobReminders{db: db}
+	due := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	b.Run("new", func(b *testing.B) {
+		for b.Loop() {
+			due = due.Add(time.Second)
+			r.Schedule(Task{ID: task.ID, DueAt: &due})
+		}
+	})
+	b.Run("unchanged", func(b *testing.B) {
+		r.Schedule(Task{ID: task.ID, DueAt: &due})
+		for b.Loop() {
+			r.Schedule(Task{ID: task.ID, DueAt: &due})
+		}
+	})
+}
+
+func TestReminderLabelRejectsControlCharacters(t *testing.T) {
+	for _, label := range []string{"Hola\r\nBcc: otro@example.com", "a\nb", "tab\there", "nul\x00", "sep\u2028x", "c1\u0085x"} {
+		m := &ReminderMeta{Label: label}
+		if _, err := m.normalize(); err == nil {
+			t.Errorf("%q: aceptada", label)
+		}
+	}
+	m := &ReminderMeta{Label: "  Medicación ⏰ "}
+	got, err := m.normalize()
+	if err != nil || got.Label != "Medicación ⏰" {
+		t.Fatalf("normalize = %+v, %v", got, err)
+	}
+}
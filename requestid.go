@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= X-REQUEST-ID =========
+//
+// Cada respuesta lleva X-Request-ID: el que mandó el cliente (o el proxy) si
+// es razonable, o uno nuevo. Aparece en la línea de log de la petición, en el
+// cuerpo de los errores ({"error": "...", "request_id": "..."}) y en los
+// trabajos que se encolan desde esa petición, así soporte puede cruzar el
+// aviso de un usuario con los logs.
+
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = randomHex(8)
+		}
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(withRequestID(c.Request.Context(), id))
+		c.Header(requestIDHeader, id)
+		c.Writer = &requestIDWriter{ResponseWriter: c.Writer, id: id}
+		c.Next()
+	}
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFrom devuelve el id de la petición de ctx, o "".
+func requestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestDB devuelve db con el id de la petición de ctx, para que los
+// trabajos que se encolen con él lo hereden. No hereda la cancelación: lo
+// encolado debe guardarse aunque el cliente corte.
+func requestDB(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.WithContext(withRequestID(context.Background(), requestIDFrom(ctx)))
+}
+
+// dbRequestID saca el id de un *gorm.DB al que se le pasó el contexto de la
+// petición con WithContext.
+func dbRequestID(db *gorm.DB) string {
+	if db.Statement == nil {
+		return ""
+	}
+	return requestIDFrom(db.Statement.Context)
+}
+
+// requestIDWriter añade request_id a los errores JSON sin tocar cada handler:
+// c.JSON escribe el objeto entero de una vez, así que basta con meter el campo
+// tras la llave de apertura.
+type requestIDWriter struct {
+	gin.ResponseWriter
+	id   string
+	done bool
+}
+
+func (w *requestIDWriter) Write(b []byte) (int, error) {
+	if w.done || w.Status() < 400 || len(b) < 2 || b[0] != '{' ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(b)
+	}
+	w.done = true
+	field := fmt.Sprintf(`"request_id":%q`, w.id)
+	if b[1] != '}' {
+		field += ","
+	}
+	out := make([]byte, 0, len(b)+len(field))
+	out = append(out, '{')
+	out = append(out, field...)
+	out = append(out, b[1:]...)
+	if _, err := w.ResponseWriter.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *requestIDWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// requestLogger es el log de acceso de gin con el id de la petición.
+func requestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "[GIN] %v | %3d | %13v | %15s | %-7s %#v | req=%v\n",
+			p.TimeStamp.Format("2006/01/02 - 15:04:05"), p.StatusCode, p.Latency.Truncate(time.Microsecond),
+			p.ClientIP, p.Method, p.Path, p.Keys["request_id"])
+		if p.ErrorMessage != "" {
+			b.WriteString(p.ErrorMessage)
+		}
+		return b.String()
+	})
+}
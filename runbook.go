@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= RUNBOOK =========
+//
+// Arreglos operativos habituales desde /admin, sin abrir psql:
+//   - ver y reencolar trabajos fallidos (correos, recordatorios, purgas de
+//     CDN...) en bloque;
+//   - reprogramar los recordatorios de un usuario;
+//   - reconstruir los índices de búsqueda.
+
+// searchIndexes son los índices que crean searchMigrations y suggestMigrations.
+var searchIndexes = []string{"idx_tasks_title_trgm", "idx_tasks_title_prefix"}
+
+func adminListJobsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 500 {
+			limit = 50
+		}
+		q := db.Model(&Job{})
+		// Con request_id se buscan los trabajos de esa petición en cualquier estado.
+		if rid := c.Query("request_id"); rid != "" {
+			q = q.Where("request_id = ?", rid)
+			if status := c.Query("status"); status != "" {
+				q = q.Where("status = ?", status)
+			}
+		} else {
+			q = q.Where("status = ?", c.DefaultQuery("status", JobFailed))
+		}
+		if kind := c.Query("kind"); kind != "" {
+			q = q.Where("kind = ?", kind)
+		}
+		var jobs []Job
+		if err := q.Order("id desc").Limit(limit).Find(&jobs).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		var byKind []struct {
+			Kind  string `json:"kind"`
+			Count int64  `json:"count"`
+		}
+		db.Model(&Job{}).Select("kind, count(*) AS count").Where("status = ?", JobFailed).Group("kind").Scan(&byKind)
+		c.JSON(200, gin.H{"jobs": jobs, "failed_by_kind": byKind})
+	}
+}
+
+// adminRequeueJobsHandler devuelve a la cola los trabajos fallidos, con los
+// intentos a cero. Sin kind, todos; since limita a los que fallaron después.
+func adminRequeueJobsHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Kind  string     `json:"kind"`
+		IDs   []uint     `json:"ids"`
+		Since *time.Time `json:"since"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		q := db.Model(&Job{}).Where("status = ?", JobFailed)
+		if in.Kind != "" {
+			if _, ok := jobHandlers[in.Kind]; !ok {
+				c.JSON(400, gin.H{"error": "tipo de trabajo desconocido"})
+				return
+			}
+			q = q.Where("kind = ?", in.Kind)
+		}
+		if len(in.IDs) > 0 {
+			q = q.Where("id IN ?", in.IDs)
+		}
+		if in.Since != nil {
+			q = q.Where("updated_at >= ?", *in.Since)
+		}
+		res := q.Updates(map[string]any{"status": JobPending, "attempts": 0, "run_at": time.Now(), "locked_at": nil})
+		if res.Error != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		log.Printf("[ADMIN] user %d reencoló %d trabajos fallidos (kind=%q)", c.GetUint("user_id"), res.RowsAffected, in.Kind)
+		c.JSON(200, gin.H{"requeued": res.RowsAffected})
+	}
+}
+
+// reconcileReminders vuelve a programar los recordatorios de las tareas
+// pendientes con fecha futura. Con la cola de trabajos se salta las que ya
+// tienen uno en cola; con timers en memoria no hay forma de saberlo y se
+// reprograman todas.
+func reconcileReminders(db *gorm.DB, uid uint) (scheduled, skipped int, err error) {
+	var tasks []Task
+	if err := db.Where("user_id = ? AND NOT done AND due_at > ?", uid, time.Now()).Find(&tasks).Error; err != nil {
+		return 0, 0, err
+	}
+	queued := map[uint]bool{}
+	if _, ok := reminders.(*jobReminders); ok && len(tasks) > 0 {
+		ids := make([]uint, len(tasks))
+		for i, t := range tasks {
+			ids[i] = t.ID
+		}
+		var rows []struct {
+			TaskID uint
+			DueAt  time.Time
+		}
+		err := db.Raw(`SELECT (payload->>'task_id')::bigint AS task_id, (payload->>'due_at')::timestamptz AS due_at
+			FROM jobs WHERE kind = 'task.reminder' AND status IN ? AND (payload->>'task_id')::bigint IN ?`,
+			[]string{JobPending, JobRunning}, ids).Scan(&rows).Error
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, t := range tasks {
+			for _, r := range rows {
+				if r.TaskID == t.ID && r.DueAt.Equal(*t.DueAt) {
+					queued[t.ID] = true
+				}
+			}
+		}
+	}
+	for _, t := range tasks {
+		if queued[t.ID] {
+			skipped++
+			continue
+		}
+		reminders.Schedule(t)
+		scheduled++
+	}
+	return scheduled, skipped, nil
+}
+
+func adminReconcileRemindersHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		scheduled, skipped, err := reconcileReminders(db, u.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		log.Printf("[ADMIN] user %d reprogramó recordatorios de %d: %d nuevos, %d ya en cola", c.GetUint("user_id"), u.ID, scheduled, skipped)
+		c.JSON(200, gin.H{"scheduled": scheduled, "already_queued": skipped})
+	}
+}
+
+// reindexSearchJob crea los índices que falten (p.ej. un CREATE INDEX
+// CONCURRENTLY que se cortó) y reconstruye los demás sin bloquear escrituras.
+func reindexSearchJob(ctx context.Context, db *gorm.DB, _ Job) error {
+	conn := db.WithContext(ctx)
+	for _, stmts := range [][]string{searchMigrations, suggestMigrations} {
+		for _, stmt := range stmts {
+			if err := conn.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("reindex: %w", err)
+			}
+		}
+	}
+	for _, idx := range searchIndexes {
+		if err := conn.Exec("REINDEX INDEX CONCURRENTLY " + idx).Error; err != nil {
+			return fmt.Errorf("reindex %s: %w", idx, err)
+		}
+	}
+	log.Printf("[RUNBOOK] índices de búsqueda reconstruidos: %v", searchIndexes)
+	return nil
+}
+
+func adminReindexSearchHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var n int64
+		db.Model(&Job{}).Where("kind = ? AND status IN ?", "search.reindex", []string{JobPending, JobRunning}).Count(&n)
+		if n > 0 {
+			c.JSON(409, gin.H{"error": "ya hay una reconstrucción en marcha"})
+			return
+		}
+		j, err := enqueueJob(requestDB(db, c.Request.Context()), "search.reindex", nil)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(202, gin.H{"job_id": j.ID})
+	}
+}
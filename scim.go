@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= SCIM 2.0 =========
+//
+// Aprovisionamiento de usuarios desde un IdP (Okta, Azure AD) en /scim/v2.
+// Se autentica con un token fijo (SCIM_TOKEN); sin él, el endpoint no existe.
+// Desactivar un usuario (active=false) bloquea su acceso sin borrar datos.
+
+const (
+	scimUserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimListSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+var scimFilterRe = regexp.MustCompile(`^userName eq "([^"]+)"$`)
+
+func scimAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			scimError(c, 401, "token inválido")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func scimError(c *gin.Context, status int, detail string) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, gin.H{"schemas": []string{scimErrorSchema}, "status": strconv.Itoa(status), "detail": detail})
+}
+
+func scimJSON(c *gin.Context, status int, body any) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, body)
+}
+
+func scimUser(u User) gin.H {
+	return gin.H{
+		"schemas":  []string{scimUserSchema},
+		"id":       strconv.FormatUint(uint64(u.ID), 10),
+		"userName": u.Email,
+		"active":   u.DeactivatedAt == nil,
+		"emails":   []gin.H{{"value": u.Email, "primary": true}},
+		"meta": gin.H{
+			"resourceType": "User",
+			"created":      u.CreatedAt.UTC().Format(time.RFC3339),
+			"location":     fmt.Sprintf("%s/scim/v2/Users/%d", publicURL, u.ID),
+		},
+	}
+}
+
+// setActive activa o desactiva al usuario con deactivateUser/reactivateUser,
+// que dejan el evento. Desactivar otra vez conserva la fecha original, y solo
+// reactiva lo que desactivó SCIM: una cuenta suspendida por un admin o por el
+// propio usuario sigue así aunque el IdP la mande activa.
+func setActive(db *gorm.DB, u *User, active bool) error {
+	if !active {
+		return deactivateUser(db, u, DeactivatedBySCIM, 0)
+	}
+	if u.DeactivatedBy != DeactivatedBySCIM {
+		return nil
+	}
+	return reactivateUser(db, u, 0)
+}
+
+// scimRemovesLastAdmin dice si active desactivaría al único admin activo.
+func scimRemovesLastAdmin(db *gorm.DB, u User, active *bool) bool {
+	return active != nil && !*active && u.DeactivatedAt == nil && u.Role == RoleAdmin && !otherAdminsExist(db, u.ID)
+}
+
+func scimListUsersHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start, _ := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+		if start < 1 {
+			start = 1
+		}
+		count, err := strconv.Atoi(c.DefaultQuery("count", "100"))
+		if err != nil || count < 0 || count > 500 {
+			count = 100
+		}
+		q := db.Model(&User{})
+		if f := strings.TrimSpace(c.Query("filter")); f != "" {
+			m := scimFilterRe.FindStringSubmatch(f)
+			if m == nil {
+				scimError(c, 400, "solo se soporta el filtro userName eq \"...\"")
+				return
+			}
+			q = q.Where("email = ?", strings.ToLower(m[1]))
+		}
+		var total int64
+		if err := q.Count(&total).Error; err != nil {
+			scimError(c, 500, "db error")
+			return
+		}
+		var users []User
+		if err := q.Order("id").Offset(start - 1).Limit(count).Find(&users).Error; err != nil {
+			scimError(c, 500, "db error")
+			return
+		}
+		res := make([]gin.H, 0, len(users))
+		for _, u := range users {
+			res = append(res, scimUser(u))
+		}
+		scimJSON(c, 200, gin.H{
+			"schemas":      []string{scimListSchema},
+			"totalResults": total,
+			"startIndex":   start,
+			"itemsPerPage": len(res),
+			"Resources":    res,
+		})
+	}
+}
+
+func scimGetUserHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			scimError(c, 404, "usuario no encontrado")
+			return
+		}
+		scimJSON(c, 200, scimUser(u))
+	}
+}
+
+type scimUserIn struct {
+	UserName string `json:"userName"`
+	Active   *bool  `json:"active"`
+	Emails   []struct {
+		Value   string `json:"value"`
+		Primary bool   `json:"primary"`
+	} `json:"emails"`
+}
+
+// email devuelve userName o, si no es un email, el email primario.
+func (in scimUserIn) email() string {
+	if strings.Contains(in.UserName, "@") {
+		return strings.ToLower(in.UserName)
+	}
+	for _, e := range in.Emails {
+		if e.Primary || len(in.Emails) == 1 {
+			return strings.ToLower(e.Value)
+		}
+	}
+	return ""
+}
+
+func scimCreateUserHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in scimUserIn
+		if err := c.ShouldBindJSON(&in); err != nil {
+			scimError(c, 400, err.Error())
+			return
+		}
+		email := in.email()
+		if email == "" {
+			scimError(c, 400, "userName o emails debe contener un email")
+			return
+		}
+		var n int64
+		db.Model(&User{}).Where("email = ?", email).Count(&n)
+		if n > 0 {
+			scimError(c, 409, "userName ya existe")
+			return
+		}
+		// Sin contraseña: el usuario entra por SSO o usando "olvidé mi contraseña".
+		u := User{Email: email}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&u).Error; err != nil {
+				return err
+			}
+			if in.Active != nil && !*in.Active {
+				return setActive(tx, &u, false)
+			}
+			return nil
+		})
+		if err != nil {
+			scimError(c, 500, "db error")
+			return
+		}
+		scimJSON(c, 201, scimUser(u))
+	}
+}
+
+func scimReplaceUserHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			scimError(c, 404, "usuario no encontrado")
+			return
+		}
+		var in scimUserIn
+		if err := c.ShouldBindJSON(&in); err != nil {
+			scimError(c, 400, err.Error())
+			return
+		}
+		if email := in.email(); email != "" {
+			u.Email = email
+		}
+		// Sin "active" se queda como está.
+		scimSaveUser(c, db, &u, in.Active)
+	}
+}
+
+// scimPatchUserHandler soporta las operaciones que envían los IdPs habituales:
+// replace de active/userName, con path o con un objeto en value.
+func scimPatchUserHandler(db *gorm.DB) gin.HandlerFunc {
+	type opT struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}
+	type inT struct {
+		Operations []opT `json:"Operations"`
+	}
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			scimError(c, 404, "usuario no encontrado")
+			return
+		}
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			scimError(c, 400, err.Error())
+			return
+		}
+		var active *bool
+		for _, op := range in.Operations {
+			if !strings.EqualFold(op.Op, "replace") && !strings.EqualFold(op.Op, "add") {
+				scimError(c, 400, "operación no soportada: "+op.Op)
+				return
+			}
+			values := map[string]any{}
+			if op.Path != "" {
+				values[op.Path] = op.Value
+			} else if m, ok := op.Value.(map[string]any); ok {
+				values = m
+			}
+			a, err := applySCIMValues(&u, values)
+			if err != nil {
+				scimError(c, 400, err.Error())
+				return
+			}
+			if a != nil {
+				active = a
+			}
+		}
+		scimSaveUser(c, db, &u, active)
+	}
+}
+
+// scimSaveUser guarda los cambios de PUT/PATCH y, si llega active, activa o
+// desactiva la cuenta en la misma transacción.
+func scimSaveUser(c *gin.Context, db *gorm.DB, u *User, active *bool) {
+	if scimRemovesLastAdmin(db, *u, active) {
+		scimError(c, 409, "no se puede desactivar el último admin")
+		return
+	}
+	errDuplicate := errors.New("userName ya existe")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(u).Error; err != nil {
+			return errDuplicate
+		}
+		if active != nil {
+			return setActive(tx, u, *active)
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errDuplicate):
+		scimError(c, 409, err.Error())
+	case err != nil:
+		scimError(c, 500, "db error")
+	default:
+		scimJSON(c, 200, scimUser(*u))
+	}
+}
+
+// applySCIMValues aplica userName a u y devuelve active, si viene: se aplica
+// con setActive después de guardar.
+func applySCIMValues(u *User, values map[string]any) (*bool, error) {
+	var active *bool
+	for k, v := range values {
+		switch k {
+		case "active":
+			b, ok := v.(bool)
+			if !ok {
+				// Azure AD manda "True"/"False" como string.
+				s, _ := v.(string)
+				parsed, err := strconv.ParseBool(s)
+				if err != nil {
+					return nil, errors.New("active debe ser bool")
+				}
+				b = parsed
+			}
+			active = &b
+		case "userName":
+			s, ok := v.(string)
+			if !ok || !strings.Contains(s, "@") {
+				return nil, errors.New("userName debe ser un email")
+			}
+			u.Email = strings.ToLower(s)
+		}
+	}
+	return active, nil
+}
+
+func scimDeleteUserHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.Param("id")).Error; err != nil {
+			scimError(c, 404, "usuario no encontrado")
+			return
+		}
+		if u.Role == RoleAdmin && !otherAdminsExist(db, u.ID) {
+			scimError(c, 409, "no se puede borrar el último admin")
+			return
+		}
+		// SCIM no tiene 423: la retención sale como conflicto.
+		err := checkLegalHold(db, []uint{u.ID}, "scim.delete", 0)
+		if err == nil {
+			err = deleteAccounts(db, []uint{u.ID}, DeactivatedBySCIM, 0)
+		}
+		if errors.Is(err, errLegalHold) {
+			scimError(c, 409, err.Error())
+			return
+		}
+		if err != nil {
+			scimError(c, 500, "db error")
+			return
+		}
+		c.Status(204)
+	}
+}
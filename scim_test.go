@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestSetActiveKeepsOtherDeactivations(t *testing.T) {
+	db, mock := newMockDB(t)
+	for _, by := range []string{DeactivatedByAdmin, DeactivatedBySelf} {
+		now := time.Now()
+		u := User{ID: 5, DeactivatedAt: &now, DeactivatedBy: by}
+		if err := setActive(db, &u, true); err != nil {
+			t.Fatal(err)
+		}
+		if u.DeactivatedAt == nil || u.DeactivatedBy != by {
+			t.Errorf("SCIM reactivó una cuenta desactivada por %s", by)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Cada cambio pasa por deactivateUser/reactivateUser y deja su evento.
+func TestSetActiveSCIMRoundTrip(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectExec(`UPDATE "users" SET "deactivated_at"=.*,"deactivated_by"=`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "events"`).
+		WithArgs(5, "account.deactivated", nil, `{"by":0,"reason":"scim"}`, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`UPDATE "users" SET "deactivated_at"=`).WithArgs(nil, "", 5).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "events"`).
+		WithArgs(5, "account.reactivated", nil, `{"by":0}`, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+	u := User{ID: 5}
+	if err := setActive(db, &u, false); err != nil {
+		t.Fatal(err)
+	}
+	if u.DeactivatedAt == nil || u.DeactivatedBy != DeactivatedBySCIM {
+		t.Fatalf("no desactivó: %+v", u)
+	}
+	since := *u.DeactivatedAt
+	if err := setActive(db, &u, false); err != nil {
+		t.Fatal(err)
+	}
+	if !u.DeactivatedAt.Equal(since) {
+		t.Error("desactivar otra vez cambió la fecha")
+	}
+	if err := setActive(db, &u, true); err != nil {
+		t.Fatal(err)
+	}
+	if u.DeactivatedAt != nil || u.DeactivatedBy != "" {
+		t.Errorf("no reactivó lo que desactivó SCIM: %+v", u)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplySCIMActiveString(t *testing.T) {
+	var u User
+	active, err := applySCIMValues(&u, map[string]any{"active": "False"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active == nil || *active {
+		t.Errorf(`"False" = %v, quería false`, active)
+	}
+	if _, err := applySCIMValues(&u, map[string]any{"active": "quizá"}); err == nil {
+		t.Error("aceptó un active que no es bool")
+	}
+}
+
+func scimTestRouter(db *gorm.DB) *gin.Engine {
+	r := gin.New()
+	r.PATCH("/scim/v2/Users/:id", scimPatchUserHandler(db))
+	r.DELETE("/scim/v2/Users/:id", scimDeleteUserHandler(db))
+	return r
+}
+
+func expectOnlyAdmin(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT \* FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role"}).AddRow(1, "root@example.com", RoleAdmin))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+}
+
+func TestSCIMDeleteKeepsLastAdmin(t *testing.T) {
+	db, mock := newMockDB(t)
+	expectOnlyAdmin(mock)
+	if w := doRequest(scimTestRouter(db), "DELETE", "/scim/v2/Users/1", ""); w.Code != 409 {
+		t.Fatalf("borrar el último admin: %d, quería 409", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSCIMDeactivateKeepsLastAdmin(t *testing.T) {
+	db, mock := newMockDB(t)
+	expectOnlyAdmin(mock)
+	req := httptest.NewRequest("PATCH", "/scim/v2/Users/1",
+		strings.NewReader(`{"Operations":[{"op":"replace","path":"active","value":false}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	scimTestRouter(db).ServeHTTP(w, req)
+	if w.Code != 409 {
+		t.Fatalf("desactivar el último admin: %d, quería 409", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func scimGroupRequest(db *gorm.DB, body string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.PATCH("/scim/v2/Groups/:id", scimPatchGroupHandler(db))
+	req := httptest.NewRequest("PATCH", "/scim/v2/Groups/admins", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// Meter a uno y sacar al otro en la misma petición cambia el admin sin pasar
+// por una instancia sin admin.
+func TestSCIMGroupPatchSwapsAdmin(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "role"=.* WHERE id IN`).WithArgs(RoleAdmin, 5, RoleAdmin).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT "id","role" FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role"}).AddRow(1, RoleAdmin))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec(`UPDATE "users" SET "role"=`).WithArgs(RoleUser, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT "id","email" FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(5, "eva@example.com"))
+
+	w := scimGroupRequest(db, `{"Operations":[{"op":"add","path":"members","value":[{"value":"5"}]},
+		{"op":"remove","path":"members[value eq \"1\"]"}]}`)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"value":"5"`) {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSCIMGroupPatchKeepsLastAdmin(t *testing.T) {
+	db, mock := newMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "id","role" FROM "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role"}).AddRow(1, RoleAdmin))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+
+	w := scimGroupRequest(db, `{"Operations":[{"op":"remove","path":"members","value":[{"value":"1"}]}]}`)
+	if w.Code != 409 {
+		t.Fatalf("sacar al último admin del grupo: %d, quería 409", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
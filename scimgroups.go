@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= SCIM: GRUPO DE ADMINS =========
+//
+// Con SCIM_ADMIN_GROUP=<nombre del grupo en el IdP>, /scim/v2/Groups expone
+// un único grupo con ese displayName cuyos miembros son los admin de
+// instancia. El IdP lo empuja (Push Groups en Okta, asignación de grupos en
+// Azure AD) y meter o sacar a alguien le da o le quita el rol, igual que
+// LDAP_ADMIN_GROUP. No se guardan otros grupos: crearlos da 400.
+//
+// Como en el resto de sitios, nunca se le quita el rol al último admin
+// activo: la operación entera falla con 409.
+
+const (
+	scimGroupSchema  = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimAdminGroupID = "admins"
+)
+
+var (
+	scimAdminGroup = os.Getenv("SCIM_ADMIN_GROUP")
+
+	scimGroupFilterRe = regexp.MustCompile(`^displayName eq "([^"]+)"$`)
+	scimMemberPathRe  = regexp.MustCompile(`^members\[value eq "([^"]+)"\]$`)
+
+	errSCIMLastAdmin = errors.New("no se puede quitar el último admin")
+)
+
+func scimAdminGroupResource(db *gorm.DB) (gin.H, error) {
+	var admins []User
+	if err := db.Select("id", "email").Where("role = ?", RoleAdmin).Order("id").Find(&admins).Error; err != nil {
+		return nil, err
+	}
+	members := make([]gin.H, 0, len(admins))
+	for _, u := range admins {
+		members = append(members, gin.H{"value": strconv.FormatUint(uint64(u.ID), 10), "display": u.Email})
+	}
+	return gin.H{
+		"schemas":     []string{scimGroupSchema},
+		"id":          scimAdminGroupID,
+		"displayName": scimAdminGroup,
+		"members":     members,
+		"meta": gin.H{
+			"resourceType": "Group",
+			"location":     fmt.Sprintf("%s/scim/v2/Groups/%s", publicURL, scimAdminGroupID),
+		},
+	}, nil
+}
+
+// scimMemberIDs lee los ids de una lista de miembros [{"value": "5"}, ...].
+func scimMemberIDs(v any) ([]uint, error) {
+	list, ok := v.([]any)
+	if !ok && v != nil {
+		return nil, errors.New("members debe ser una lista")
+	}
+	ids := make([]uint, 0, len(list))
+	for _, m := range list {
+		obj, _ := m.(map[string]any)
+		s, _ := obj["value"].(string)
+		id, err := strconv.ParseUint(s, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("miembro no válido: %v", m)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// setSCIMAdmins da el rol admin a add y se lo quita a remove. Con exact, add
+// es el grupo entero y se le quita a cualquier otro admin (PUT, replace).
+// Primero se promueve, así que cambiar un admin por otro en la misma petición
+// no choca con la protección del último admin.
+func setSCIMAdmins(tx *gorm.DB, add, remove []uint, exact bool) error {
+	if exact {
+		var current []uint
+		if err := tx.Model(&User{}).Where("role = ?", RoleAdmin).Pluck("id", &current).Error; err != nil {
+			return err
+		}
+		remove = slices.DeleteFunc(current, func(id uint) bool { return slices.Contains(add, id) })
+	}
+	if len(add) > 0 {
+		if err := tx.Model(&User{}).Where("id IN ? AND role <> ?", add, RoleAdmin).Update("role", RoleAdmin).Error; err != nil {
+			return err
+		}
+	}
+	for _, id := range remove {
+		var u User
+		err := tx.Select("id", "role").First(&u, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if u.Role != RoleAdmin {
+			continue
+		}
+		if !otherAdminsExist(tx, id) {
+			return errSCIMLastAdmin
+		}
+		if err := tx.Model(&u).Update("role", RoleUser).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scimGroupResult responde a un cambio de miembros con el grupo resultante.
+func scimGroupResult(c *gin.Context, db *gorm.DB, status int, err error) {
+	switch {
+	case errors.Is(err, errSCIMLastAdmin):
+		scimError(c, 409, err.Error())
+		return
+	case err != nil:
+		scimError(c, 500, "db error")
+		return
+	}
+	g, err := scimAdminGroupResource(db)
+	if err != nil {
+		scimError(c, 500, "db error")
+		return
+	}
+	scimJSON(c, status, g)
+}
+
+func scimListGroupsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res := []gin.H{}
+		match := true
+		if f := strings.TrimSpace(c.Query("filter")); f != "" {
+			m := scimGroupFilterRe.FindStringSubmatch(f)
+			if m == nil {
+				scimError(c, 400, "solo se soporta el filtro displayName eq \"...\"")
+				return
+			}
+			match = strings.EqualFold(m[1], scimAdminGroup)
+		}
+		if match {
+			g, err := scimAdminGroupResource(db)
+			if err != nil {
+				scimError(c, 500, "db error")
+				return
+			}
+			res = append(res, g)
+		}
+		scimJSON(c, 200, gin.H{
+			"schemas":      []string{scimListSchema},
+			"totalResults": len(res),
+			"startIndex":   1,
+			"itemsPerPage": len(res),
+			"Resources":    res,
+		})
+	}
+}
+
+func scimGetGroupHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param("id") != scimAdminGroupID {
+			scimError(c, 404, "grupo no encontrado")
+			return
+		}
+		scimGroupResult(c, db, 200, nil)
+	}
+}
+
+type scimGroupIn struct {
+	DisplayName string `json:"displayName"`
+	Members     any    `json:"members"`
+}
+
+// scimCreateGroupHandler solo acepta el grupo de admins: el IdP lo crea al
+// empujarlo por primera vez si no lo encontró por nombre.
+func scimCreateGroupHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var in scimGroupIn
+		if err := c.ShouldBindJSON(&in); err != nil {
+			scimError(c, 400, err.Error())
+			return
+		}
+		if !strings.EqualFold(in.DisplayName, scimAdminGroup) {
+			scimError(c, 400, "solo se sincroniza el grupo "+scimAdminGroup)
+			return
+		}
+		ids, err := scimMemberIDs(in.Members)
+		if err != nil {
+			scimError(c, 400, err.Error())
+			return
+		}
+		err = db.Transaction(func(tx *gorm.DB) error { return setSCIMAdmins(tx, ids, nil, true) })
+		scimGroupResult(c, db, 201, err)
+	}
+}
+
+func scimReplaceGroupHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param("id") != scimAdminGroupID {
+			scimError(c, 404, "grupo no encontrado")
+			return
+		}
+		var in scimGroupIn
+		if err := c.ShouldBindJSON(&in); err != nil {
+			scimError(c, 400, err.Error())
+			return
+		}
+		ids, err := scimMemberIDs(in.Members)
+		if err != nil {
+			scimError(c, 400, err.Error())
+			return
+		}
+		err = db.Transaction(func(tx *gorm.DB) error { return setSCIMAdmins(tx, ids, nil, true) })
+		scimGroupResult(c, db, 200, err)
+	}
+}
+
+// scimPatchGroupHandler entiende las dos formas habituales de tocar miembros:
+// add/remove con path "members" y una lista (Azure AD) y remove con
+// path `members[value eq "5"]` (Okta). El cambio de displayName se ignora.
+func scimPatchGroupHandler(db *gorm.DB) gin.HandlerFunc {
+	type opT struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}
+	type inT struct {
+		Operations []opT `json:"Operations"`
+	}
+	return func(c *gin.Context) {
+		if c.Param("id") != scimAdminGroupID {
+			scimError(c, 404, "grupo no encontrado")
+			return
+		}
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			scimError(c, 400, err.Error())
+			return
+		}
+		var badRequest error
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, op := range in.Operations {
+				value := op.Value
+				if op.Path == "" {
+					m, _ := op.Value.(map[string]any)
+					if _, ok := m["members"]; !ok {
+						continue // solo displayName
+					}
+					op.Path, value = "members", m["members"]
+				}
+				var ids []uint
+				if m := scimMemberPathRe.FindStringSubmatch(op.Path); m != nil {
+					id, err := strconv.ParseUint(m[1], 10, 0)
+					if err != nil {
+						badRequest = fmt.Errorf("miembro no válido: %s", m[1])
+						return badRequest
+					}
+					ids = []uint{uint(id)}
+				} else if op.Path == "members" {
+					if ids, badRequest = scimMemberIDs(value); badRequest != nil {
+						return badRequest
+					}
+				} else {
+					continue // displayName y otros atributos del grupo
+				}
+				var err error
+				switch strings.ToLower(op.Op) {
+				case "add":
+					err = setSCIMAdmins(tx, ids, nil, false)
+				case "remove":
+					if op.Path == "members" && value == nil {
+						err = setSCIMAdmins(tx, nil, nil, true) // quitar a todos
+					} else {
+						err = setSCIMAdmins(tx, nil, ids, false)
+					}
+				case "replace":
+					err = setSCIMAdmins(tx, ids, nil, true)
+				default:
+					badRequest = errors.New("operación no soportada: " + op.Op)
+					return badRequest
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if badRequest != nil {
+			scimError(c, 400, badRequest.Error())
+			return
+		}
+		scimGroupResult(c, db, 200, err)
+	}
+}
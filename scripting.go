@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// ========= SCRIPTING =========
+//
+// Scripts Starlark (*.star) en SCRIPTS_DIR que se ejecutan en los eventos de
+// tareas. Cada script puede definir:
+//
+//	def before_save(task):      # puede modificar task["title"], ["done"], ["priority"], ["due_at"]
+//	    if "urgente" in task["title"]:
+//	        task["priority"] = "high"
+//
+//	def on_event(kind, task):   # kind: task.created, task.updated, task.deleted, task.reminder
+//	    webhook("https://hooks.example.com/x", json.encode(task))
+//
+// La API es deliberadamente pequeña: json, webhook(url, body), print y fail.
+// No hay load() ni acceso a disco, y cada llamada tiene límite de pasos y tiempo.
+
+var (
+	scriptTimeout   = 2 * time.Second
+	scriptMaxSteps  = uint64(1_000_000)
+	scriptHTTP      = &http.Client{Timeout: 5 * time.Second}
+	scriptHostAllow = splitList(os.Getenv("SCRIPT_WEBHOOK_HOSTS"))
+)
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+type scriptPlugin struct {
+	name    string
+	globals starlark.StringDict
+}
+
+func (s *scriptPlugin) Name() string { return "script:" + s.name }
+
+// loadScripts compila todos los scripts de dir y los registra como plugins.
+// Un script con errores impide arrancar: mejor fallar pronto que ignorarlo.
+func loadScripts(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.star"))
+	if err != nil {
+		return err
+	}
+	predeclared := starlark.StringDict{
+		"json":    json.Module,
+		"webhook": starlark.NewBuiltin("webhook", scriptWebhook),
+	}
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(f)
+		th := newScriptThread(name)
+		globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, th, name, src, predeclared)
+		if err != nil {
+			return fmt.Errorf("script %s: %w", name, err)
+		}
+		globals.Freeze()
+		registerPlugin(&scriptPlugin{name: name, globals: globals})
+	}
+	return nil
+}
+
+func newScriptThread(name string) *starlark.Thread {
+	th := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Printf("[SCRIPT %s] %s", name, msg)
+		},
+	}
+	th.SetMaxExecutionSteps(scriptMaxSteps)
+	return th
+}
+
+// call ejecuta fnName si el script la define; si no, no hace nada.
+func (s *scriptPlugin) call(fnName string, args starlark.Tuple) error {
+	fn, ok := s.globals[fnName].(starlark.Callable)
+	if !ok {
+		return nil
+	}
+	th := newScriptThread(s.name)
+	timer := time.AfterFunc(scriptTimeout, func() { th.Cancel("tiempo agotado") })
+	defer timer.Stop()
+	_, err := starlark.Call(th, fn, args, nil)
+	return err
+}
+
+func (s *scriptPlugin) BeforeTaskSave(_ context.Context, t *Task) error {
+	d := taskToStarlark(*t)
+	if err := s.call("before_save", starlark.Tuple{d}); err != nil {
+		return fmt.Errorf("%s: %v", s.Name(), err)
+	}
+	return applyStarlarkTask(d, t)
+}
+
+func (s *scriptPlugin) OnTaskEvent(_ context.Context, ev TaskEvent) {
+	if err := s.call("on_event", starlark.Tuple{starlark.String(ev.Kind), taskToStarlark(ev.Task)}); err != nil {
+		log.Printf("[SCRIPT %s] on_event %s: %v", s.name, ev.Kind, err)
+	}
+}
+
+func taskToStarlark(t Task) *starlark.Dict {
+	d := starlark.NewDict(6)
+	d.SetKey(starlark.String("id"), starlark.MakeUint(t.ID))
+	d.SetKey(starlark.String("user_id"), starlark.MakeUint(t.UserID))
+	d.SetKey(starlark.String("title"), starlark.String(t.Title))
+	d.SetKey(starlark.String("done"), starlark.Bool(t.Done))
+	d.SetKey(starlark.String("priority"), starlark.String(t.Priority))
+	if t.DueAt != nil {
+		d.SetKey(starlark.String("due_at"), starlark.String(t.DueAt.UTC().Format(time.RFC3339)))
+	} else {
+		d.SetKey(starlark.String("due_at"), starlark.None)
+	}
+	return d
+}
+
+// applyStarlarkTask copia a t los campos editables del dict, validándolos.
+func applyStarlarkTask(d *starlark.Dict, t *Task) error {
+	get := func(k string) starlark.Value {
+		v, _, _ := d.Get(starlark.String(k))
+		return v
+	}
+	title, ok := starlark.AsString(get("title"))
+	if !ok || strings.TrimSpace(title) == "" {
+		return fmt.Errorf("script: title inválido")
+	}
+	done, ok := get("done").(starlark.Bool)
+	if !ok {
+		return fmt.Errorf("script: done debe ser bool")
+	}
+	prio, ok := starlark.AsString(get("priority"))
+	if !ok || !validPriorities[prio] {
+		return fmt.Errorf("script: priority inválida")
+	}
+	var due *time.Time
+	switch v := get("due_at").(type) {
+	case starlark.NoneType:
+	case starlark.String:
+		parsed, err := time.Parse(time.RFC3339, string(v))
+		if err != nil {
+			return fmt.Errorf("script: due_at inválido")
+		}
+		due = &parsed
+	default:
+		return fmt.Errorf("script: due_at debe ser string o None")
+	}
+	t.Title, t.Done, t.Priority, t.DueAt = title, bool(done), prio, due
+	return nil
+}
+
+// scriptWebhook implementa webhook(url, body): POST con body como JSON.
+func scriptWebhook(th *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var rawURL, body string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &rawURL, "body", &body); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("webhook: url inválida")
+	}
+	if len(scriptHostAllow) > 0 && !containsString(scriptHostAllow, u.Hostname()) {
+		return nil, fmt.Errorf("webhook: host %s no permitido", u.Hostname())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scriptHTTP.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := scriptHTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webhook: %v", err)
+	}
+	resp.Body.Close()
+	return starlark.MakeInt(resp.StatusCode), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= SEARCH =========
+//
+// Búsqueda insensible a acentos: combinamos FTS (con el diccionario del idioma
+// del usuario) para palabras completas y pg_trgm para trozos de palabra y
+// erratas. unaccent no es IMMUTABLE, así que lo envolvemos en f_unaccent para
+// poder indexar la expresión.
+
+var searchLanguages = map[string]bool{
+	"simple": true, "spanish": true, "english": true, "french": true,
+	"german": true, "italian": true, "portuguese": true,
+}
+
+var searchMigrations = []string{
+	`CREATE EXTENSION IF NOT EXISTS unaccent`,
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`CREATE OR REPLACE FUNCTION f_unaccent(text) RETURNS text AS
+	 $$ SELECT public.unaccent('public.unaccent', $1) $$
+	 LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT`,
+	`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_tasks_title_trgm ON tasks
+	 USING gin (f_unaccent(lower(title)) gin_trgm_ops)`,
+}
+
+// escapeLike evita que % y _ del usuario actúen como comodines.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func searchTasksHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			c.JSON(400, gin.H{"error": "q requerido"})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit < 1 || limit > 100 {
+			limit = 20
+		}
+		var u User
+		if err := db.Select("search_language").First(&u, uid).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		lang := u.SearchLanguage
+		if !searchLanguages[lang] {
+			lang = "simple"
+		}
+		var tasks []Task
+		err = db.Where("user_id = ?", uid).
+			Where(`to_tsvector(?::regconfig, f_unaccent(title)) @@ websearch_to_tsquery(?::regconfig, f_unaccent(?))
+				OR f_unaccent(lower(title)) % f_unaccent(lower(?))
+				OR f_unaccent(lower(title)) LIKE '%' || f_unaccent(lower(?)) || '%'`,
+				lang, lang, q, q, escapeLike(q)).
+			Order(gorm.Expr(`ts_rank(to_tsvector(?::regconfig, f_unaccent(title)), websearch_to_tsquery(?::regconfig, f_unaccent(?))) DESC,
+				similarity(f_unaccent(lower(title)), f_unaccent(lower(?))) DESC, id DESC`, lang, lang, q, q)).
+			Limit(limit).
+			Find(&tasks).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, tasks)
+	}
+}
+
+func updateMeHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		SearchLanguage *string `json:"search_language"`
+		// true reactiva una dirección suprimida por rebote o queja.
+		EmailDeliverable *bool   `json:"email_deliverable"`
+		Timezone         *string `json:"timezone"`
+		// Solo se cambian los campos presentes; null borra uno.
+		ListPrefs map[string]json.RawMessage `json:"list_prefs"`
+		// "" despublica el perfil público.
+		PublicSlug *string `json:"public_slug"`
+	}
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if in.SearchLanguage != nil {
+			if !searchLanguages[*in.SearchLanguage] {
+				c.JSON(400, gin.H{"error": "search_language no soportado"})
+				return
+			}
+			u.SearchLanguage = *in.SearchLanguage
+		}
+		if in.Timezone != nil {
+			if _, err := time.LoadLocation(*in.Timezone); err != nil || *in.Timezone == "" || *in.Timezone == "Local" {
+				c.JSON(400, gin.H{"error": "timezone debe ser una zona IANA, p.ej. Europe/Madrid"})
+				return
+			}
+			u.Timezone = *in.Timezone
+		}
+		if in.ListPrefs != nil {
+			prefs, err := u.ListPrefs.patch(in.ListPrefs)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			u.ListPrefs = prefs
+		}
+		if in.PublicSlug != nil {
+			u.PublicSlug = nil
+			if slug := strings.ToLower(strings.TrimSpace(*in.PublicSlug)); slug != "" {
+				if msg := validateSlug(slug); msg != "" {
+					c.JSON(400, gin.H{"error": msg})
+					return
+				}
+				var taken int64
+				db.Model(&User{}).Where("public_slug = ? AND id <> ?", slug, u.ID).Count(&taken)
+				if taken > 0 {
+					c.JSON(409, gin.H{"error": "ese public_slug ya está cogido"})
+					return
+				}
+				u.PublicSlug = &slug
+			}
+		}
+		if in.EmailDeliverable != nil && *in.EmailDeliverable {
+			u.EmailUndeliverableAt, u.EmailSuppressionReason = nil, ""
+		}
+		if err := db.Save(&u).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		purgeCDN(requestDB(db, c.Request.Context()), userCacheKey(u.ID))
+		c.JSON(200, u)
+	}
+}
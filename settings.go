@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========= AJUSTES DE INSTANCIA =========
+//
+// Configuración que se cambia en caliente desde la API (asistente de
+// arranque, admin) en vez de con variables de entorno y un redeploy. Cada
+// ajuste es una fila clave -> JSON.
+
+type Setting struct {
+	Key       string    `gorm:"primaryKey"`
+	Value     string    `gorm:"type:jsonb;not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+// getSetting lee key en dst. Devuelve false si no existe.
+func getSetting(db *gorm.DB, key string, dst any) (bool, error) {
+	var s Setting
+	err := db.Where("key = ?", key).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(s.Value), dst)
+}
+
+// putSetting crea o reemplaza key.
+func putSetting(db *gorm.DB, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s := Setting{Key: key, Value: string(raw), UpdatedAt: time.Now()}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&s).Error
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ========= ASISTENTE DE PRIMER ARRANQUE =========
+//
+// Con la base de datos vacía la instancia no admite registros normales: el
+// primer usuario se crea en /setup, ya como admin, junto con la configuración
+// inicial. Antes se pueden probar la base de datos y el correo. Al terminar,
+// /setup responde 410 para siempre.
+//
+// Mientras tanto tampoco el SSO crea cuentas: ni el alta automática de OIDC
+// ni el primer login por LDAP. Las cuentas que ya existan sí pueden entrar.
+//
+// En una instancia expuesta conviene fijar SETUP_TOKEN: sin él, cualquiera
+// que llegue antes que tú se queda con el admin. SETUP_WIZARD=false vuelve al
+// arranque de antes (registro abierto y ADMIN_EMAILS).
+
+const settingSetupCompleted = "setup.completed_at"
+
+var (
+	setupWizard = getEnv("SETUP_WIZARD", "true") == "true"
+	setupToken  = os.Getenv("SETUP_TOKEN")
+	setupDone   atomic.Bool
+
+	errSetupPending = errors.New("instancia sin configurar: el primer usuario se crea en /setup")
+)
+
+// loadSetupState decide al arrancar si hace falta el asistente: no hace falta
+// si ya se completó o si la instancia ya tiene usuarios (instalaciones
+// anteriores al asistente).
+func loadSetupState(db *gorm.DB) error {
+	if !setupWizard {
+		setupDone.Store(true)
+		return nil
+	}
+	var at time.Time
+	found, err := getSetting(db, settingSetupCompleted, &at)
+	if err != nil {
+		return err
+	}
+	var users int64
+	if err := db.Model(&User{}).Where("is_demo = ?", false).Count(&users).Error; err != nil {
+		return err
+	}
+	setupDone.Store(found || users > 0)
+	return nil
+}
+
+// setupNeeded mira la base de datos mientras el asistente esté pendiente, para
+// que las demás réplicas se enteren cuando una lo complete.
+func setupNeeded(db *gorm.DB) bool {
+	if setupDone.Load() {
+		return false
+	}
+	var at time.Time
+	if found, _ := getSetting(db, settingSetupCompleted, &at); found {
+		setupDone.Store(true)
+		return false
+	}
+	return true
+}
+
+// SetupGuard deja pasar solo mientras falta el asistente y, si hay
+// SETUP_TOKEN, con la cabecera X-Setup-Token correcta.
+func SetupGuard(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !setupNeeded(db) {
+			c.AbortWithStatusJSON(410, gin.H{"error": "la instancia ya está configurada"})
+			return
+		}
+		if setupToken != "" && c.Request.Method != "GET" &&
+			subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Setup-Token")), []byte(setupToken)) != 1 {
+			c.AbortWithStatusJSON(401, gin.H{"error": "X-Setup-Token incorrecto"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func setupStatusHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"needed":         true, // si no, SetupGuard ya respondió 410
+			"token_required": setupToken != "",
+			"mailer":         getEnv("MAILER", "log"),
+		})
+	}
+}
+
+// setupCheckHandler prueba la conexión a la base de datos y, si se pide un
+// destinatario, manda un correo de prueba con el Mailer configurado.
+func setupCheckHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		TestEmail string `json:"test_email" binding:"omitempty,email"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+		checks := gin.H{}
+
+		var pgVersion string
+		if err := db.WithContext(ctx).Raw("SHOW server_version").Scan(&pgVersion).Error; err != nil {
+			checks["database"] = gin.H{"ok": false, "error": err.Error()}
+		} else {
+			checks["database"] = gin.H{"ok": true, "version": pgVersion}
+		}
+
+		if in.TestEmail != "" {
+			err := mailer.Send(ctx, Email{
+				To:      in.TestEmail,
+				Subject: "TaskFlow: correo de prueba",
+				Text:    "Si lees esto, el correo de la instancia está bien configurado.",
+			})
+			if err != nil {
+				checks["email"] = gin.H{"ok": false, "error": err.Error()}
+			} else {
+				checks["email"] = gin.H{"ok": true, "mailer": getEnv("MAILER", "log")}
+			}
+		}
+		c.JSON(200, checks)
+	}
+}
+
+// setupCompleteHandler crea el primer admin, guarda la configuración inicial y
+// cierra el asistente, todo en una transacción: si dos peticiones llegan a la
+// vez, la segunda choca con la clave del ajuste y no crea nada.
+func setupCompleteHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Email        string `json:"email" binding:"required,email"`
+		Password     string `json:"password" binding:"required,min=8"`
+		InstanceName string `json:"instance_name"`
+		// Registration fija el modo de registro inicial (por defecto el de
+		// REGISTRATION_MODE).
+		Registration *registrationSettings `json:"registration"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if rejected, _ := checkBreachedPassword(c.Request.Context(), in.Password); rejected {
+			c.JSON(400, gin.H{"error": breachedPasswordMsg})
+			return
+		}
+		brand := Branding{Name: in.InstanceName}
+		if err := brand.validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if in.Registration != nil {
+			if err := in.Registration.validate(); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "no se pudo guardar la contraseña"})
+			return
+		}
+		u := User{Email: strings.ToLower(in.Email), PasswordHash: string(hash), Role: RoleAdmin}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			done := Setting{Key: settingSetupCompleted, Value: `"` + now.UTC().Format(time.RFC3339) + `"`, UpdatedAt: now}
+			if err := tx.Create(&done).Error; err != nil {
+				return err
+			}
+			if strings.TrimSpace(in.InstanceName) != "" {
+				if err := putSetting(tx, settingBranding, brand); err != nil {
+					return err
+				}
+			}
+			if in.Registration != nil {
+				if err := putSetting(tx, settingRegistration, in.Registration); err != nil {
+					return err
+				}
+			}
+			return tx.Create(&u).Error
+		})
+		if err != nil {
+			c.JSON(409, gin.H{"error": "la configuración ya se completó o el email existe"})
+			return
+		}
+		setupDone.Store(true)
+		recordEvent(db, u.ID, "instance.setup", nil, gin.H{"instance_name": in.InstanceName})
+		tok, err := issueToken(u)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "no se pudo firmar token"})
+			return
+		}
+		c.JSON(201, gin.H{"user": u, "token": tok})
+	}
+}
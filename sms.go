@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= SMS =========
+
+// SMSProvider abstrae al proveedor de SMS para poder cambiar Twilio por otro
+// (o por el log en desarrollo) sin tocar el canal.
+type SMSProvider interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+var (
+	smsProvider    SMSProvider
+	smsMonthlyCap  = getEnvInt("SMS_MONTHLY_CAP", 30)
+	errSMSCapped   = errors.New("límite mensual de SMS alcanzado")
+	e164Re         = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	phoneCodeTTL   = 10 * time.Minute
+	maxCodeAttempt = 5
+)
+
+func getEnvInt(k string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(k)); err == nil {
+		return v
+	}
+	return def
+}
+
+// newSMSProvider usa Twilio si hay credenciales y, si no, solo loguea.
+func newSMSProvider() SMSProvider {
+	sid, token, from := os.Getenv("TWILIO_ACCOUNT_SID"), os.Getenv("TWILIO_AUTH_TOKEN"), os.Getenv("TWILIO_FROM")
+	if sid == "" || token == "" || from == "" {
+		log.Println("TWILIO_* sin configurar: los SMS solo se registran en el log")
+		return logSMSProvider{}
+	}
+	return &twilioProvider{accountSID: sid, authToken: token, from: from}
+}
+
+type logSMSProvider struct{}
+
+func (logSMSProvider) SendSMS(_ context.Context, to, body string) error {
+	log.Printf("[SMS] a %s: %s", to, body)
+	return nil
+}
+
+type twilioProvider struct {
+	accountSID string
+	authToken  string
+	from       string
+}
+
+func (p *twilioProvider) SendSMS(ctx context.Context, to, body string) error {
+	endpoint := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", p.accountSID)
+	form := url.Values{"To": {to}, "From": {p.from}, "Body": {body}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.accountSID, p.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("twilio respondió %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// reserveSMS consume un SMS del cupo mensual del usuario de forma atómica.
+// Devuelve errSMSCapped si ya no quedan.
+func reserveSMS(db *gorm.DB, userID uint) error {
+	period := time.Now().UTC().Format("2006-01")
+	res := db.Model(&User{}).
+		Where("id = ? AND (sms_period IS NULL OR sms_period <> ? OR sms_sent < ?)", userID, period, smsMonthlyCap).
+		Updates(map[string]any{
+			"sms_sent":   gorm.Expr("CASE WHEN sms_period = ? THEN sms_sent + 1 ELSE 1 END", period),
+			"sms_period": period,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errSMSCapped
+	}
+	checkSMSQuota(db, userID)
+	return nil
+}
+
+// smsNotifier solo envía recordatorios de prioridad alta: el SMS cuesta
+// dinero y el resto de prioridades ya llegan por los canales gratuitos.
+type smsNotifier struct {
+	db       *gorm.DB
+	provider SMSProvider
+}
+
+func (s *smsNotifier) Send(ctx context.Context, n Notification) error {
+	if n.Priority != "high" {
+		return errNotifySkipped
+	}
+	db := s.db
+	var u User
+	if err := db.First(&u, n.UserID).Error; err != nil {
+		return err
+	}
+	if !u.PhoneVerified || u.Phone == "" {
+		return errors.New("teléfono no verificado")
+	}
+	if err := reserveSMS(db, u.ID); err != nil {
+		return err
+	}
+	return s.provider.SendSMS(ctx, u.Phone, n.Title+": "+n.Body)
+}
+
+func hashPhoneCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func meHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if err := db.First(&u, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		c.JSON(200, u)
+	}
+}
+
+// startPhoneVerificationHandler guarda el teléfono (sin verificar) y envía un
+// código de 6 dígitos. El SMS del código también cuenta para el cupo mensual.
+func startPhoneVerificationHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Phone string `json:"phone" binding:"required"`
+	}
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		if isDemoUser(db, uid) {
+			c.JSON(403, gin.H{"error": "las cuentas demo no pueden enviar SMS"})
+			return
+		}
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		phone := strings.ReplaceAll(in.Phone, " ", "")
+		if !e164Re.MatchString(phone) {
+			c.JSON(400, gin.H{"error": "teléfono debe estar en formato E.164 (+34600111222)"})
+			return
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			c.JSON(500, gin.H{"error": "no se pudo generar código"})
+			return
+		}
+		code := fmt.Sprintf("%06d", n.Int64())
+		if err := reserveSMS(db, uid); err != nil {
+			if errors.Is(err, errSMSCapped) {
+				c.JSON(429, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		exp := time.Now().Add(phoneCodeTTL)
+		if err := db.Model(&User{}).Where("id = ?", uid).Updates(map[string]any{
+			"phone":                 phone,
+			"phone_verified":        false,
+			"phone_code_hash":       hashPhoneCode(code),
+			"phone_code_expires_at": exp,
+			"phone_code_attempts":   0,
+		}).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if err := smsProvider.SendSMS(c.Request.Context(), phone, "Tu código de TaskFlow: "+code); err != nil {
+			c.JSON(502, gin.H{"error": "no se pudo enviar el SMS"})
+			return
+		}
+		c.JSON(202, gin.H{"phone": phone, "expires_at": exp})
+	}
+}
+
+func verifyPhoneHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Code string `json:"code" binding:"required"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var u User
+		if err := db.First(&u, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "usuario no encontrado"})
+			return
+		}
+		if u.PhoneCodeHash == "" || u.PhoneCodeExpiresAt == nil || time.Now().After(*u.PhoneCodeExpiresAt) {
+			c.JSON(400, gin.H{"error": "no hay código pendiente o ha caducado"})
+			return
+		}
+		if u.PhoneCodeAttempts >= maxCodeAttempt {
+			c.JSON(429, gin.H{"error": "demasiados intentos, pide un código nuevo"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(hashPhoneCode(in.Code)), []byte(u.PhoneCodeHash)) != 1 {
+			db.Model(&u).Update("phone_code_attempts", gorm.Expr("phone_code_attempts + 1"))
+			c.JSON(400, gin.H{"error": "código incorrecto"})
+			return
+		}
+		if err := db.Model(&u).Updates(map[string]any{
+			"phone_verified":        true,
+			"phone_code_hash":       "",
+			"phone_code_expires_at": nil,
+			"phone_code_attempts":   0,
+		}).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"phone": u.Phone, "phone_verified": true})
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Un recordatorio que no es de prioridad alta no sale por SMS, y eso no es un
+// envío correcto: el canal no puede pasar a "ok" por él.
+func TestSMSSkipIsNotRecorded(t *testing.T) {
+	db, mock := newMockDB(t)
+	err := (&smsNotifier{db: db}).Send(context.Background(), Notification{UserID: 7, Priority: "normal"})
+	if !errors.Is(err, errNotifySkipped) {
+		t.Fatalf("err = %v, quería errNotifySkipped", err)
+	}
+
+	mock.ExpectExec(`UPDATE "notification_channels"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	recordChannelResult(db, NotificationChannel{ID: 3, UserID: 7, Kind: "sms"}, err)
+	if mock.ExpectationsWereMet() == nil {
+		t.Fatal("guardó el salto como resultado del canal")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= STATS =========
+//
+// Las estadísticas se leen de vistas materializadas que un trabajo refresca
+// cada STATS_REFRESH_MINUTES (10 por defecto), así los endpoints nunca
+// recorren la tabla tasks. Los datos pueden ir unos minutos por detrás:
+// refreshed_at indica cuándo se calcularon.
+
+// statsMigrations rellena completed_at en tareas hechas antes de existir la
+// columna y crea las vistas.
+var statsMigrations = []string{
+	`UPDATE tasks SET completed_at = updated_at WHERE done AND completed_at IS NULL`,
+
+	`CREATE MATERIALIZED VIEW IF NOT EXISTS stats_tasks_per_day AS
+	SELECT user_id, day, sum(created)::int AS created, sum(completed)::int AS completed
+	FROM (
+		SELECT user_id, created_at::date AS day, 1 AS created, 0 AS completed FROM tasks
+		UNION ALL
+		SELECT user_id, completed_at::date, 0, 1 FROM tasks WHERE completed_at IS NOT NULL
+	) t
+	GROUP BY user_id, day`,
+	`CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS stats_tasks_per_day_pk ON stats_tasks_per_day (user_id, day)`,
+
+	`CREATE MATERIALIZED VIEW IF NOT EXISTS stats_user_completions AS
+	SELECT user_id,
+		count(*)::int AS total,
+		count(*) FILTER (WHERE done)::int AS done,
+		count(*) FILTER (WHERE completed_at > now() - interval '7 days')::int AS completed_7d,
+		count(*) FILTER (WHERE completed_at > now() - interval '30 days')::int AS completed_30d,
+		now() AS refreshed_at
+	FROM tasks
+	GROUP BY user_id`,
+	`CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS stats_user_completions_pk ON stats_user_completions (user_id)`,
+
+	`CREATE MATERIALIZED VIEW IF NOT EXISTS stats_overdue AS
+	SELECT user_id, count(*)::int AS overdue, min(due_at) AS oldest_due_at, now() AS snapshot_at
+	FROM tasks
+	WHERE NOT done AND due_at < now()
+	GROUP BY user_id`,
+	`CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS stats_overdue_pk ON stats_overdue (user_id)`,
+}
+
+// refreshStatsJob refresca las vistas sin bloquear las lecturas (CONCURRENTLY
+// necesita el índice único de cada vista).
+func refreshStatsJob(ctx context.Context, db *gorm.DB, _ Job) error {
+	for _, v := range []string{"stats_tasks_per_day", "stats_user_completions", "stats_overdue"} {
+		if err := db.WithContext(ctx).Exec("REFRESH MATERIALIZED VIEW CONCURRENTLY " + v).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startStatsScheduler encola un refresco periódico. Con varias réplicas no se
+// duplica: solo se encola si no hay ya uno pendiente.
+func startStatsScheduler(db *gorm.DB, every time.Duration) {
+	for range time.Tick(every) {
+		var n int64
+		db.Model(&Job{}).Where("kind = ? AND status IN ?", "stats.refresh", []string{JobPending, JobRunning}).Count(&n)
+		if n > 0 {
+			continue
+		}
+		if _, err := enqueueJob(db, "stats.refresh", nil); err != nil {
+			log.Printf("[STATS] no pude encolar el refresco: %v", err)
+		}
+	}
+}
+
+type dayStats struct {
+	Day       string `json:"day"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+type userStats struct {
+	Total        int        `json:"total"`
+	Done         int        `json:"done"`
+	Completed7d  int        `json:"completed_7d" gorm:"column:completed_7d"`
+	Completed30d int        `json:"completed_30d" gorm:"column:completed_30d"`
+	Overdue      int        `json:"overdue"`
+	OldestDueAt  *time.Time `json:"oldest_due_at,omitempty"`
+	RefreshedAt  *time.Time `json:"refreshed_at,omitempty"`
+}
+
+func statsDays(c *gin.Context) int {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		days = 30
+	}
+	return days
+}
+
+// statsHandler: GET /api/stats?days=30
+func statsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		since := time.Now().AddDate(0, 0, -statsDays(c))
+		var s userStats
+		err := db.Set(queryLabelKey, "stats.summary").Raw(`SELECT c.total, c.done, c.completed_7d, c.completed_30d, c.refreshed_at,
+				coalesce(o.overdue, 0) AS overdue, o.oldest_due_at
+			FROM (SELECT 1) x
+			LEFT JOIN stats_user_completions c ON c.user_id = ?
+			LEFT JOIN stats_overdue o ON o.user_id = ?`, uid, uid).Scan(&s).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		var perDay []dayStats
+		err = db.Set(queryLabelKey, "stats.per_day").Raw(`SELECT to_char(day, 'YYYY-MM-DD') AS day, created, completed
+			FROM stats_tasks_per_day WHERE user_id = ? AND day >= ? ORDER BY day`, uid, since).Scan(&perDay).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		// Los hábitos son pocos por usuario: se calculan al momento.
+		habits, err := loadHabitViews(db, uid, userLocation(c.GetString("timezone")), false)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"summary": s, "per_day": perDay, "habits": habits})
+	}
+}
+
+// adminStatsHandler: GET /admin/stats?days=30, totales de la instancia.
+func adminStatsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		since := time.Now().AddDate(0, 0, -statsDays(c))
+		var s userStats
+		err := db.Set(queryLabelKey, "stats.admin_summary").Raw(`SELECT coalesce(sum(c.total), 0) AS total, coalesce(sum(c.done), 0) AS done,
+				coalesce(sum(c.completed_7d), 0) AS completed_7d, coalesce(sum(c.completed_30d), 0) AS completed_30d,
+				max(c.refreshed_at) AS refreshed_at,
+				(SELECT coalesce(sum(overdue), 0) FROM stats_overdue) AS overdue,
+				(SELECT min(oldest_due_at) FROM stats_overdue) AS oldest_due_at
+			FROM stats_user_completions c`).Scan(&s).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		var perDay []dayStats
+		err = db.Set(queryLabelKey, "stats.admin_per_day").Raw(`SELECT to_char(day, 'YYYY-MM-DD') AS day, sum(created)::int AS created, sum(completed)::int AS completed
+			FROM stats_tasks_per_day WHERE day >= ? GROUP BY day ORDER BY day`, since).Scan(&perDay).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, gin.H{"summary": s, "per_day": perDay})
+	}
+}
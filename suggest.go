@@ -0,0 +1,157 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= SUGGEST =========
+//
+// Resultados rápidos para la paleta de comandos: tareas, búsquedas guardadas y
+// comandos de la app. Solo se usan búsquedas por prefijo (indexadas) para
+// mantener la respuesta por debajo de ~50ms.
+
+// SavedSearch es una búsqueda que el usuario ha marcado con estrella.
+type SavedSearch struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	Query     string    `gorm:"not null" json:"query"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Suggestion struct {
+	Type  string `json:"type"` // task | search | command
+	ID    uint   `json:"id,omitempty"`
+	Label string `json:"label"`
+	Hint  string `json:"hint,omitempty"`
+	score int
+}
+
+// paletteCommands son acciones de cliente; el id lo interpreta la UI.
+var paletteCommands = []Suggestion{
+	{Type: "command", Label: "Nueva tarea", Hint: "task.new"},
+	{Type: "command", Label: "Buscar tareas", Hint: "task.search"},
+	{Type: "command", Label: "Tareas recientes", Hint: "task.recent"},
+	{Type: "command", Label: "Canales de notificación", Hint: "notifications.channels"},
+	{Type: "command", Label: "Perfil", Hint: "me"},
+}
+
+var suggestMigrations = []string{
+	`CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_tasks_title_prefix ON tasks (user_id, f_unaccent(lower(title)) text_pattern_ops)`,
+}
+
+// prefixScore puntúa 2 si label empieza por q y 1 si alguna palabra empieza por q.
+func prefixScore(label, q string) int {
+	l := strings.ToLower(label)
+	if strings.HasPrefix(l, q) {
+		return 2
+	}
+	for _, w := range strings.Fields(l) {
+		if strings.HasPrefix(w, q) {
+			return 1
+		}
+	}
+	return 0
+}
+
+func suggestHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetUint("user_id")
+		q := strings.ToLower(strings.TrimSpace(c.Query("q")))
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+		if err != nil || limit < 1 || limit > 30 {
+			limit = 10
+		}
+		var out []Suggestion
+		if q != "" {
+			var tasks []Task
+			if err := db.Select("id", "title", "done").
+				Where("user_id = ? AND f_unaccent(lower(title)) LIKE f_unaccent(?) || '%'", uid, escapeLike(q)).
+				Order("done, id desc").Limit(limit).Find(&tasks).Error; err != nil {
+				c.JSON(500, gin.H{"error": "db error"})
+				return
+			}
+			for _, t := range tasks {
+				s := 3
+				if t.Done {
+					s = 2
+				}
+				out = append(out, Suggestion{Type: "task", ID: t.ID, Label: t.Title, score: s})
+			}
+		}
+		var saved []SavedSearch
+		if err := db.Where("user_id = ?", uid).Order("id desc").Limit(50).Find(&saved).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		for _, s := range saved {
+			if sc := prefixScore(s.Query, q); q == "" || sc > 0 {
+				out = append(out, Suggestion{Type: "search", ID: s.ID, Label: s.Query, score: sc})
+			}
+		}
+		for _, cmd := range paletteCommands {
+			if sc := prefixScore(cmd.Label, q); q == "" || sc > 0 {
+				cmd.score = sc
+				out = append(out, cmd)
+			}
+		}
+		sort.SliceStable(out, func(i, j int) bool { return out[i].score > out[j].score })
+		if len(out) > limit {
+			out = out[:limit]
+		}
+		if out == nil {
+			out = []Suggestion{}
+		}
+		c.JSON(200, out)
+	}
+}
+
+func listSavedSearchesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var saved []SavedSearch
+		if err := db.Where("user_id = ?", c.GetUint("user_id")).Order("id desc").Find(&saved).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, saved)
+	}
+}
+
+func createSavedSearchHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Query string `json:"query" binding:"required"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		s := SavedSearch{UserID: c.GetUint("user_id"), Query: strings.TrimSpace(in.Query)}
+		if err := db.Create(&s).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(201, s)
+	}
+}
+
+func deleteSavedSearchHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res := db.Where("user_id = ? AND id = ?", c.GetUint("user_id"), c.Param("id")).Delete(&SavedSearch{})
+		if res.Error != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(404, gin.H{"error": "búsqueda no encontrada"})
+			return
+		}
+		c.JSON(200, gin.H{"deleted": c.Param("id")})
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= TELEMETRÍA =========
+//
+// Desactivada por defecto. Con TELEMETRY_ENABLED=true y TELEMETRY_URL, una vez
+// al día (TELEMETRY_INTERVAL_HOURS) se manda un informe anónimo: versión,
+// base de datos, qué funciones están configuradas o en uso (solo sí/no) y el
+// tamaño de la instancia en rangos. Nunca emails, nombres, hosts, IPs ni
+// contenido. GET /admin/telemetry enseña exactamente lo que se enviaría.
+
+var (
+	telemetryEnabled  = getEnv("TELEMETRY_ENABLED", "false") == "true"
+	telemetryURL      = os.Getenv("TELEMETRY_URL")
+	telemetryInterval = time.Duration(getEnvInt("TELEMETRY_INTERVAL_HOURS", 24)) * time.Hour
+	telemetryClient   = &http.Client{Timeout: 10 * time.Second}
+)
+
+type telemetryReport struct {
+	InstanceID string            `json:"instance_id"`
+	Version    string            `json:"version"`
+	GoVersion  string            `json:"go_version"`
+	OS         string            `json:"os"`
+	Arch       string            `json:"arch"`
+	Database   string            `json:"database"`
+	Users      string            `json:"users"`
+	Tasks      string            `json:"tasks"`
+	Providers  map[string]string `json:"providers"`
+	Notifiers  []string          `json:"notifiers"`
+	Features   map[string]bool   `json:"features"`
+}
+
+// checkTelemetry falla al arrancar si se activó sin destino.
+func checkTelemetry() error {
+	if telemetryEnabled && telemetryURL == "" {
+		return errors.New("TELEMETRY_ENABLED=true requiere TELEMETRY_URL")
+	}
+	return nil
+}
+
+// telemetryInstanceID es estable por instancia y no se puede revertir: un
+// HMAC del secreto JWT, que nunca sale del servidor.
+func telemetryInstanceID() string {
+	m := hmac.New(sha256.New, jwtSecret)
+	m.Write([]byte("telemetry"))
+	return hex.EncodeToString(m.Sum(nil))[:16]
+}
+
+// sizeBucket redondea un contador a un rango para no publicar cifras exactas.
+func sizeBucket(n int64) string {
+	switch {
+	case n == 0:
+		return "0"
+	case n <= 10:
+		return "1-10"
+	case n <= 100:
+		return "11-100"
+	case n <= 1000:
+		return "101-1000"
+	case n <= 10000:
+		return "1001-10000"
+	default:
+		return "10000+"
+	}
+}
+
+func anyRows(db *gorm.DB, model any) bool {
+	var n int64
+	db.Model(model).Limit(1).Count(&n)
+	return n > 0
+}
+
+func buildTelemetry(db *gorm.DB) telemetryReport {
+	var users, tasks int64
+	db.Model(&User{}).Where("is_demo = ?", false).Count(&users)
+	db.Model(&Task{}).Count(&tasks)
+	var pgVersion string
+	db.Raw("SELECT current_setting('server_version_num')").Scan(&pgVersion)
+
+	kinds := make([]string, 0, len(notifiers))
+	for k := range notifiers {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+
+	return telemetryReport{
+		InstanceID: telemetryInstanceID(),
+		Version:    version,
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Database:   "postgres " + pgVersion,
+		Users:      sizeBucket(users),
+		Tasks:      sizeBucket(tasks),
+		Providers: map[string]string{
+			"mailer": getEnv("MAILER", "log"),
+			"blob":   getEnv("BLOB_BACKEND", "local"),
+			"state":  stateBackend,
+			"cdn":    os.Getenv("CDN_PROVIDER"),
+		},
+		Notifiers: kinds,
+		Features: map[string]bool{
+			"cluster":        clusterMode,
+			"oidc":           os.Getenv("OIDC_ISSUER") != "",
+			"ldap":           ldapAuth != nil,
+			"scim":           os.Getenv("SCIM_TOKEN") != "",
+			"demo_mode":      demoMode,
+			"scripts":        os.Getenv("SCRIPTS_DIR") != "",
+			"hibp":           getEnv("HIBP_MODE", "off") != "off",
+			"login_backoff":  getEnv("LOGIN_BACKOFF", "false") == "true",
+			"email_webhooks": os.Getenv("EMAIL_WEBHOOK_TOKEN") != "",
+			"oauth_apps":     anyRows(db, &OAuthApp{}),
+			"imports":        anyRows(db, &Import{}),
+			"saved_searches": anyRows(db, &SavedSearch{}),
+			"channels":       anyRows(db, &NotificationChannel{}),
+		},
+	}
+}
+
+func telemetryJob(ctx context.Context, db *gorm.DB, _ Job) error {
+	if !telemetryEnabled {
+		return nil
+	}
+	raw, err := json.Marshal(buildTelemetry(db))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, telemetryURL, bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := telemetryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetría: el servidor respondió %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// startTelemetry encola un informe por intervalo. Con varias réplicas solo
+// sale uno: se salta si ya hay uno pendiente o enviado dentro del intervalo.
+func startTelemetry(db *gorm.DB) {
+	log.Printf("[TELEMETRY] activada: informe anónimo cada %s a %s (ver GET /admin/telemetry)", telemetryInterval, telemetryURL)
+	for {
+		var n int64
+		db.Model(&Job{}).
+			Where("kind = ? AND (status IN ? OR (status = ? AND updated_at > ?))", "telemetry.report",
+				[]string{JobPending, JobRunning}, JobDone, time.Now().Add(-telemetryInterval)).
+			Count(&n)
+		if n == 0 {
+			if _, err := enqueueJob(db, "telemetry.report", nil); err != nil {
+				log.Printf("[TELEMETRY] no pude encolar el informe: %v", err)
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// adminTelemetryHandler enseña el informe tal como se enviaría, esté o no
+// activada la telemetría.
+func adminTelemetryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"enabled": telemetryEnabled,
+			"url":     telemetryURL,
+			"report":  buildTelemetry(db),
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= FECHAS Y ZONAS HORARIAS =========
+//
+// En la base de datos todo es timestamptz y se guarda en UTC. Cada usuario
+// tiene su zona (timezone, IANA, UTC por defecto); las respuestas de /api la
+// devuelven en X-Timezone.
+//
+// Por defecto una fecha sin zona ("2026-10-16T09:00") se interpreta en la
+// zona del usuario. Con TIMESTAMPS_STRICT=true:
+//   - se rechaza con 400: hay que mandar RFC3339 con Z u offset;
+//   - las respuestas salen siempre en UTC;
+//   - no arranca si la sesión de Postgres no está en UTC o queda alguna
+//     columna timestamp sin zona.
+//
+// Las columnas sin zona de instalaciones antiguas las convierte la migración
+// "timestamps", leyendo sus valores como hora de TIMESTAMPS_LEGACY_TZ. Las
+// que ya eran timestamptz pero recibieron horas locales como si fueran UTC
+// (clientes de antes de las zonas) se corrigen a mano con
+// POST /admin/maintenance/shift-due-dates.
+
+var (
+	timestampsStrict = getEnv("TIMESTAMPS_STRICT", "false") == "true"
+	legacyTimezone   = getEnv("TIMESTAMPS_LEGACY_TZ", "UTC")
+)
+
+var timestampMigrations = []string{
+	`-- breaking: reescribe una sola vez las tablas con columnas timestamp sin zona; después no hace nada
+	DO $$
+	DECLARE col record;
+	BEGIN
+		FOR col IN
+			SELECT table_name, column_name FROM information_schema.columns
+			WHERE table_schema = current_schema() AND data_type = 'timestamp without time zone'
+		LOOP
+			EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE timestamptz USING %I AT TIME ZONE %L',
+				col.table_name, col.column_name, col.column_name, '` + strings.ReplaceAll(legacyTimezone, "'", "''") + `');
+		END LOOP;
+	END $$`,
+}
+
+// naiveLayouts son los formatos sin zona que se aceptan fuera del modo estricto.
+var naiveLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+var errNaiveTime = errors.New("fecha sin zona horaria: usa RFC3339 con Z u offset, p.ej. 2026-10-16T09:00:00+02:00")
+
+func userLocation(tz string) *time.Location {
+	if loc, err := time.LoadLocation(tz); err == nil && tz != "" {
+		return loc
+	}
+	return time.UTC
+}
+
+// parseAPITime lee una fecha de la API y la devuelve en UTC. tz es la zona del
+// usuario, para las fechas que llegan sin zona.
+func parseAPITime(s, tz string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	loc := userLocation(tz)
+	for _, layout := range naiveLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			if timestampsStrict {
+				return time.Time{}, errNaiveTime
+			}
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.New("fecha inválida: usa RFC3339")
+}
+
+type timestampAudit struct {
+	Strict          bool     `json:"strict"`
+	SessionTimezone string   `json:"session_timezone"`
+	LegacyTimezone  string   `json:"legacy_timezone"`
+	NaiveColumns    []string `json:"naive_columns"`
+}
+
+func auditTimestamps(db *gorm.DB) (timestampAudit, error) {
+	a := timestampAudit{Strict: timestampsStrict, LegacyTimezone: legacyTimezone, NaiveColumns: []string{}}
+	if err := db.Raw("SHOW TimeZone").Scan(&a.SessionTimezone).Error; err != nil {
+		return a, err
+	}
+	var cols []struct{ TableName, ColumnName string }
+	err := db.Raw(`SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND data_type = 'timestamp without time zone'
+		ORDER BY table_name, column_name`).Scan(&cols).Error
+	for _, c := range cols {
+		a.NaiveColumns = append(a.NaiveColumns, c.TableName+"."+c.ColumnName)
+	}
+	return a, err
+}
+
+// checkTimestamps se llama al arrancar, después de las migraciones.
+func checkTimestamps(db *gorm.DB) error {
+	if _, err := time.LoadLocation(legacyTimezone); err != nil {
+		return fmt.Errorf("TIMESTAMPS_LEGACY_TZ: %w", err)
+	}
+	if !timestampsStrict {
+		return nil
+	}
+	time.Local = time.UTC
+	a, err := auditTimestamps(db)
+	if err != nil {
+		return err
+	}
+	if a.SessionTimezone != "UTC" && a.SessionTimezone != "Etc/UTC" {
+		return fmt.Errorf("TIMESTAMPS_STRICT: la sesión de Postgres está en %s; añade TimeZone=UTC al DSN", a.SessionTimezone)
+	}
+	if len(a.NaiveColumns) > 0 {
+		if getEnv("MIGRATIONS_MODE", "foreground") == "background" {
+			log.Printf("[TIMESTAMPS] columnas sin zona pendientes de la migración en segundo plano: %s", strings.Join(a.NaiveColumns, ", "))
+			return nil
+		}
+		return fmt.Errorf("TIMESTAMPS_STRICT: columnas sin zona horaria: %s", strings.Join(a.NaiveColumns, ", "))
+	}
+	return nil
+}
+
+const settingDueShifts = "timestamps.due_shifts"
+
+type dueShiftRun struct {
+	FromTZ        string     `json:"from_tz"`
+	UserID        uint       `json:"user_id,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	Shifted       int64      `json:"shifted"`
+	By            uint       `json:"by"`
+	At            time.Time  `json:"at"`
+}
+
+// adminShiftDueDatesHandler reinterpreta los due_at guardados como si su hora
+// UTC fuera la hora local de from_tz ("user" = la zona de cada usuario). Por
+// defecto es un dry run que cuenta y enseña una muestra. Aplicarlo dos veces
+// desplaza las fechas dos veces, así que una segunda ejecución pide force.
+func adminShiftDueDatesHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		FromTZ        string     `json:"from_tz" binding:"required"`
+		UserID        uint       `json:"user_id"`
+		CreatedBefore *time.Time `json:"created_before"`
+		DryRun        *bool      `json:"dry_run"`
+		Force         bool       `json:"force"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		tzExpr, args := "users.timezone", []any{}
+		if in.FromTZ != "user" {
+			if _, err := time.LoadLocation(in.FromTZ); err != nil || in.FromTZ == "Local" {
+				c.JSON(400, gin.H{"error": "from_tz debe ser una zona IANA o \"user\""})
+				return
+			}
+			tzExpr, args = "?", []any{in.FromTZ}
+		}
+		shifted := "(tasks.due_at AT TIME ZONE 'UTC') AT TIME ZONE " + tzExpr
+		where, whereArgs := "tasks.due_at IS NOT NULL", []any{}
+		if in.UserID != 0 {
+			where += " AND tasks.user_id = ?"
+			whereArgs = append(whereArgs, in.UserID)
+		}
+		if in.CreatedBefore != nil {
+			where += " AND tasks.created_at < ?"
+			whereArgs = append(whereArgs, *in.CreatedBefore)
+		}
+
+		var total int64
+		if err := db.Model(&Task{}).Where(where, whereArgs...).Count(&total).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if in.DryRun == nil || *in.DryRun {
+			var sample []struct {
+				ID       uint      `json:"id"`
+				UserID   uint      `json:"user_id"`
+				DueAt    time.Time `json:"due_at"`
+				NewDueAt time.Time `json:"new_due_at"`
+			}
+			err := db.Raw(`SELECT tasks.id, tasks.user_id, tasks.due_at, `+shifted+` AS new_due_at
+				FROM tasks JOIN users ON users.id = tasks.user_id WHERE `+where+` ORDER BY tasks.id LIMIT 20`,
+				append(args, whereArgs...)...).Scan(&sample).Error
+			if err != nil {
+				c.JSON(500, gin.H{"error": "db error"})
+				return
+			}
+			c.JSON(200, gin.H{"dry_run": true, "tasks": total, "sample": sample})
+			return
+		}
+
+		var runs []dueShiftRun
+		if _, err := getSetting(db, settingDueShifts, &runs); err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if len(runs) > 0 && !in.Force {
+			c.JSON(409, gin.H{"error": "ya se desplazaron fechas antes; repite con force si de verdad hay que hacerlo otra vez", "runs": runs})
+			return
+		}
+		run := dueShiftRun{FromTZ: in.FromTZ, UserID: in.UserID, CreatedBefore: in.CreatedBefore, By: c.GetUint("user_id"), At: time.Now()}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Exec(`UPDATE tasks SET due_at = `+shifted+` FROM users WHERE users.id = tasks.user_id AND `+where,
+				append(args, whereArgs...)...)
+			if res.Error != nil {
+				return res.Error
+			}
+			run.Shifted = res.RowsAffected
+			return putSetting(tx, settingDueShifts, append(runs, run))
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		log.Printf("[TIMESTAMPS] user %d desplazó %d due_at desde %s (user_id=%d)", run.By, run.Shifted, run.FromTZ, run.UserID)
+
+		// Los recordatorios ya programados apuntan a la hora vieja: con la cola se
+		// descartan solos y aquí se programan los nuevos.
+		var uids []uint
+		db.Model(&Task{}).Distinct("user_id").Where("NOT done AND due_at > ?", time.Now()).
+			Where(where, whereArgs...).Pluck("user_id", &uids)
+		for _, uid := range uids {
+			if _, _, err := reconcileReminders(db, uid); err != nil {
+				log.Printf("[TIMESTAMPS] no pude reprogramar los recordatorios del user %d: %v", uid, err)
+			}
+		}
+		c.JSON(200, gin.H{"dry_run": false, "shifted": run.Shifted})
+	}
+}
+
+func adminTimestampsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a, err := auditTimestamps(db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, a)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========= VERSIÓN =========
+//
+// Se fijan al compilar (make build o el Dockerfile lo hacen solos):
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=abc1234 -X main.buildDate=2026-10-01T12:00:00Z"
+//
+// Sin ldflags, commit y buildDate salen de la info de VCS que añade go build.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// Con UPDATE_CHECK=true, /version compara con la última release publicada en
+// GitHub (UPDATE_CHECK_REPO). La respuesta se cachea unas horas.
+var (
+	updateCheck     = getEnv("UPDATE_CHECK", "false") == "true"
+	updateCheckRepo = getEnv("UPDATE_CHECK_REPO", "daniellopezmateos22/taskflow-go")
+	updateCheckTTL  = 6 * time.Hour
+	updateClient    = &http.Client{Timeout: 5 * time.Second}
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if commit == "" {
+				commit = s.Value
+			}
+		case "vcs.time":
+			if buildDate == "" {
+				buildDate = s.Value
+			}
+		}
+	}
+}
+
+type releaseInfo struct {
+	Latest    string    `json:"latest"`
+	URL       string    `json:"url"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+var latestRelease struct {
+	sync.Mutex
+	info *releaseInfo
+	err  error
+	at   time.Time
+}
+
+func fetchLatestRelease(ctx context.Context) (*releaseInfo, error) {
+	latestRelease.Lock()
+	defer latestRelease.Unlock()
+	if !latestRelease.at.IsZero() && time.Since(latestRelease.at) < updateCheckTTL {
+		return latestRelease.info, latestRelease.err
+	}
+	info, err := queryLatestRelease(ctx)
+	if err != nil {
+		log.Printf("[VERSION] no pude consultar la última release: %v", err)
+	}
+	latestRelease.info, latestRelease.err, latestRelease.at = info, err, time.Now()
+	return info, err
+}
+
+func queryLatestRelease(ctx context.Context) (*releaseInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/repos/"+updateCheckRepo+"/releases/latest", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub respondió %d", resp.StatusCode)
+	}
+	var body struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return &releaseInfo{Latest: body.TagName, URL: body.HTMLURL, CheckedAt: time.Now()}, nil
+}
+
+// newerRelease compara etiquetas vX.Y.Z; si alguna no tiene ese formato, basta
+// con que sean distintas.
+func newerRelease(latest, current string) bool {
+	l, okL := parseRelease(latest)
+	c, okC := parseRelease(current)
+	if !okL || !okC {
+		return latest != "" && latest != current
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+func parseRelease(tag string) ([3]int, bool) {
+	var v [3]int
+	core, _, _ := strings.Cut(strings.TrimPrefix(tag, "v"), "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+func versionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp := gin.H{"version": version, "commit": commit, "build_date": buildDate}
+		if updateCheck {
+			info, err := fetchLatestRelease(c.Request.Context())
+			if err != nil {
+				resp["update"] = gin.H{"error": "no se pudo consultar"}
+			} else {
+				resp["update"] = gin.H{
+					"latest":     info.Latest,
+					"url":        info.URL,
+					"checked_at": info.CheckedAt,
+					// Una build "dev" no se compara: no sabemos de qué release parte.
+					"update_available": version != "dev" && newerRelease(info.Latest, version),
+				}
+			}
+		}
+		c.JSON(200, resp)
+	}
+}
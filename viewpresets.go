@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========= PRESETS DE VISTA =========
+//
+// Cómo se pinta una lista (columnas, orden, agrupación), con nombre y guardado
+// en el servidor para que la web, la CLI y el móvil la vean igual. No filtra:
+// eso son las búsquedas guardadas. GET /api/tasks?preset=<id> aplica el orden
+// del preset cuando no se pasan sort/order.
+
+type ViewPreset struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_view_presets_user_name" json:"user_id"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_view_presets_user_name" json:"name"`
+	Columns   []string  `gorm:"serializer:json;type:jsonb;not null" json:"columns"`
+	Sort      string    `gorm:"not null;default:'id'" json:"sort"`
+	Order     string    `gorm:"not null;default:'desc'" json:"order"`
+	GroupBy   string    `json:"group_by,omitempty"`
+	IsDefault bool      `gorm:"not null;default:false" json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var (
+	presetColumns = []string{"title", "done", "priority", "due_at", "created_at", "updated_at", "completed_at"}
+	presetGroupBy = []string{"", "priority", "done", "due_date"}
+)
+
+var defaultPresetColumns = []string{"title", "priority", "due_at"}
+
+func (p *ViewPreset) validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || len(p.Name) > 80 {
+		return errors.New("name requerido (máximo 80 caracteres)")
+	}
+	if len(p.Columns) == 0 {
+		p.Columns = defaultPresetColumns
+	}
+	for _, col := range p.Columns {
+		if !slices.Contains(presetColumns, col) {
+			return errors.New("columna desconocida: " + col)
+		}
+	}
+	if p.Sort == "" {
+		p.Sort = "id"
+	}
+	if !taskSortColumns[p.Sort] {
+		return errors.New("sort debe ser id, created_at, updated_at o due_at")
+	}
+	if p.Order == "" {
+		p.Order = "desc"
+	}
+	if p.Order != "asc" && p.Order != "desc" {
+		return errors.New("order debe ser asc o desc")
+	}
+	if !slices.Contains(presetGroupBy, p.GroupBy) {
+		return errors.New("group_by debe ser priority, done o due_date")
+	}
+	return nil
+}
+
+// savePreset guarda p y, si es el predeterminado, desmarca los demás.
+func savePreset(db *gorm.DB, p *ViewPreset) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if p.IsDefault {
+			if err := tx.Model(&ViewPreset{}).Where("user_id = ? AND id <> ?", p.UserID, p.ID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(p).Error
+	})
+}
+
+func listViewPresetsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var presets []ViewPreset
+		if err := db.Where("user_id = ?", c.GetUint("user_id")).Order("name").Find(&presets).Error; err != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		c.JSON(200, presets)
+	}
+}
+
+func getViewPresetHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var p ViewPreset
+		if err := db.Where("user_id = ? AND id = ?", c.GetUint("user_id"), c.Param("id")).First(&p).Error; err != nil {
+			c.JSON(404, gin.H{"error": "preset no encontrado"})
+			return
+		}
+		c.JSON(200, p)
+	}
+}
+
+func createViewPresetHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Name      string   `json:"name" binding:"required"`
+		Columns   []string `json:"columns"`
+		Sort      string   `json:"sort"`
+		Order     string   `json:"order"`
+		GroupBy   string   `json:"group_by"`
+		IsDefault bool     `json:"is_default"`
+	}
+	return func(c *gin.Context) {
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		p := ViewPreset{UserID: c.GetUint("user_id"), Name: in.Name, Columns: in.Columns, Sort: in.Sort, Order: in.Order, GroupBy: in.GroupBy, IsDefault: in.IsDefault}
+		if err := p.validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := savePreset(db, &p); err != nil {
+			c.JSON(409, gin.H{"error": "ya tienes un preset con ese nombre"})
+			return
+		}
+		c.JSON(201, p)
+	}
+}
+
+func updateViewPresetHandler(db *gorm.DB) gin.HandlerFunc {
+	type inT struct {
+		Name      *string   `json:"name"`
+		Columns   *[]string `json:"columns"`
+		Sort      *string   `json:"sort"`
+		Order     *string   `json:"order"`
+		GroupBy   *string   `json:"group_by"`
+		IsDefault *bool     `json:"is_default"`
+	}
+	return func(c *gin.Context) {
+		var p ViewPreset
+		if err := db.Where("user_id = ? AND id = ?", c.GetUint("user_id"), c.Param("id")).First(&p).Error; err != nil {
+			c.JSON(404, gin.H{"error": "preset no encontrado"})
+			return
+		}
+		var in inT
+		if err := c.ShouldBindJSON(&in); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if in.Name != nil {
+			p.Name = *in.Name
+		}
+		if in.Columns != nil {
+			p.Columns = *in.Columns
+		}
+		if in.Sort != nil {
+			p.Sort = *in.Sort
+		}
+		if in.Order != nil {
+			p.Order = *in.Order
+		}
+		if in.GroupBy != nil {
+			p.GroupBy = *in.GroupBy
+		}
+		if in.IsDefault != nil {
+			p.IsDefault = *in.IsDefault
+		}
+		if err := p.validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := savePreset(db, &p); err != nil {
+			c.JSON(409, gin.H{"error": "ya tienes un preset con ese nombre"})
+			return
+		}
+		c.JSON(200, p)
+	}
+}
+
+func deleteViewPresetHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res := db.Where("user_id = ? AND id = ?", c.GetUint("user_id"), c.Param("id")).Delete(&ViewPreset{})
+		if res.Error != nil {
+			c.JSON(500, gin.H{"error": "db error"})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(404, gin.H{"error": "preset no encontrado"})
+			return
+		}
+		c.JSON(200, gin.H{"deleted": c.Param("id")})
+	}
+}